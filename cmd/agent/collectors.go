@@ -0,0 +1,48 @@
+package main
+
+import (
+	"github.com/vorotislav/alert-service/internal/collector"
+	"github.com/vorotislav/alert-service/internal/collector/cgroup"
+	"github.com/vorotislav/alert-service/internal/collector/cpu"
+	"github.com/vorotislav/alert-service/internal/collector/disk"
+	"github.com/vorotislav/alert-service/internal/collector/goruntime"
+	"github.com/vorotislav/alert-service/internal/collector/load"
+	"github.com/vorotislav/alert-service/internal/collector/logtail"
+	"github.com/vorotislav/alert-service/internal/collector/memory"
+	"github.com/vorotislav/alert-service/internal/collector/netstat"
+	"github.com/vorotislav/alert-service/internal/collector/probe"
+	"github.com/vorotislav/alert-service/internal/collector/process"
+	"github.com/vorotislav/alert-service/internal/collector/push"
+	"github.com/vorotislav/alert-service/internal/collector/script"
+	"github.com/vorotislav/alert-service/internal/collector/statsd"
+)
+
+// newRegistry регистрирует все коллекторы, доступные агенту.
+// Коллекторы runtime, memory, cpu, load, disk и net включены по умолчанию,
+// остальные нужно включить явно: process, exec, logtail и probe нужны настройки, cgroup есть только в Linux,
+// а statsd и push открывают порт.
+func newRegistry() *collector.Registry {
+	r := collector.NewRegistry()
+
+	mustRegister(r, goruntime.Name, goruntime.New, true)
+	mustRegister(r, memory.Name, memory.New, true)
+	mustRegister(r, cpu.Name, cpu.New, true)
+	mustRegister(r, load.Name, load.New, true)
+	mustRegister(r, disk.Name, disk.New, true)
+	mustRegister(r, netstat.Name, netstat.New, true)
+	mustRegister(r, process.Name, process.New, false)
+	mustRegister(r, cgroup.Name, cgroup.New, false)
+	mustRegister(r, script.Name, script.New, false)
+	mustRegister(r, logtail.Name, logtail.New, false)
+	mustRegister(r, probe.Name, probe.New, false)
+	mustRegister(r, statsd.Name, statsd.New, false)
+	mustRegister(r, push.Name, push.New, false)
+
+	return r
+}
+
+func mustRegister(r *collector.Registry, name string, f collector.Factory, enabled bool) {
+	if err := r.Register(name, f, enabled); err != nil {
+		panic(err)
+	}
+}
@@ -5,7 +5,9 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 
 	"github.com/vorotislav/alert-service/internal/settings/agent"
 
@@ -17,6 +19,10 @@ const (
 	defaultPollInterval   = 2
 	defaultReportInterval = 10
 	defaultRateLimit      = 3
+	defaultBatchSize      = 100
+	defaultSpoolDir       = "/tmp/metrics-agent-spool"
+	defaultSpoolMaxBytes  = 10 << 20
+	defaultSpoolMaxAge    = 3600
 )
 
 func parseFlags(sets *agent.Settings) { //nolint:gocognit,cyclop
@@ -45,6 +51,30 @@ func parseFlags(sets *agent.Settings) { //nolint:gocognit,cyclop
 			flag.StringVar(&sets.CryptoKey, "crypto-key", "", "path to file with public key")
 		}
 
+		if sets.BatchSize == 0 {
+			flag.IntVar(&sets.BatchSize, "b", 0, "max metrics in one batch request")
+		}
+
+		if sets.SpoolDir == "" {
+			flag.StringVar(&sets.SpoolDir, "spool-dir", "", "directory for unsent metrics")
+		}
+
+		if sets.SpoolMaxBytes == 0 {
+			flag.Int64Var(&sets.SpoolMaxBytes, "spool-max-bytes", 0, "max size of unsent metrics, bytes")
+		}
+
+		if sets.SpoolMaxAge == 0 {
+			flag.IntVar(&sets.SpoolMaxAge, "spool-max-age", 0, "max age of unsent metrics, sec")
+		}
+
+		if sets.Host == "" {
+			flag.StringVar(&sets.Host, "host", "", "value of host label, default is hostname")
+		}
+
+		if sets.ID == "" {
+			flag.StringVar(&sets.ID, "id", "", "agent id, default is host label")
+		}
+
 		if sets.Config == "" {
 			flag.StringVar(&sets.Config, "config", "", "path to config file")
 		}
@@ -97,7 +127,89 @@ func parseFlags(sets *agent.Settings) { //nolint:gocognit,cyclop
 				sets.CryptoKey = cfg.CryptoKey
 			}
 		}
+
+		if sets.BatchSize <= 0 && cfg.BatchSize != "" {
+			size, err := strconv.Atoi(cfg.BatchSize)
+			if err == nil {
+				sets.BatchSize = size
+			}
+		}
+
+		if sets.SpoolDir == "" {
+			sets.SpoolDir = cfg.SpoolDir
+		}
+
+		if sets.Host == "" {
+			sets.Host = cfg.Host
+		}
+
+		if sets.ID == "" {
+			sets.ID = cfg.ID
+		}
+
+		sets.Labels = cfg.Labels
+		sets.Collectors = cfg.Collectors
+		sets.Aggregation = cfg.Aggregation
+
+		if sets.SpoolMaxBytes <= 0 && cfg.SpoolMaxBytes != "" {
+			size, err := strconv.ParseInt(cfg.SpoolMaxBytes, 10, 64)
+			if err == nil {
+				sets.SpoolMaxBytes = size
+			}
+		}
+
+		if sets.SpoolMaxAge <= 0 && cfg.SpoolMaxAge != "" {
+			age, err := strconv.Atoi(cfg.SpoolMaxAge)
+			if err == nil {
+				sets.SpoolMaxAge = age
+			}
+		}
+	}
+
+	if sets.BatchSize <= 0 {
+		sets.BatchSize = defaultBatchSize
+	}
+
+	if sets.SpoolMaxBytes <= 0 {
+		sets.SpoolMaxBytes = defaultSpoolMaxBytes
+	}
+
+	if sets.SpoolMaxAge <= 0 {
+		sets.SpoolMaxAge = defaultSpoolMaxAge
+	}
+
+	if sets.Host == "" {
+		if host, err := os.Hostname(); err == nil {
+			sets.Host = host
+		}
+	}
+
+	if sets.ID == "" {
+		sets.ID = sets.Host
+	}
+
+	// Очередь по умолчанию у каждого агента своя, чтобы агенты на одном хосте не отправляли чужие пакеты.
+	if sets.SpoolDir == "" {
+		sets.SpoolDir = filepath.Join(defaultSpoolDir, spoolDirName(sets.ID))
+	}
+}
+
+// spoolDirName возвращает имя каталога очереди агента: символы идентификатора, недопустимые в имени файла,
+// заменяются на "_".
+func spoolDirName(id string) string {
+	name := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' || r == '_' {
+			return r
+		}
+
+		return '_'
+	}, id)
+
+	if name == "" || name == "." || name == ".." {
+		return "default"
 	}
+
+	return name
 }
 
 func readConfigFile(path string) (agent.Config, error) {
@@ -12,6 +12,7 @@ import (
 	"github.com/vorotislav/alert-service/internal/metrics"
 	"github.com/vorotislav/alert-service/internal/settings/agent"
 	"github.com/vorotislav/alert-service/internal/signals"
+	"github.com/vorotislav/alert-service/internal/spool"
 
 	"go.uber.org/zap"
 )
@@ -29,6 +30,8 @@ func main() {
 
 	parseFlags(&sets)
 
+	sets.Version = buildVersion
+
 	logger, err := zap.NewDevelopment()
 	if err != nil {
 		log.Printf("cannot create logger: %s", err.Error())
@@ -48,6 +51,8 @@ func main() {
 		zap.Int("report interval", sets.ReportInterval),
 		zap.Int("poll interval", sets.PollInterval),
 		zap.Int("rate limit", sets.RateLimit),
+		zap.Int("batch size", sets.BatchSize),
+		zap.String("spool dir", sets.SpoolDir),
 		zap.String("hash key", sets.HashKey))
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -62,7 +67,21 @@ func main() {
 
 	wc := client.NewClient(logger, &sets)
 
-	worker := metrics.NewWorker(logger, &sets, wc)
+	var sp metrics.Spool
+
+	s, err := spool.NewSpool(logger, sets.SpoolDir, sets.SpoolMaxBytes, time.Duration(sets.SpoolMaxAge)*time.Second)
+	if err != nil {
+		logger.Error("cannot create spool, unsent metrics will be lost", zap.Error(err))
+	} else {
+		sp = s
+	}
+
+	collectors, err := newRegistry().Build(logger, sets.Collectors)
+	if err != nil {
+		logger.Error("cannot create some collectors", zap.Error(err))
+	}
+
+	worker := metrics.NewWorker(logger, &sets, wc, sp, collectors)
 	worker.Start(ctx)
 
 	<-ctx.Done()
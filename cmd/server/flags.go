@@ -8,6 +8,8 @@ import (
 	"os"
 	"strconv"
 
+	"github.com/vorotislav/alert-service/internal/agents"
+	"github.com/vorotislav/alert-service/internal/repository/localstorage"
 	"github.com/vorotislav/alert-service/internal/settings/server"
 
 	"github.com/caarlos0/env/v6"
@@ -18,6 +20,10 @@ const (
 	defaultRestore     = true
 	defaultInterval    = 300
 	defaultStoragePath = "/tmp/metrics-db.json"
+
+	defaultAlertsInterval   = 10
+	defaultWALCompact       = 300
+	defaultHistoryRetention = 7 * 24 * 60 * 60
 )
 
 var errEmptyFilePath = errors.New("empty file path")
@@ -51,6 +57,22 @@ func parseFlag(sets *server.Settings) {
 
 	flag.StringVar(&cryptoKey, "crypto-key", "", "path to file with private key")
 
+	var walFsync string
+
+	flag.StringVar(&walFsync, "wal-fsync", "", "wal fsync policy: always, interval or never")
+
+	var walCompact int
+
+	flag.IntVar(&walCompact, "wal-compact", 0, "wal compaction interval, sec")
+
+	var historyRetention int
+
+	flag.IntVar(&historyRetention, "history-retention", 0, "metrics history retention in database, sec")
+
+	var agentStale int
+
+	flag.IntVar(&agentStale, "agent-stale", 0, "missed report intervals before agent is stale")
+
 	var configFile string
 
 	flag.StringVar(&configFile, "config", "", "path to config file")
@@ -95,6 +117,33 @@ func parseFlag(sets *server.Settings) {
 	if sets.CryptoKey == "" {
 		sets.CryptoKey = getKey(cryptoKey, cfg.CryptoKey)
 	}
+
+	if sets.AlertsInterval <= 0 {
+		sets.AlertsInterval = getAlertsInterval(cfg.AlertsInterval)
+	}
+
+	if sets.HistorySize <= 0 {
+		sets.HistorySize = cfg.HistorySize
+	}
+
+	if sets.HistoryRetention <= 0 {
+		sets.HistoryRetention = getHistoryRetention(historyRetention, cfg.HistoryTTL)
+	}
+
+	if sets.WALFsync == "" {
+		sets.WALFsync = getWALFsync(walFsync, cfg.WALFsync, *sets.StoreInterval)
+	}
+
+	if sets.WALCompact <= 0 {
+		sets.WALCompact = getWALCompact(walCompact, cfg.WALCompact)
+	}
+
+	if sets.AgentStaleIntervals <= 0 {
+		sets.AgentStaleIntervals = getAgentStale(agentStale, cfg.AgentStale)
+	}
+
+	sets.AlertRules = cfg.AlertRules
+	sets.Notify = cfg.Notify
 }
 
 func readConfigFile(path string) (server.Config, error) {
@@ -163,3 +212,73 @@ func getKey(flagKey, cfgKey string) string {
 
 	return cfgKey
 }
+
+func getAlertsInterval(confInterval string) int {
+	if confInterval == "" {
+		return defaultAlertsInterval
+	}
+
+	interval, err := strconv.Atoi(confInterval)
+	if err != nil || interval <= 0 {
+		return defaultAlertsInterval
+	}
+
+	return interval
+}
+
+// getWALFsync возвращает политику синхронизации журнала. По умолчанию при нулевом интервале сохранения
+// каждая запись синхронизируется сразу, иначе - раз в интервал сохранения.
+func getWALFsync(flagPolicy, confPolicy string, storeInterval int) string {
+	if flagPolicy != "" {
+		return flagPolicy
+	}
+
+	if confPolicy != "" {
+		return confPolicy
+	}
+
+	if storeInterval == 0 {
+		return localstorage.FsyncAlways
+	}
+
+	return localstorage.FsyncInterval
+}
+
+func getWALCompact(flagInterval int, confInterval string) int {
+	if flagInterval > 0 {
+		return flagInterval
+	}
+
+	interval, err := strconv.Atoi(confInterval)
+	if err != nil || interval <= 0 {
+		return defaultWALCompact
+	}
+
+	return interval
+}
+
+func getHistoryRetention(flagRetention int, confRetention string) int {
+	if flagRetention > 0 {
+		return flagRetention
+	}
+
+	retention, err := strconv.Atoi(confRetention)
+	if err != nil || retention <= 0 {
+		return defaultHistoryRetention
+	}
+
+	return retention
+}
+
+func getAgentStale(flagIntervals int, confIntervals string) int {
+	if flagIntervals > 0 {
+		return flagIntervals
+	}
+
+	intervals, err := strconv.Atoi(confIntervals)
+	if err != nil || intervals <= 0 {
+		return agents.DefaultStaleIntervals
+	}
+
+	return intervals
+}
@@ -7,7 +7,10 @@ import (
 	"os"
 	"time"
 
+	"github.com/vorotislav/alert-service/internal/agents"
+	"github.com/vorotislav/alert-service/internal/alerts"
 	"github.com/vorotislav/alert-service/internal/http"
+	"github.com/vorotislav/alert-service/internal/notifier"
 	"github.com/vorotislav/alert-service/internal/repository"
 	"github.com/vorotislav/alert-service/internal/settings/server"
 	"github.com/vorotislav/alert-service/internal/signals"
@@ -46,8 +49,12 @@ func main() {
 		zap.String("ip address", sets.Address),
 		zap.Bool("restore flag", *sets.Restore),
 		zap.String("file path", sets.FileStoragePath),
+		zap.String("wal fsync", sets.WALFsync),
+		zap.Int("wal compact interval", sets.WALCompact),
 		zap.String("database dsn", sets.DatabaseDSN),
-		zap.String("hash key", sets.HashKey))
+		zap.String("hash key", sets.HashKey),
+		zap.Int("alerts interval", sets.AlertsInterval),
+		zap.Int("alert rules", len(sets.AlertRules)))
 
 	ctx, cancel := context.WithCancel(context.Background())
 	oss := signals.NewOSSignals(ctx)
@@ -67,7 +74,34 @@ func main() {
 		return
 	}
 
-	s, err := http.NewService(ctx, logger, &sets, repo)
+	var alertsNotifier alerts.Notifier
+
+	if len(sets.Notify.Webhooks) > 0 {
+		n, err := notifier.NewNotifier(logger, &sets.Notify)
+		if err != nil {
+			logger.Error("cannot create notifier", zap.Error(err))
+
+			return
+		}
+
+		n.Start(ctx)
+
+		alertsNotifier = n
+	}
+
+	engine, err := alerts.NewEngine(logger, &sets, repo, alertsNotifier)
+	if err != nil {
+		logger.Error("cannot create alerts engine", zap.Error(err))
+
+		return
+	}
+
+	engine.Start(ctx)
+
+	registry := agents.NewRegistry(logger, &sets, repo)
+	registry.Start(ctx)
+
+	s, err := http.NewService(ctx, logger, &sets, repo, engine, registry)
 	if err != nil {
 		logger.Error("cannot create http service", zap.Error(err))
 
@@ -0,0 +1,265 @@
+// Пакет agents представляет реестр агентов, которые присылают метрики на сервер. Агент сообщает о себе
+// в заголовках запросов с метриками; реестр запоминает, когда агент был виден в последний раз,
+// и считает его пропавшим, если тот пропустил несколько интервалов отправки подряд.
+//
+// Для каждого агента реестр записывает в хранилище gauge agent_up с метками agent и host:
+// 1, пока агент присылает метрики, и 0, когда он пропал. На неё можно настроить алерт
+// или забирать её через /metrics.
+package agents
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/vorotislav/alert-service/internal/model"
+	"github.com/vorotislav/alert-service/internal/settings/server"
+
+	"go.uber.org/zap"
+)
+
+// Синтетическая метрика доступности агента и её метки.
+const (
+	MetricUp   = "agent_up"
+	LabelAgent = "agent"
+)
+
+const (
+	// DefaultStaleIntervals сколько интервалов отправки подряд агент может пропустить, прежде чем считается пропавшим.
+	DefaultStaleIntervals = 3
+	// defaultReportInterval интервал отправки агента, который не сообщил свой интервал.
+	defaultReportInterval = 10 * time.Second
+	checkInterval         = time.Second
+	queryRepoTimeout      = 2 * time.Second
+)
+
+// Store интерфейс хранилища, в которое записывается метрика agent_up.
+type Store interface {
+	UpdateMetric(ctx context.Context, metric model.Metrics) (model.Metrics, error)
+	ListMetrics(ctx context.Context) ([]model.Metrics, error)
+}
+
+// Info сведения об агенте из запроса с метриками.
+type Info struct {
+	ID             string
+	Host           string
+	Version        string
+	Address        string
+	ReportInterval time.Duration
+}
+
+// FromRequest возвращает сведения об агенте из заголовков запроса. Если агент не передал свой ID,
+// возвращает false: такой запрос не связан ни с одним агентом.
+func FromRequest(r *http.Request) (Info, bool) {
+	info := Info{
+		ID:      r.Header.Get(model.HeaderAgentID),
+		Host:    r.Header.Get(model.HeaderAgentHost),
+		Version: r.Header.Get(model.HeaderAgentVersion),
+		Address: r.RemoteAddr,
+	}
+
+	if info.ID == "" {
+		return Info{}, false
+	}
+
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		info.Address = host
+	}
+
+	if sec, err := strconv.Atoi(r.Header.Get(model.HeaderAgentReportInterval)); err == nil && sec > 0 {
+		info.ReportInterval = time.Duration(sec) * time.Second
+	}
+
+	return info, true
+}
+
+type agent struct {
+	model.Agent
+	interval time.Duration
+}
+
+// Registry реестр агентов.
+type Registry struct {
+	log            *zap.Logger
+	store          Store
+	staleIntervals int
+	now            func() time.Time
+
+	mu     sync.Mutex
+	agents map[string]*agent
+}
+
+// NewRegistry конструктор для Registry.
+func NewRegistry(log *zap.Logger, set *server.Settings, store Store) *Registry {
+	staleIntervals := set.AgentStaleIntervals
+	if staleIntervals <= 0 {
+		staleIntervals = DefaultStaleIntervals
+	}
+
+	return &Registry{
+		log:            log.With(zap.String("package", "agents")),
+		store:          store,
+		staleIntervals: staleIntervals,
+		now:            time.Now,
+		agents:         make(map[string]*agent),
+	}
+}
+
+// Start восстанавливает агентов, у которых в хранилище agent_up равна 1, и запускает периодическую
+// проверку пропавших агентов в отдельной горутине. Восстановленный агент считается увиденным в момент запуска:
+// если он не пришлёт метрики, то станет пропавшим, и agent_up не останется равной 1 после перезапуска сервера.
+// Проверка прекращается вместе с контекстом.
+func (r *Registry) Start(ctx context.Context) {
+	r.restore(ctx)
+
+	go r.loop(ctx)
+}
+
+func (r *Registry) restore(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, queryRepoTimeout)
+	defer cancel()
+
+	metrics, err := r.store.ListMetrics(ctx)
+	if err != nil {
+		r.log.Error("cannot restore agents", zap.Error(err))
+
+		return
+	}
+
+	now := r.now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, m := range metrics {
+		id := m.Labels[LabelAgent]
+		if m.ID != MetricUp || m.MType != model.MetricGauge || m.Value == nil || *m.Value != 1 || id == "" {
+			continue
+		}
+
+		if _, ok := r.agents[id]; ok {
+			continue
+		}
+
+		r.agents[id] = &agent{
+			Agent:    model.Agent{ID: id, Host: m.Labels[model.LabelHost], LastSeen: now},
+			interval: defaultReportInterval,
+		}
+	}
+}
+
+func (r *Registry) loop(ctx context.Context) {
+	t := time.NewTicker(checkInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			r.log.Debug("stop agents checking")
+
+			return
+		case <-t.C:
+			r.check(ctx)
+		}
+	}
+}
+
+// check помечает пропавшими агентов, которые не присылали метрики дольше staleIntervals интервалов отправки.
+func (r *Registry) check(ctx context.Context) {
+	now := r.now()
+	stale := make([]model.Agent, 0)
+
+	r.mu.Lock()
+
+	for _, a := range r.agents {
+		if a.Stale || now.Sub(a.LastSeen) <= time.Duration(r.staleIntervals)*a.interval {
+			continue
+		}
+
+		a.Stale = true
+		stale = append(stale, a.Agent)
+	}
+
+	r.mu.Unlock()
+
+	for _, a := range stale {
+		r.log.Info("agent is stale", zap.String("agent", a.ID), zap.Time("last seen", a.LastSeen))
+		r.setUp(ctx, a.ID, a.Host, 0)
+	}
+}
+
+// Observe отмечает, что от агента пришли metrics метрик. Для нового или вернувшегося агента
+// agent_up становится равной 1.
+func (r *Registry) Observe(ctx context.Context, info Info, metrics int) {
+	interval := info.ReportInterval
+	if interval <= 0 {
+		interval = defaultReportInterval
+	}
+
+	r.mu.Lock()
+
+	a, ok := r.agents[info.ID]
+	if !ok {
+		a = &agent{Agent: model.Agent{ID: info.ID}}
+		r.agents[info.ID] = a
+	}
+
+	up := !ok || a.Stale
+
+	a.Host = info.Host
+	a.Version = info.Version
+	a.Address = info.Address
+	a.ReportInterval = interval.String()
+	a.LastSeen = r.now()
+	a.Metrics += int64(metrics)
+	a.Stale = false
+	a.interval = interval
+
+	r.mu.Unlock()
+
+	if up {
+		r.log.Info("agent is up", zap.String("agent", info.ID), zap.String("host", info.Host))
+		r.setUp(ctx, info.ID, info.Host, 1)
+	}
+}
+
+func (r *Registry) setUp(ctx context.Context, id, host string, value float64) {
+	ctx, cancel := context.WithTimeout(ctx, queryRepoTimeout)
+	defer cancel()
+
+	m := model.Metrics{
+		ID:     MetricUp,
+		MType:  model.MetricGauge,
+		Value:  &value,
+		Labels: map[string]string{LabelAgent: id},
+	}
+
+	if host != "" {
+		m.Labels[model.LabelHost] = host
+	}
+
+	if _, err := r.store.UpdateMetric(ctx, m); err != nil {
+		r.log.Error("cannot update agent_up", zap.String("agent", id), zap.Error(err))
+	}
+}
+
+// List возвращает копию сведений обо всех агентах, упорядоченных по ID.
+func (r *Registry) List() []model.Agent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	res := make([]model.Agent, 0, len(r.agents))
+	for _, a := range r.agents {
+		res = append(res, a.Agent)
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].ID < res[j].ID
+	})
+
+	return res
+}
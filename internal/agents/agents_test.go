@@ -0,0 +1,161 @@
+package agents
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vorotislav/alert-service/internal/model"
+	"github.com/vorotislav/alert-service/internal/settings/server"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// fakeStore запоминает последнее значение agent_up для каждой серии.
+type fakeStore struct {
+	mu      sync.Mutex
+	metrics map[string]model.Metrics
+}
+
+func newFakeStore(metrics ...model.Metrics) *fakeStore {
+	s := &fakeStore{metrics: make(map[string]model.Metrics)}
+	for _, m := range metrics {
+		s.metrics[m.SeriesKey()] = m
+	}
+
+	return s
+}
+
+func (s *fakeStore) UpdateMetric(_ context.Context, m model.Metrics) (model.Metrics, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.metrics[m.SeriesKey()] = m
+
+	return m, nil
+}
+
+func (s *fakeStore) ListMetrics(_ context.Context) ([]model.Metrics, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res := make([]model.Metrics, 0, len(s.metrics))
+	for _, m := range s.metrics {
+		res = append(res, m)
+	}
+
+	return res, nil
+}
+
+func (s *fakeStore) up(id, host string) float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, ok := s.metrics[model.SeriesKey(MetricUp, map[string]string{LabelAgent: id, model.LabelHost: host})]
+	if !ok || m.Value == nil {
+		return -1
+	}
+
+	return *m.Value
+}
+
+func TestRegistry_Stale(t *testing.T) {
+	t.Parallel()
+
+	store := newFakeStore()
+	r := NewRegistry(zap.NewNop(), &server.Settings{AgentStaleIntervals: 2}, store)
+
+	now := time.Date(2023, 11, 1, 12, 0, 0, 0, time.UTC)
+	r.now = func() time.Time { return now }
+
+	info := Info{ID: "a1", Host: "web-1", Version: "v1.0.0", Address: "10.0.0.1", ReportInterval: 10 * time.Second}
+
+	r.Observe(context.Background(), info, 5)
+	r.Observe(context.Background(), info, 3)
+
+	list := r.List()
+	require.Len(t, list, 1)
+	assert.Equal(t, model.Agent{
+		ID:             "a1",
+		Host:           "web-1",
+		Version:        "v1.0.0",
+		Address:        "10.0.0.1",
+		ReportInterval: "10s",
+		LastSeen:       now,
+		Metrics:        8,
+	}, list[0])
+	assert.Equal(t, float64(1), store.up("a1", "web-1"))
+
+	// Два пропущенных интервала ещё допустимы.
+	now = now.Add(20 * time.Second)
+	r.check(context.Background())
+	assert.False(t, r.List()[0].Stale)
+
+	now = now.Add(time.Second)
+	r.check(context.Background())
+	assert.True(t, r.List()[0].Stale)
+	assert.Equal(t, float64(0), store.up("a1", "web-1"))
+
+	r.Observe(context.Background(), info, 1)
+	assert.False(t, r.List()[0].Stale)
+	assert.Equal(t, float64(1), store.up("a1", "web-1"))
+}
+
+func TestRegistry_Restore(t *testing.T) {
+	t.Parallel()
+
+	up, down := 1.0, 0.0
+	store := newFakeStore(
+		model.Metrics{ID: MetricUp, MType: model.MetricGauge, Value: &up,
+			Labels: map[string]string{LabelAgent: "a1", model.LabelHost: "web-1"}},
+		model.Metrics{ID: MetricUp, MType: model.MetricGauge, Value: &down,
+			Labels: map[string]string{LabelAgent: "a2", model.LabelHost: "web-2"}},
+	)
+
+	r := NewRegistry(zap.NewNop(), &server.Settings{}, store)
+
+	now := time.Date(2023, 11, 1, 12, 0, 0, 0, time.UTC)
+	r.now = func() time.Time { return now }
+
+	r.restore(context.Background())
+
+	list := r.List()
+	require.Len(t, list, 1)
+	assert.Equal(t, "a1", list[0].ID)
+	assert.Equal(t, "web-1", list[0].Host)
+
+	// Агент не вернулся после перезапуска сервера.
+	now = now.Add(DefaultStaleIntervals*defaultReportInterval + time.Second)
+	r.check(context.Background())
+	assert.Equal(t, float64(0), store.up("a1", "web-1"))
+}
+
+func TestFromRequest(t *testing.T) {
+	t.Parallel()
+
+	req := httptest.NewRequest(http.MethodPost, "/updates/", http.NoBody)
+	req.RemoteAddr = "10.0.0.1:51234"
+
+	_, ok := FromRequest(req)
+	assert.False(t, ok)
+
+	req.Header.Set(model.HeaderAgentID, "a1")
+	req.Header.Set(model.HeaderAgentHost, "web-1")
+	req.Header.Set(model.HeaderAgentVersion, "v1.0.0")
+	req.Header.Set(model.HeaderAgentReportInterval, "5")
+
+	info, ok := FromRequest(req)
+	require.True(t, ok)
+	assert.Equal(t, Info{
+		ID:             "a1",
+		Host:           "web-1",
+		Version:        "v1.0.0",
+		Address:        "10.0.0.1",
+		ReportInterval: 5 * time.Second,
+	}, info)
+}
@@ -0,0 +1,298 @@
+// Пакет alerts представляет движок правил алертинга: периодически сравнивает значения метрик с порогами
+// и ведёт состояние каждого правила (inactive, pending, firing, resolved).
+package alerts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/vorotislav/alert-service/internal/model"
+	"github.com/vorotislav/alert-service/internal/settings/server"
+
+	"go.uber.org/zap"
+)
+
+// Ошибки, возможные при разборе правил.
+var (
+	ErrInvalidRule = errors.New("invalid alert rule")
+)
+
+// Операторы сравнения значения метрики с порогом.
+const (
+	OpGreater      = ">"
+	OpGreaterEqual = ">="
+	OpLess         = "<"
+	OpLessEqual    = "<="
+	OpEqual        = "=="
+	OpNotEqual     = "!="
+)
+
+const (
+	queryRepoTimeout = time.Second * 2
+)
+
+// Source интерфейс хранилища, из которого берутся значения метрик для проверки правил.
+type Source interface {
+	GetCounterValue(ctx context.Context, name string, labels map[string]string) (int64, error)
+	GetGaugeValue(ctx context.Context, name string, labels map[string]string) (float64, error)
+}
+
+// Notifier интерфейс для отправки уведомлений об изменении состояния алерта.
+type Notifier interface {
+	Notify(prevState string, alert model.Alert)
+}
+
+type rule struct {
+	name      string
+	metric    string
+	labels    map[string]string
+	mtype     string
+	op        string
+	threshold float64
+	forRaw    string
+	duration  time.Duration
+}
+
+// Engine движок правил. Хранит правила, их текущее состояние и источник значений метрик.
+type Engine struct {
+	log      *zap.Logger
+	source   Source
+	notifier Notifier
+	interval time.Duration
+	now      func() time.Time
+
+	rules []rule
+
+	mu     sync.RWMutex
+	alerts []model.Alert
+}
+
+// NewEngine конструктор для Engine. Возвращает ошибку, если хотя бы одно правило из настроек некорректно.
+// Notifier может быть nil, тогда изменения состояния только логируются.
+func NewEngine(log *zap.Logger, set *server.Settings, source Source, notifier Notifier) (*Engine, error) {
+	rules := make([]rule, 0, len(set.AlertRules))
+	alerts := make([]model.Alert, 0, len(set.AlertRules))
+
+	for i, ar := range set.AlertRules {
+		r, err := parseRule(ar)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i, err)
+		}
+
+		rules = append(rules, r)
+		alerts = append(alerts, model.Alert{
+			Rule:      r.name,
+			Metric:    r.metric,
+			Labels:    r.labels,
+			MType:     r.mtype,
+			Op:        r.op,
+			Threshold: r.threshold,
+			For:       r.forRaw,
+			State:     model.AlertInactive,
+		})
+	}
+
+	return &Engine{
+		log:      log.With(zap.String("package", "alerts")),
+		source:   source,
+		notifier: notifier,
+		interval: time.Duration(set.AlertsInterval) * time.Second,
+		now:      time.Now,
+		rules:    rules,
+		alerts:   alerts,
+	}, nil
+}
+
+func parseRule(ar server.AlertRule) (rule, error) {
+	r := rule{
+		name:      ar.Name,
+		metric:    ar.Metric,
+		labels:    ar.Labels,
+		mtype:     ar.Type,
+		op:        ar.Op,
+		threshold: ar.Threshold,
+		forRaw:    ar.For,
+	}
+
+	if r.metric == "" {
+		return rule{}, fmt.Errorf("%w: empty metric", ErrInvalidRule)
+	}
+
+	if r.name == "" {
+		r.name = r.metric
+	}
+
+	if r.mtype != model.MetricGauge && r.mtype != model.MetricCounter {
+		return rule{}, fmt.Errorf("%w: unknown metric type %q", ErrInvalidRule, r.mtype)
+	}
+
+	switch r.op {
+	case OpGreater, OpGreaterEqual, OpLess, OpLessEqual, OpEqual, OpNotEqual:
+	default:
+		return rule{}, fmt.Errorf("%w: unknown operator %q", ErrInvalidRule, r.op)
+	}
+
+	if r.forRaw != "" {
+		d, err := time.ParseDuration(r.forRaw)
+		if err != nil || d < 0 {
+			return rule{}, fmt.Errorf("%w: bad for duration %q", ErrInvalidRule, r.forRaw)
+		}
+
+		r.duration = d
+	}
+
+	return r, nil
+}
+
+// Start запускает периодическую проверку правил в отдельной горутине. Проверка прекращается вместе с контекстом.
+func (e *Engine) Start(ctx context.Context) {
+	if len(e.rules) == 0 || e.interval <= 0 {
+		e.log.Debug("alert rules are not configured")
+
+		return
+	}
+
+	go e.loop(ctx)
+}
+
+func (e *Engine) loop(ctx context.Context) {
+	t := time.NewTicker(e.interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			e.log.Debug("stop alerts evaluating")
+
+			return
+		case <-t.C:
+			e.evaluate(ctx)
+		}
+	}
+}
+
+// Alerts возвращает копию текущего состояния всех правил.
+func (e *Engine) Alerts() []model.Alert {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	alerts := make([]model.Alert, len(e.alerts))
+	copy(alerts, e.alerts)
+
+	return alerts
+}
+
+func (e *Engine) evaluate(ctx context.Context) {
+	for i, r := range e.rules {
+		value, err := e.value(ctx, r)
+		now := e.now()
+
+		e.mu.Lock()
+		a := e.alerts[i]
+		a.EvaluateAt = &now
+
+		if err != nil {
+			a.Error = err.Error()
+		} else {
+			a.Error = ""
+			a.Value = &value
+
+			transition(&a, r, compare(r.op, value, r.threshold), now)
+		}
+
+		prev := e.alerts[i].State
+		e.alerts[i] = a
+		e.mu.Unlock()
+
+		if prev != a.State {
+			e.log.Info("alert state changed",
+				zap.String("rule", a.Rule),
+				zap.String("from", prev),
+				zap.String("to", a.State),
+				zap.Float64("value", value))
+
+			if e.notifier != nil {
+				e.notifier.Notify(prev, a)
+			}
+		}
+	}
+}
+
+func (e *Engine) value(ctx context.Context, r rule) (float64, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryRepoTimeout)
+	defer cancel()
+
+	if r.mtype == model.MetricCounter {
+		delta, err := e.source.GetCounterValue(ctx, r.metric, r.labels)
+		if err != nil {
+			return 0, fmt.Errorf("get counter %s: %w", r.metric, err)
+		}
+
+		return float64(delta), nil
+	}
+
+	value, err := e.source.GetGaugeValue(ctx, r.metric, r.labels)
+	if err != nil {
+		return 0, fmt.Errorf("get gauge %s: %w", r.metric, err)
+	}
+
+	return value, nil
+}
+
+func transition(a *model.Alert, r rule, active bool, now time.Time) {
+	switch a.State {
+	case model.AlertInactive, model.AlertResolved:
+		if !active {
+			return
+		}
+
+		a.State = model.AlertPending
+		a.ActiveAt = &now
+		a.FiredAt = nil
+		a.ResolvedAt = nil
+
+		if r.duration == 0 {
+			a.State = model.AlertFiring
+			a.FiredAt = &now
+		}
+	case model.AlertPending:
+		if !active {
+			a.State = model.AlertInactive
+			a.ActiveAt = nil
+
+			return
+		}
+
+		if now.Sub(*a.ActiveAt) >= r.duration {
+			a.State = model.AlertFiring
+			a.FiredAt = &now
+		}
+	case model.AlertFiring:
+		if !active {
+			a.State = model.AlertResolved
+			a.ResolvedAt = &now
+		}
+	}
+}
+
+func compare(op string, value, threshold float64) bool {
+	switch op {
+	case OpGreater:
+		return value > threshold
+	case OpGreaterEqual:
+		return value >= threshold
+	case OpLess:
+		return value < threshold
+	case OpLessEqual:
+		return value <= threshold
+	case OpEqual:
+		return value == threshold
+	case OpNotEqual:
+		return value != threshold
+	}
+
+	return false
+}
@@ -0,0 +1,178 @@
+package alerts
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/vorotislav/alert-service/internal/model"
+	"github.com/vorotislav/alert-service/internal/settings/server"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+var errNotFound = errors.New("not found")
+
+type fakeSource struct {
+	gauges   map[string]float64
+	counters map[string]int64
+}
+
+func (f *fakeSource) GetCounterValue(_ context.Context, name string, _ map[string]string) (int64, error) {
+	v, ok := f.counters[name]
+	if !ok {
+		return 0, errNotFound
+	}
+
+	return v, nil
+}
+
+func (f *fakeSource) GetGaugeValue(_ context.Context, name string, _ map[string]string) (float64, error) {
+	v, ok := f.gauges[name]
+	if !ok {
+		return 0, errNotFound
+	}
+
+	return v, nil
+}
+
+type fakeNotifier struct {
+	changes []string
+}
+
+func (f *fakeNotifier) Notify(prevState string, alert model.Alert) {
+	f.changes = append(f.changes, alert.Rule+":"+prevState+"->"+alert.State)
+}
+
+func TestNewEngine(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		rule    server.AlertRule
+		wantErr bool
+	}{
+		{
+			name: "success",
+			rule: server.AlertRule{Metric: "HeapAlloc", Type: model.MetricGauge, Op: OpGreater, For: "1m"},
+		},
+		{
+			name:    "empty metric",
+			rule:    server.AlertRule{Type: model.MetricGauge, Op: OpGreater},
+			wantErr: true,
+		},
+		{
+			name:    "unknown type",
+			rule:    server.AlertRule{Metric: "HeapAlloc", Type: "histogram", Op: OpGreater},
+			wantErr: true,
+		},
+		{
+			name:    "unknown operator",
+			rule:    server.AlertRule{Metric: "HeapAlloc", Type: model.MetricGauge, Op: "=>"},
+			wantErr: true,
+		},
+		{
+			name:    "bad for",
+			rule:    server.AlertRule{Metric: "HeapAlloc", Type: model.MetricGauge, Op: OpLess, For: "minute"},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			e, err := NewEngine(zap.NewNop(), &server.Settings{AlertRules: []server.AlertRule{tc.rule}}, &fakeSource{}, nil)
+			if tc.wantErr {
+				require.ErrorIs(t, err, ErrInvalidRule)
+
+				return
+			}
+
+			require.NoError(t, err)
+			require.Len(t, e.Alerts(), 1)
+			assert.Equal(t, model.AlertInactive, e.Alerts()[0].State)
+			assert.Equal(t, "HeapAlloc", e.Alerts()[0].Rule)
+		})
+	}
+}
+
+func TestEngine_Evaluate(t *testing.T) {
+	t.Parallel()
+
+	src := &fakeSource{
+		gauges:   map[string]float64{"HeapAlloc": 10},
+		counters: map[string]int64{"PollCount": 1},
+	}
+
+	n := &fakeNotifier{}
+
+	e, err := NewEngine(zap.NewNop(), &server.Settings{
+		AlertsInterval: 1,
+		AlertRules: []server.AlertRule{
+			{Name: "heap", Metric: "HeapAlloc", Type: model.MetricGauge, Op: OpGreater, Threshold: 100, For: "1m"},
+			{Name: "polls", Metric: "PollCount", Type: model.MetricCounter, Op: OpGreaterEqual, Threshold: 5},
+		},
+	}, src, n)
+	require.NoError(t, err)
+
+	now := time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+	e.now = func() time.Time { return now }
+
+	states := func() []string {
+		alerts := e.Alerts()
+
+		return []string{alerts[0].State, alerts[1].State}
+	}
+
+	e.evaluate(context.Background())
+	assert.Equal(t, []string{model.AlertInactive, model.AlertInactive}, states())
+
+	src.gauges["HeapAlloc"] = 200
+	src.counters["PollCount"] = 5
+	e.evaluate(context.Background())
+	assert.Equal(t, []string{model.AlertPending, model.AlertFiring}, states())
+
+	now = now.Add(30 * time.Second)
+	e.evaluate(context.Background())
+	assert.Equal(t, model.AlertPending, states()[0])
+
+	now = now.Add(30 * time.Second)
+	e.evaluate(context.Background())
+	assert.Equal(t, model.AlertFiring, states()[0])
+	require.NotNil(t, e.Alerts()[0].FiredAt)
+	assert.Equal(t, now, *e.Alerts()[0].FiredAt)
+
+	src.gauges["HeapAlloc"] = 1
+	src.counters["PollCount"] = 0
+	e.evaluate(context.Background())
+	assert.Equal(t, []string{model.AlertResolved, model.AlertResolved}, states())
+
+	delete(src.gauges, "HeapAlloc")
+	e.evaluate(context.Background())
+	assert.Equal(t, model.AlertResolved, states()[0])
+	assert.NotEmpty(t, e.Alerts()[0].Error)
+
+	src.gauges["HeapAlloc"] = 200
+	e.evaluate(context.Background())
+	assert.Equal(t, model.AlertPending, states()[0])
+	assert.Empty(t, e.Alerts()[0].Error)
+
+	src.gauges["HeapAlloc"] = 1
+	e.evaluate(context.Background())
+	assert.Equal(t, model.AlertInactive, states()[0])
+
+	assert.Equal(t, []string{
+		"heap:inactive->pending",
+		"polls:inactive->firing",
+		"heap:pending->firing",
+		"heap:firing->resolved",
+		"polls:firing->resolved",
+		"heap:resolved->pending",
+		"heap:pending->inactive",
+	}, n.changes)
+}
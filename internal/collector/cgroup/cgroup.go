@@ -0,0 +1,189 @@
+// Пакет cgroup представляет коллектор ресурсов контейнера по файлам cgroup v1 и v2:
+// память, процессор с троттлингом и количество процессов. По умолчанию читается cgroup самого агента.
+//
+// Имена метрик:
+//   - CgroupMemoryUsage, CgroupMemoryLimit - потребление и ограничение памяти в байтах;
+//   - CgroupMemoryUsedPercent - потребление памяти в процентах от ограничения;
+//   - CgroupCPUUsage - счётчик процессорного времени в микросекундах;
+//   - CgroupCPUPercent - загрузка процессора с предыдущего опроса в процентах одного ядра;
+//   - CgroupCPULimit - квота процессора в ядрах;
+//   - CgroupCPUThrottledPeriods, CgroupCPUThrottled - счётчики периодов с троттлингом
+//     и времени троттлинга в микросекундах;
+//   - CgroupPids, CgroupPidsLimit - количество процессов и ограничение на него.
+//
+// Метрики ограничений отправляются, только если ограничение задано.
+package cgroup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/vorotislav/alert-service/internal/collector"
+	"github.com/vorotislav/alert-service/internal/model"
+
+	"go.uber.org/zap"
+)
+
+// Name имя коллектора в настройках.
+const Name = "cgroup"
+
+// Собираемые метрики.
+const (
+	MetricMemoryUsage         = "CgroupMemoryUsage"
+	MetricMemoryLimit         = "CgroupMemoryLimit"
+	MetricMemoryUsedPercent   = "CgroupMemoryUsedPercent"
+	MetricCPUUsage            = "CgroupCPUUsage"
+	MetricCPUPercent          = "CgroupCPUPercent"
+	MetricCPULimit            = "CgroupCPULimit"
+	MetricCPUThrottledPeriods = "CgroupCPUThrottledPeriods"
+	MetricCPUThrottled        = "CgroupCPUThrottled"
+	MetricPids                = "CgroupPids"
+	MetricPidsLimit           = "CgroupPidsLimit"
+)
+
+const percent = 100
+
+// Config настройки коллектора. Root - точка монтирования иерархии cgroup, ProcFile - файл,
+// по которому определяется cgroup агента. Если задан Path, читается cgroup с этим путём
+// относительно Root, а ProcFile не используется.
+type Config struct {
+	Root     string `json:"root"`
+	Path     string `json:"path"`
+	ProcFile string `json:"proc_file"`
+}
+
+// Collector коллектор ресурсов cgroup.
+type Collector struct {
+	log    *zap.Logger
+	group  *Group
+	deltas *collector.DeltaTracker
+	now    func() time.Time
+}
+
+// New фабрика коллектора. Возвращает ErrNotFound, если cgroup не найдена.
+func New(log *zap.Logger, raw json.RawMessage) (collector.Collector, error) {
+	cfg := Config{
+		Root:     DefaultRoot,
+		ProcFile: DefaultProcFile,
+	}
+
+	if err := collector.Decode(raw, &cfg); err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	var (
+		g   *Group
+		err error
+	)
+
+	if cfg.Path != "" {
+		g, err = Open(cfg.Root, cfg.Path)
+	} else {
+		g, err = Detect(cfg.Root, cfg.ProcFile)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	log.Debug("cgroup detected", zap.String("package", Name), zap.Int("version", g.Version()))
+
+	return &Collector{
+		log:    log,
+		group:  g,
+		deltas: collector.NewDeltaTracker(),
+		now:    time.Now,
+	}, nil
+}
+
+// Name возвращает имя коллектора.
+func (c *Collector) Name() string {
+	return Name
+}
+
+// Collect читает файлы cgroup. Если какой-то контроллер недоступен, метрики остальных всё равно возвращаются.
+// Отсутствие файлов контроллера (контроллер не включён для cgroup, а в корневой cgroup нет части файлов)
+// ошибкой не считается.
+func (c *Collector) Collect(_ context.Context) ([]model.Metrics, error) {
+	metrics := make([]model.Metrics, 0)
+	errs := make([]error, 0)
+
+	if mem, err := c.group.Memory(); err != nil {
+		errs = appendErr(errs, "memory", err)
+	} else {
+		metrics = append(metrics, collector.Gauge(MetricMemoryUsage, float64(mem.Usage)))
+
+		if mem.Limit > 0 {
+			metrics = append(metrics,
+				collector.Gauge(MetricMemoryLimit, float64(mem.Limit)),
+				collector.Gauge(MetricMemoryUsedPercent, float64(mem.Usage)/float64(mem.Limit)*percent),
+			)
+		}
+	}
+
+	if cpu, err := c.group.CPU(); err != nil {
+		errs = appendErr(errs, "cpu", err)
+	} else {
+		metrics = append(metrics, c.cpuMetrics(cpu)...)
+	}
+
+	if pids, err := c.group.Pids(); err != nil {
+		errs = appendErr(errs, "pids", err)
+	} else {
+		metrics = append(metrics, collector.Gauge(MetricPids, float64(pids.Current)))
+
+		if pids.Limit > 0 {
+			metrics = append(metrics, collector.Gauge(MetricPidsLimit, float64(pids.Limit)))
+		}
+	}
+
+	return metrics, errors.Join(errs...)
+}
+
+func appendErr(errs []error, controller string, err error) []error {
+	if errors.Is(err, os.ErrNotExist) || errors.Is(err, ErrNotFound) {
+		return errs
+	}
+
+	return append(errs, fmt.Errorf("%s: %w", controller, err))
+}
+
+func (c *Collector) cpuMetrics(cpu CPU) []model.Metrics {
+	now := c.now()
+	metrics := make([]model.Metrics, 0)
+
+	if cpu.Quota > 0 {
+		metrics = append(metrics, collector.Gauge(MetricCPULimit, cpu.Quota))
+	}
+
+	usage := uint64(cpu.Usage.Microseconds())
+
+	if delta, elapsed, ok := c.deltas.Delta(MetricCPUUsage, usage, now); ok {
+		metrics = append(metrics, collector.Counter(MetricCPUUsage, int64(delta)))
+
+		if elapsed > 0 {
+			metrics = append(metrics, collector.Gauge(MetricCPUPercent,
+				float64(delta)/float64(elapsed.Microseconds())*percent))
+		}
+	}
+
+	counters := []struct {
+		id    string
+		value uint64
+	}{
+		{id: MetricCPUThrottledPeriods, value: cpu.ThrottledPeriods},
+		{id: MetricCPUThrottled, value: uint64(cpu.Throttled.Microseconds())},
+	}
+
+	for _, cnt := range counters {
+		if delta, _, ok := c.deltas.Delta(cnt.id, cnt.value, now); ok {
+			metrics = append(metrics, collector.Counter(cnt.id, int64(delta)))
+		}
+	}
+
+	return metrics
+}
@@ -0,0 +1,161 @@
+package cgroup
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestDetect(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		root    string
+		version int
+		memory  Memory
+		cpu     CPU
+		pids    Pids
+	}{
+		{
+			name:    "v1",
+			root:    filepath.Join("testdata", "v1"),
+			version: Version1,
+			memory:  Memory{Usage: 52428800},
+			cpu: CPU{
+				Usage:            2 * time.Second,
+				ThrottledPeriods: 3,
+				Throttled:        150 * time.Millisecond,
+			},
+			pids: Pids{Current: 5, Limit: 100},
+		},
+		{
+			name:    "v2",
+			root:    filepath.Join("testdata", "v2"),
+			version: Version2,
+			memory:  Memory{Usage: 104857600, Limit: 268435456},
+			cpu: CPU{
+				Usage:            5 * time.Second,
+				ThrottledPeriods: 7,
+				Throttled:        350 * time.Millisecond,
+				Quota:            0.5,
+			},
+			pids: Pids{Current: 12},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			g, err := Detect(tc.root, filepath.Join(tc.root, "proc_self_cgroup"))
+			require.NoError(t, err)
+			assert.Equal(t, tc.version, g.Version())
+
+			mem, err := g.Memory()
+			require.NoError(t, err)
+			assert.Equal(t, tc.memory, mem)
+
+			cpu, err := g.CPU()
+			require.NoError(t, err)
+			assert.Equal(t, tc.cpu, cpu)
+
+			pids, err := g.Pids()
+			require.NoError(t, err)
+			assert.Equal(t, tc.pids, pids)
+		})
+	}
+}
+
+func TestDetect_NotFound(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	proc := filepath.Join(dir, "cgroup")
+	require.NoError(t, os.WriteFile(proc, []byte("1:name=systemd:/\n"), 0o600))
+
+	_, err := Detect(dir, proc)
+	require.ErrorIs(t, err, ErrNotFound)
+
+	_, err = Detect(dir, filepath.Join(dir, "missing"))
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestCollector_Collect(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	dir := filepath.Join(root, "agent")
+	require.NoError(t, os.Mkdir(dir, 0o755))
+
+	write := func(name, data string) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(data), 0o600))
+	}
+
+	write("../cgroup.controllers", "cpu memory pids\n")
+	write("memory.current", "256\n")
+	write("memory.max", "1024\n")
+	write("cpu.max", "max 100000\n")
+	write("cpu.stat", "usage_usec 1000000\nnr_throttled 1\nthrottled_usec 100\n")
+	write("pids.current", "3\n")
+	write("pids.max", "max\n")
+
+	cfg, err := json.Marshal(Config{Root: root, Path: "agent"})
+	require.NoError(t, err)
+
+	c, err := New(zap.NewNop(), cfg)
+	require.NoError(t, err)
+
+	cc := c.(*Collector) //nolint:forcetypeassert
+
+	start := time.Now()
+	cc.now = func() time.Time { return start }
+
+	first := collect(t, cc)
+	assert.Equal(t, map[string]float64{
+		MetricMemoryUsage:       256,
+		MetricMemoryLimit:       1024,
+		MetricMemoryUsedPercent: 25,
+		MetricPids:              3,
+	}, first)
+
+	write("cpu.stat", "usage_usec 1500000\nnr_throttled 4\nthrottled_usec 400\n")
+	cc.now = func() time.Time { return start.Add(time.Second) }
+
+	second := collect(t, cc)
+	assert.Equal(t, float64(500000), second[MetricCPUUsage])
+	assert.InDelta(t, 50, second[MetricCPUPercent], 0.001)
+	assert.Equal(t, float64(3), second[MetricCPUThrottledPeriods])
+	assert.Equal(t, float64(300), second[MetricCPUThrottled])
+	assert.NotContains(t, second, MetricCPULimit)
+	assert.NotContains(t, second, MetricPidsLimit)
+}
+
+func collect(t *testing.T, c *Collector) map[string]float64 {
+	t.Helper()
+
+	metrics, err := c.Collect(context.Background())
+	require.NoError(t, err)
+
+	got := make(map[string]float64, len(metrics))
+
+	for _, m := range metrics {
+		switch {
+		case m.Value != nil:
+			got[m.ID] = *m.Value
+		case m.Delta != nil:
+			got[m.ID] = float64(*m.Delta)
+		}
+	}
+
+	return got
+}
@@ -0,0 +1,404 @@
+package cgroup
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Пути по умолчанию.
+const (
+	DefaultRoot     = "/sys/fs/cgroup"
+	DefaultProcFile = "/proc/self/cgroup"
+)
+
+// Версии иерархии cgroup.
+const (
+	Version1 = 1
+	Version2 = 2
+)
+
+// Контроллеры, которые читает коллектор.
+const (
+	controllerMemory  = "memory"
+	controllerCPU     = "cpu"
+	controllerCPUAcct = "cpuacct"
+	controllerPids    = "pids"
+)
+
+// unlimitedV1 порог, начиная с которого ограничение cgroup v1 считается отсутствующим:
+// ядро записывает в такие файлы значение, близкое к максимальному int64, округлённое до страницы.
+const unlimitedV1 = math.MaxInt64 / 2
+
+const unlimitedV2 = "max"
+
+// ErrNotFound возвращается, если cgroup процесса не найдена.
+var ErrNotFound = errors.New("cgroup not found")
+
+// Group cgroup, из файлов которой читаются метрики. Для cgroup v2 все контроллеры находятся
+// в одном каталоге, для v1 у каждого контроллера свой каталог.
+type Group struct {
+	version int
+	dirs    map[string]string
+}
+
+// Memory потребление памяти. Limit равен 0, если память не ограничена.
+type Memory struct {
+	Usage uint64
+	Limit uint64
+}
+
+// CPU потребление процессора. Usage и Throttled - накопленное время с создания cgroup,
+// Quota - ограничение в ядрах (0, если ограничения нет).
+type CPU struct {
+	Usage            time.Duration
+	ThrottledPeriods uint64
+	Throttled        time.Duration
+	Quota            float64
+}
+
+// Pids количество процессов. Limit равен 0, если количество не ограничено.
+type Pids struct {
+	Current uint64
+	Limit   uint64
+}
+
+// Detect находит cgroup текущего процесса по файлу procFile (обычно /proc/self/cgroup)
+// в иерархии, смонтированной в root. Если каталога cgroup из procFile нет (так бывает внутри
+// контейнера, где смонтирована только своя часть иерархии), используется корень иерархии.
+func Detect(root, procFile string) (*Group, error) {
+	f, err := os.Open(procFile)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrNotFound, err)
+	}
+
+	defer f.Close()
+
+	unified := isUnified(root)
+	g := &Group{dirs: make(map[string]string)}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// Формат строки: hierarchy-ID:controller-list:cgroup-path.
+		parts := strings.SplitN(scanner.Text(), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+
+		if unified {
+			if parts[0] == "0" && parts[1] == "" {
+				return openV2(root, parts[2]), nil
+			}
+
+			continue
+		}
+
+		if parts[1] == "" {
+			continue
+		}
+
+		controllers := strings.Split(parts[1], ",")
+
+		for _, c := range controllers {
+			if dir, ok := findV1(root, parts[1], c, parts[2]); ok {
+				g.dirs[c] = dir
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read %s: %w", procFile, err)
+	}
+
+	if unified || len(g.dirs) == 0 {
+		return nil, ErrNotFound
+	}
+
+	g.version = Version1
+
+	return g, nil
+}
+
+// Open открывает cgroup по пути path относительно корня иерархии root. Версия определяется
+// по наличию файла cgroup.controllers в корне.
+func Open(root, path string) (*Group, error) {
+	if isUnified(root) {
+		dir := filepath.Join(root, path)
+		if !isDir(dir) {
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, dir)
+		}
+
+		return &Group{version: Version2, dirs: map[string]string{"": dir}}, nil
+	}
+
+	g := &Group{version: Version1, dirs: make(map[string]string)}
+
+	for _, c := range []string{controllerMemory, controllerCPU, controllerCPUAcct, controllerPids} {
+		if dir := filepath.Join(root, c, path); isDir(dir) {
+			g.dirs[c] = dir
+		}
+	}
+
+	if len(g.dirs) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, filepath.Join(root, path))
+	}
+
+	return g, nil
+}
+
+func openV2(root, path string) *Group {
+	dir := filepath.Join(root, path)
+	if !isDir(dir) {
+		dir = root
+	}
+
+	return &Group{version: Version2, dirs: map[string]string{"": dir}}
+}
+
+// findV1 ищет каталог контроллера cgroup v1. Совмещённые контроллеры (cpu,cpuacct) монтируются
+// в каталог с полным списком, а отдельные имена обычно являются ссылками на него.
+func findV1(root, mount, controller, path string) (string, bool) {
+	candidates := []string{
+		filepath.Join(root, mount, path),
+		filepath.Join(root, controller, path),
+		filepath.Join(root, mount),
+		filepath.Join(root, controller),
+	}
+
+	for _, dir := range candidates {
+		if isDir(dir) {
+			return dir, true
+		}
+	}
+
+	return "", false
+}
+
+func isUnified(root string) bool {
+	_, err := os.Stat(filepath.Join(root, "cgroup.controllers"))
+
+	return err == nil
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+
+	return err == nil && info.IsDir()
+}
+
+// Version возвращает версию иерархии cgroup.
+func (g *Group) Version() int {
+	return g.version
+}
+
+// Memory возвращает потребление и ограничение памяти.
+func (g *Group) Memory() (Memory, error) {
+	if g.version == Version2 {
+		usage, err := g.readUint(controllerMemory, "memory.current")
+		if err != nil {
+			return Memory{}, err
+		}
+
+		limit, err := g.readLimit(controllerMemory, "memory.max")
+
+		return Memory{Usage: usage, Limit: limit}, err
+	}
+
+	usage, err := g.readUint(controllerMemory, "memory.usage_in_bytes")
+	if err != nil {
+		return Memory{}, err
+	}
+
+	limit, err := g.readUint(controllerMemory, "memory.limit_in_bytes")
+	if limit >= unlimitedV1 {
+		limit = 0
+	}
+
+	return Memory{Usage: usage, Limit: limit}, err
+}
+
+// CPU возвращает потребление процессора, сведения о троттлинге и квоту.
+func (g *Group) CPU() (CPU, error) {
+	if g.version == Version2 {
+		stat, err := g.readStat(controllerCPU, "cpu.stat")
+		if err != nil {
+			return CPU{}, err
+		}
+
+		quota, err := g.readQuotaV2()
+
+		return CPU{
+			Usage:            time.Duration(stat["usage_usec"]) * time.Microsecond,
+			ThrottledPeriods: stat["nr_throttled"],
+			Throttled:        time.Duration(stat["throttled_usec"]) * time.Microsecond,
+			Quota:            quota,
+		}, err
+	}
+
+	usage, err := g.readUint(controllerCPUAcct, "cpuacct.usage")
+	if err != nil {
+		return CPU{}, err
+	}
+
+	stat, err := g.readStat(controllerCPU, "cpu.stat")
+	if err != nil {
+		return CPU{}, err
+	}
+
+	quota, err := g.readQuotaV1()
+
+	return CPU{
+		Usage:            time.Duration(usage),
+		ThrottledPeriods: stat["nr_throttled"],
+		Throttled:        time.Duration(stat["throttled_time"]),
+		Quota:            quota,
+	}, err
+}
+
+// Pids возвращает количество процессов и ограничение на него.
+func (g *Group) Pids() (Pids, error) {
+	current, err := g.readUint(controllerPids, "pids.current")
+	if err != nil {
+		return Pids{}, err
+	}
+
+	limit, err := g.readLimit(controllerPids, "pids.max")
+
+	return Pids{Current: current, Limit: limit}, err
+}
+
+// readQuotaV2 читает cpu.max в формате "$MAX $PERIOD", где $MAX может быть "max".
+func (g *Group) readQuotaV2() (float64, error) {
+	raw, err := g.read(controllerCPU, "cpu.max")
+	if err != nil {
+		return 0, err
+	}
+
+	fields := strings.Fields(raw)
+	if len(fields) != 2 || fields[0] == unlimitedV2 {
+		return 0, nil
+	}
+
+	return quota(fields[0], fields[1])
+}
+
+func (g *Group) readQuotaV1() (float64, error) {
+	q, err := g.read(controllerCPU, "cpu.cfs_quota_us")
+	if err != nil {
+		return 0, err
+	}
+
+	if strings.HasPrefix(q, "-") {
+		return 0, nil
+	}
+
+	p, err := g.read(controllerCPU, "cpu.cfs_period_us")
+	if err != nil {
+		return 0, err
+	}
+
+	return quota(q, p)
+}
+
+func quota(q, p string) (float64, error) {
+	qv, err := strconv.ParseFloat(q, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parse cpu quota: %w", err)
+	}
+
+	pv, err := strconv.ParseFloat(p, 64)
+	if err != nil || pv == 0 {
+		return 0, fmt.Errorf("parse cpu period %q: %w", p, err)
+	}
+
+	return qv / pv, nil
+}
+
+func (g *Group) path(controller, file string) (string, error) {
+	key := controller
+	if g.version == Version2 {
+		key = ""
+	}
+
+	dir, ok := g.dirs[key]
+	if !ok {
+		return "", fmt.Errorf("%w: no %s controller", ErrNotFound, controller)
+	}
+
+	return filepath.Join(dir, file), nil
+}
+
+func (g *Group) read(controller, file string) (string, error) {
+	path, err := g.path(controller, file)
+	if err != nil {
+		return "", err
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("read %s: %w", file, err)
+	}
+
+	return strings.TrimSpace(string(raw)), nil
+}
+
+func (g *Group) readUint(controller, file string) (uint64, error) {
+	raw, err := g.read(controller, file)
+	if err != nil {
+		return 0, err
+	}
+
+	v, err := strconv.ParseUint(raw, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parse %s: %w", file, err)
+	}
+
+	return v, nil
+}
+
+// readLimit читает ограничение, где "max" означает его отсутствие (возвращается 0).
+func (g *Group) readLimit(controller, file string) (uint64, error) {
+	raw, err := g.read(controller, file)
+	if err != nil || raw == unlimitedV2 {
+		return 0, err
+	}
+
+	v, err := strconv.ParseUint(raw, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parse %s: %w", file, err)
+	}
+
+	return v, nil
+}
+
+// readStat читает файл из строк "ключ значение", например cpu.stat.
+func (g *Group) readStat(controller, file string) (map[string]uint64, error) {
+	raw, err := g.read(controller, file)
+	if err != nil {
+		return nil, err
+	}
+
+	stat := make(map[string]uint64)
+
+	for _, line := range strings.Split(raw, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+
+		v, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		stat[fields[0]] = v
+	}
+
+	return stat, nil
+}
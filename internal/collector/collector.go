@@ -0,0 +1,193 @@
+// Пакет collector описывает источники метрик агента и реестр, из которого они создаются по настройкам.
+// Каждый источник (runtime Go, память, CPU и т.д.) - отдельный пакет со своей фабрикой,
+// которая явно регистрируется в реестре при запуске агента.
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/vorotislav/alert-service/internal/model"
+
+	"go.uber.org/zap"
+)
+
+// Ошибки, возможные при создании коллекторов.
+var (
+	ErrDuplicateCollector = errors.New("collector already registered")
+	ErrUnknownCollector   = errors.New("unknown collector")
+	ErrInvalidConfig      = errors.New("invalid collector config")
+)
+
+// Collector источник метрик. Collect возвращает текущие значения метрик;
+// для счётчиков возвращается приращение с предыдущего вызова Collect.
+type Collector interface {
+	Name() string
+	Collect(ctx context.Context) ([]model.Metrics, error)
+}
+
+// Starter коллектор с фоновой работой: собственным расписанием опроса или приёмом данных извне.
+// Start вызывается один раз при запуске агента, фоновая работа должна завершиться с отменой ctx.
+// Collect такого коллектора возвращает накопленное к моменту вызова.
+type Starter interface {
+	Start(ctx context.Context) error
+}
+
+// Flusher коллектор, который агрегирует данные за интервал отправки метрик на сервер
+// (например, перцентили таймеров). Flush вызывается перед каждой отправкой и возвращает агрегаты
+// за прошедший интервал, после чего коллектор начинает новый.
+type Flusher interface {
+	Flush() []model.Metrics
+}
+
+// Factory создаёт коллектор по его разделу из файла конфигурации. cfg может быть пустым.
+type Factory func(log *zap.Logger, cfg json.RawMessage) (Collector, error)
+
+// Config общие для всех коллекторов настройки. Enabled включает или выключает коллектор,
+// Include и Exclude - регулярные выражения для имён метрик, которые нужно оставить или отбросить.
+type Config struct {
+	Enabled *bool    `json:"enabled"`
+	Include []string `json:"include"`
+	Exclude []string `json:"exclude"`
+}
+
+type registration struct {
+	factory Factory
+	enabled bool
+}
+
+// Registry реестр фабрик коллекторов.
+type Registry struct {
+	factories map[string]registration
+}
+
+// NewRegistry конструктор для Registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		factories: make(map[string]registration),
+	}
+}
+
+// Register добавляет фабрику коллектора. enabled - включён ли коллектор, если в настройках он не упомянут.
+func (r *Registry) Register(name string, factory Factory, enabled bool) error {
+	if _, ok := r.factories[name]; ok {
+		return fmt.Errorf("%w: %s", ErrDuplicateCollector, name)
+	}
+
+	r.factories[name] = registration{
+		factory: factory,
+		enabled: enabled,
+	}
+
+	return nil
+}
+
+// Build создаёт включённые коллекторы по настройкам. Коллектор, который не удалось создать, пропускается,
+// а ошибка добавляется к возвращаемой, поэтому остальные коллекторы продолжают работать.
+func (r *Registry) Build(log *zap.Logger, configs map[string]json.RawMessage) ([]Collector, error) {
+	errs := make([]error, 0)
+
+	for name := range configs {
+		if _, ok := r.factories[name]; !ok {
+			errs = append(errs, fmt.Errorf("%w: %s", ErrUnknownCollector, name))
+		}
+	}
+
+	names := make([]string, 0, len(r.factories))
+	for name := range r.factories {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	collectors := make([]Collector, 0, len(names))
+
+	for _, name := range names {
+		c, err := r.build(log, name, configs[name])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("collector %s: %w", name, err))
+
+			continue
+		}
+
+		if c != nil {
+			collectors = append(collectors, c)
+		}
+	}
+
+	return collectors, errors.Join(errs...)
+}
+
+func (r *Registry) build(log *zap.Logger, name string, raw json.RawMessage) (Collector, error) {
+	reg := r.factories[name]
+
+	cfg := Config{}
+
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &cfg); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+		}
+	}
+
+	enabled := reg.enabled
+	if cfg.Enabled != nil {
+		enabled = *cfg.Enabled
+	}
+
+	if !enabled {
+		return nil, nil //nolint:nilnil
+	}
+
+	c, err := reg.factory(log.With(zap.String("collector", name)), raw)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(cfg.Include) == 0 && len(cfg.Exclude) == 0 {
+		return c, nil
+	}
+
+	filter, err := NewFilter(cfg.Include, cfg.Exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	return &filtered{Collector: c, filter: filter}, nil
+}
+
+// Decode разбирает раздел настроек коллектора в cfg. Пустой раздел оставляет cfg без изменений.
+func Decode(raw json.RawMessage, cfg any) error {
+	if len(raw) == 0 {
+		return nil
+	}
+
+	if err := json.Unmarshal(raw, cfg); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+	}
+
+	return nil
+}
+
+// Gauge создаёт метрику типа gauge.
+func Gauge(name string, value float64) model.Metrics {
+	return model.Metrics{ID: name, MType: model.MetricGauge, Value: &value}
+}
+
+// Counter создаёт метрику типа counter.
+func Counter(name string, delta int64) model.Metrics {
+	return model.Metrics{ID: name, MType: model.MetricCounter, Delta: &delta}
+}
+
+// LabeledGauge создаёт метрику типа gauge с метками экземпляра источника: точки монтирования, устройства,
+// цели проверки и т.п. Имя метрики от экземпляра не зависит. Карта labels не изменяется и может быть общей.
+func LabeledGauge(name string, labels map[string]string, value float64) model.Metrics {
+	return model.Metrics{ID: name, MType: model.MetricGauge, Value: &value, Labels: labels}
+}
+
+// LabeledCounter создаёт метрику типа counter с метками экземпляра источника, см. LabeledGauge.
+func LabeledCounter(name string, labels map[string]string, delta int64) model.Metrics {
+	return model.Metrics{ID: name, MType: model.MetricCounter, Delta: &delta, Labels: labels}
+}
@@ -0,0 +1,179 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/vorotislav/alert-service/internal/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+var errBroken = errors.New("broken")
+
+type staticCollector struct {
+	name    string
+	metrics []model.Metrics
+}
+
+func (c *staticCollector) Name() string {
+	return c.name
+}
+
+func (c *staticCollector) Collect(_ context.Context) ([]model.Metrics, error) {
+	return c.metrics, nil
+}
+
+func staticFactory(name string, metrics ...model.Metrics) Factory {
+	return func(_ *zap.Logger, _ json.RawMessage) (Collector, error) {
+		return &staticCollector{name: name, metrics: metrics}, nil
+	}
+}
+
+func TestRegistry_Build(t *testing.T) {
+	t.Parallel()
+
+	newRegistry := func(t *testing.T) *Registry {
+		t.Helper()
+
+		r := NewRegistry()
+		require.NoError(t, r.Register("a", staticFactory("a", Gauge("HeapAlloc", 1), Gauge("HeapSys", 2)), true))
+		require.NoError(t, r.Register("b", staticFactory("b"), false))
+		require.NoError(t, r.Register("broken", func(_ *zap.Logger, _ json.RawMessage) (Collector, error) {
+			return nil, errBroken
+		}, false))
+
+		return r
+	}
+
+	cases := []struct {
+		name      string
+		configs   map[string]json.RawMessage
+		wantNames []string
+		wantErr   error
+	}{
+		{
+			name:      "defaults",
+			wantNames: []string{"a"},
+		},
+		{
+			name: "enable and disable",
+			configs: map[string]json.RawMessage{
+				"a": json.RawMessage(`{"enabled": false}`),
+				"b": json.RawMessage(`{"enabled": true}`),
+			},
+			wantNames: []string{"b"},
+		},
+		{
+			name: "broken collector does not block others",
+			configs: map[string]json.RawMessage{
+				"broken": json.RawMessage(`{"enabled": true}`),
+			},
+			wantNames: []string{"a"},
+			wantErr:   errBroken,
+		},
+		{
+			name: "unknown collector",
+			configs: map[string]json.RawMessage{
+				"disk": json.RawMessage(`{}`),
+			},
+			wantNames: []string{"a"},
+			wantErr:   ErrUnknownCollector,
+		},
+		{
+			name: "bad filter",
+			configs: map[string]json.RawMessage{
+				"a": json.RawMessage(`{"include": ["("]}`),
+			},
+			wantErr: ErrInvalidConfig,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			collectors, err := newRegistry(t).Build(zap.NewNop(), tc.configs)
+			if tc.wantErr != nil {
+				require.ErrorIs(t, err, tc.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+
+			names := make([]string, 0, len(collectors))
+			for _, c := range collectors {
+				names = append(names, c.Name())
+			}
+
+			assert.ElementsMatch(t, tc.wantNames, names)
+		})
+	}
+
+	r := newRegistry(t)
+	assert.ErrorIs(t, r.Register("a", staticFactory("a"), true), ErrDuplicateCollector)
+}
+
+func TestRegistry_BuildFilter(t *testing.T) {
+	t.Parallel()
+
+	r := NewRegistry()
+	require.NoError(t, r.Register("a", staticFactory("a",
+		Gauge("HeapAlloc", 1), Gauge("HeapSys", 2), Gauge("StackSys", 3)), true))
+
+	collectors, err := r.Build(zap.NewNop(), map[string]json.RawMessage{
+		"a": json.RawMessage(`{"include": ["^Heap"], "exclude": ["Sys$"]}`),
+	})
+	require.NoError(t, err)
+	require.Len(t, collectors, 1)
+
+	metrics, err := collectors[0].Collect(context.Background())
+	require.NoError(t, err)
+	require.Len(t, metrics, 1)
+	assert.Equal(t, "HeapAlloc", metrics[0].ID)
+}
+
+type startingCollector struct {
+	staticCollector
+	started bool
+}
+
+func (c *startingCollector) Start(_ context.Context) error {
+	c.started = true
+
+	return nil
+}
+
+func (c *startingCollector) Flush() []model.Metrics {
+	return []model.Metrics{Gauge("HeapAlloc", 1), Gauge("Queue", 2)}
+}
+
+func TestRegistry_BuildFilterOptional(t *testing.T) {
+	t.Parallel()
+
+	sc := &startingCollector{staticCollector: staticCollector{name: "a"}}
+
+	r := NewRegistry()
+	require.NoError(t, r.Register("a", func(_ *zap.Logger, _ json.RawMessage) (Collector, error) {
+		return sc, nil
+	}, true))
+
+	collectors, err := r.Build(zap.NewNop(), map[string]json.RawMessage{
+		"a": json.RawMessage(`{"exclude": ["^Heap"]}`),
+	})
+	require.NoError(t, err)
+	require.Len(t, collectors, 1)
+
+	s, ok := collectors[0].(Starter)
+	require.True(t, ok)
+	require.NoError(t, s.Start(context.Background()))
+	assert.True(t, sc.started)
+
+	f, ok := collectors[0].(Flusher)
+	require.True(t, ok)
+	assert.Equal(t, []model.Metrics{Gauge("Queue", 2)}, f.Flush())
+}
@@ -0,0 +1,170 @@
+// Пакет cpu представляет коллектор загрузки процессора.
+//
+// Имена метрик:
+//   - CPUutilization<N> - загрузка ядра N (с единицы) в процентах;
+//   - CPUutilizationTotal - загрузка всех ядер в процентах;
+//   - CPUTime<Mode> - доля времени процессора в режиме Mode (User, System, Idle, Nice,
+//     Iowait, Irq, Softirq, Steal) с предыдущего опроса в процентах.
+package cpu
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/vorotislav/alert-service/internal/collector"
+	"github.com/vorotislav/alert-service/internal/model"
+
+	"github.com/shirou/gopsutil/v3/cpu"
+	"go.uber.org/zap"
+)
+
+// Name имя коллектора в настройках.
+const Name = "cpu"
+
+// Собираемые метрики.
+const (
+	// MetricCPUutilizationPrefix префикс загрузки отдельного ядра, за ним следует номер ядра.
+	MetricCPUutilizationPrefix = "CPUutilization"
+	MetricCPUutilization1      = MetricCPUutilizationPrefix + "1"
+	MetricCPUutilizationTotal  = MetricCPUutilizationPrefix + "Total"
+	// MetricCPUTimePrefix префикс доли времени процессора в определённом режиме.
+	MetricCPUTimePrefix = "CPUTime"
+)
+
+const percent = 100
+
+var errNoCPU = errors.New("no cpu statistics")
+
+// Config настройки коллектора. PerCore - собирать загрузку каждого ядра, Times - собирать доли времени по режимам.
+type Config struct {
+	PerCore *bool `json:"per_core"`
+	Times   *bool `json:"times"`
+}
+
+// Collector коллектор загрузки процессора.
+type Collector struct {
+	perCore bool
+	times   bool
+
+	mu   sync.Mutex
+	prev *cpu.TimesStat
+}
+
+// New фабрика коллектора.
+func New(_ *zap.Logger, raw json.RawMessage) (collector.Collector, error) {
+	cfg := Config{}
+
+	if err := collector.Decode(raw, &cfg); err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	return &Collector{
+		perCore: cfg.PerCore == nil || *cfg.PerCore,
+		times:   cfg.Times == nil || *cfg.Times,
+	}, nil
+}
+
+// Name возвращает имя коллектора.
+func (c *Collector) Name() string {
+	return Name
+}
+
+// Collect возвращает загрузку процессора с предыдущего вызова.
+func (c *Collector) Collect(ctx context.Context) ([]model.Metrics, error) {
+	metrics := make([]model.Metrics, 0)
+
+	total, err := cpu.PercentWithContext(ctx, 0, false)
+	if err != nil {
+		return nil, fmt.Errorf("cpu percent: %w", err)
+	}
+
+	if len(total) == 0 {
+		return nil, errNoCPU
+	}
+
+	metrics = append(metrics, collector.Gauge(MetricCPUutilizationTotal, total[0]))
+
+	if c.perCore {
+		cores, err := cpu.PercentWithContext(ctx, 0, true)
+		if err != nil {
+			return metrics, fmt.Errorf("cpu percent per core: %w", err)
+		}
+
+		for i, p := range cores {
+			metrics = append(metrics, collector.Gauge(MetricCPUutilizationPrefix+strconv.Itoa(i+1), p))
+		}
+	}
+
+	if c.times {
+		times, err := cpu.TimesWithContext(ctx, false)
+		if err != nil {
+			return metrics, fmt.Errorf("cpu times: %w", err)
+		}
+
+		if len(times) > 0 {
+			metrics = append(metrics, c.breakdown(times[0])...)
+		}
+	}
+
+	return metrics, nil
+}
+
+// breakdown возвращает доли времени по режимам между текущим и предыдущим замером.
+// При первом вызове предыдущего замера нет, и метрики не возвращаются.
+func (c *Collector) breakdown(cur cpu.TimesStat) []model.Metrics {
+	c.mu.Lock()
+	prev := c.prev
+	c.prev = &cur
+	c.mu.Unlock()
+
+	if prev == nil {
+		return nil
+	}
+
+	return Breakdown(*prev, cur)
+}
+
+// Breakdown вычисляет доли времени процессора по режимам между двумя замерами в процентах.
+// Время guest уже входит в user, поэтому в общий счёт не добавляется.
+func Breakdown(prev, cur cpu.TimesStat) []model.Metrics {
+	modes := []struct {
+		name      string
+		prev, cur float64
+	}{
+		{"User", prev.User, cur.User},
+		{"System", prev.System, cur.System},
+		{"Idle", prev.Idle, cur.Idle},
+		{"Nice", prev.Nice, cur.Nice},
+		{"Iowait", prev.Iowait, cur.Iowait},
+		{"Irq", prev.Irq, cur.Irq},
+		{"Softirq", prev.Softirq, cur.Softirq},
+		{"Steal", prev.Steal, cur.Steal},
+	}
+
+	var total float64
+
+	for _, m := range modes {
+		total += m.cur - m.prev
+	}
+
+	if total <= 0 {
+		return nil
+	}
+
+	metrics := make([]model.Metrics, 0, len(modes))
+
+	for _, m := range modes {
+		delta := m.cur - m.prev
+		if delta < 0 {
+			delta = 0
+		}
+
+		metrics = append(metrics, collector.Gauge(MetricCPUTimePrefix+m.name, delta/total*percent))
+	}
+
+	return metrics
+}
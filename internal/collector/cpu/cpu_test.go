@@ -0,0 +1,33 @@
+package cpu
+
+import (
+	"testing"
+
+	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBreakdown(t *testing.T) {
+	t.Parallel()
+
+	prev := cpu.TimesStat{User: 100, System: 50, Idle: 800, Iowait: 10, Steal: 5, Guest: 20}
+	cur := cpu.TimesStat{User: 160, System: 70, Idle: 910, Iowait: 15, Steal: 10, Guest: 40}
+
+	metrics := Breakdown(prev, cur)
+
+	got := make(map[string]float64, len(metrics))
+	for _, m := range metrics {
+		require.NotNil(t, m.Value)
+		got[m.ID] = *m.Value
+	}
+
+	assert.InDelta(t, 30.0, got["CPUTimeUser"], 1e-9)
+	assert.InDelta(t, 10.0, got["CPUTimeSystem"], 1e-9)
+	assert.InDelta(t, 55.0, got["CPUTimeIdle"], 1e-9)
+	assert.InDelta(t, 2.5, got["CPUTimeIowait"], 1e-9)
+	assert.InDelta(t, 2.5, got["CPUTimeSteal"], 1e-9)
+	assert.Zero(t, got["CPUTimeNice"])
+
+	assert.Empty(t, Breakdown(cur, cur))
+}
@@ -0,0 +1,46 @@
+package collector
+
+import (
+	"sync"
+	"time"
+)
+
+// DeltaTracker превращает накопительные счётчики системы (байты, операции) в приращения
+// с предыдущего замера. Первый замер каждого ключа только запоминается.
+type DeltaTracker struct {
+	mu   sync.Mutex
+	prev map[string]sample
+}
+
+type sample struct {
+	value uint64
+	at    time.Time
+}
+
+// NewDeltaTracker конструктор для DeltaTracker.
+func NewDeltaTracker() *DeltaTracker {
+	return &DeltaTracker{
+		prev: make(map[string]sample),
+	}
+}
+
+// Delta возвращает приращение значения ключа с предыдущего замера и прошедшее время.
+// ok равен false для первого замера. Если значение уменьшилось (счётчик сбросился,
+// например, после перезагрузки устройства), приращением считается само значение.
+func (d *DeltaTracker) Delta(key string, value uint64, at time.Time) (delta uint64, elapsed time.Duration, ok bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	prev, seen := d.prev[key]
+	d.prev[key] = sample{value: value, at: at}
+
+	if !seen {
+		return 0, 0, false
+	}
+
+	if value < prev.value {
+		return value, at.Sub(prev.at), true
+	}
+
+	return value - prev.value, at.Sub(prev.at), true
+}
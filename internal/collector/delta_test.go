@@ -0,0 +1,27 @@
+package collector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeltaTracker(t *testing.T) {
+	t.Parallel()
+
+	d := NewDeltaTracker()
+	now := time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	_, _, ok := d.Delta("sda", 100, now)
+	assert.False(t, ok)
+
+	delta, elapsed, ok := d.Delta("sda", 150, now.Add(10*time.Second))
+	assert.True(t, ok)
+	assert.Equal(t, uint64(50), delta)
+	assert.Equal(t, 10*time.Second, elapsed)
+
+	delta, _, ok = d.Delta("sda", 20, now.Add(20*time.Second))
+	assert.True(t, ok)
+	assert.Equal(t, uint64(20), delta)
+}
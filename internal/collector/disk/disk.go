@@ -0,0 +1,242 @@
+// Пакет disk представляет коллектор заполненности файловых систем и ввода-вывода дисков.
+//
+// Метрики файловых систем передаются с меткой mount (точка монтирования), метрики устройств - с меткой
+// device (имя устройства):
+//   - DiskTotal, DiskUsed, DiskFree - объём в байтах;
+//   - DiskUsedPercent - заполненность в процентах;
+//   - DiskInodesTotal, DiskInodesUsed, DiskInodesFree - inode'ы;
+//   - DiskReadBytes, DiskWriteBytes, DiskReadOps, DiskWriteOps - счётчики прочитанных и записанных байт и операций;
+//   - DiskReadIOPS, DiskWriteIOPS - операций в секунду с предыдущего опроса.
+package disk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/vorotislav/alert-service/internal/collector"
+	"github.com/vorotislav/alert-service/internal/model"
+
+	"github.com/shirou/gopsutil/v3/disk"
+	"go.uber.org/zap"
+)
+
+// Name имя коллектора в настройках.
+const Name = "disk"
+
+// Имена собираемых метрик.
+const (
+	MetricTotal       = "DiskTotal"
+	MetricUsed        = "DiskUsed"
+	MetricFree        = "DiskFree"
+	MetricUsedPercent = "DiskUsedPercent"
+	MetricInodesTotal = "DiskInodesTotal"
+	MetricInodesUsed  = "DiskInodesUsed"
+	MetricInodesFree  = "DiskInodesFree"
+	MetricReadBytes   = "DiskReadBytes"
+	MetricWriteBytes  = "DiskWriteBytes"
+	MetricReadOps     = "DiskReadOps"
+	MetricWriteOps    = "DiskWriteOps"
+	MetricReadIOPS    = "DiskReadIOPS"
+	MetricWriteIOPS   = "DiskWriteIOPS"
+)
+
+// Метки экземпляров.
+const (
+	LabelMount  = "mount"
+	LabelDevice = "device"
+)
+
+// Фильтры по умолчанию: служебные и виртуальные файловые системы и устройства не интересны.
+//
+//nolint:gochecknoglobals
+var (
+	defaultFSTypes = collector.Patterns{Exclude: []string{`^(tmpfs|devtmpfs|squashfs|overlay|autofs|nsfs)$`}}
+	defaultDevices = collector.Patterns{Exclude: []string{`^(loop|ram|zram)`}}
+)
+
+// Config настройки коллектора. AllPartitions - учитывать и виртуальные файловые системы.
+// FSTypes, Mounts и Devices - фильтры по типу файловой системы, точке монтирования и имени устройства.
+type Config struct {
+	AllPartitions bool               `json:"all_partitions"`
+	FSTypes       collector.Patterns `json:"fs_types"`
+	Mounts        collector.Patterns `json:"mounts"`
+	Devices       collector.Patterns `json:"devices"`
+}
+
+// Collector коллектор дисков.
+type Collector struct {
+	log           *zap.Logger
+	allPartitions bool
+	fsTypes       *collector.Filter
+	mounts        *collector.Filter
+	devices       *collector.Filter
+	deltas        *collector.DeltaTracker
+	now           func() time.Time
+
+	partitions func(ctx context.Context, all bool) ([]disk.PartitionStat, error)
+	usage      func(ctx context.Context, path string) (*disk.UsageStat, error)
+	ioCounters func(ctx context.Context) (map[string]disk.IOCountersStat, error)
+}
+
+// New фабрика коллектора.
+func New(log *zap.Logger, raw json.RawMessage) (collector.Collector, error) {
+	cfg := Config{}
+
+	if err := collector.Decode(raw, &cfg); err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	fsTypes, err := cfg.FSTypes.Filter(defaultFSTypes)
+	if err != nil {
+		return nil, fmt.Errorf("fs types: %w", err)
+	}
+
+	mounts, err := cfg.Mounts.Filter(collector.Patterns{})
+	if err != nil {
+		return nil, fmt.Errorf("mounts: %w", err)
+	}
+
+	devices, err := cfg.Devices.Filter(defaultDevices)
+	if err != nil {
+		return nil, fmt.Errorf("devices: %w", err)
+	}
+
+	return &Collector{
+		log:           log,
+		allPartitions: cfg.AllPartitions,
+		fsTypes:       fsTypes,
+		mounts:        mounts,
+		devices:       devices,
+		deltas:        collector.NewDeltaTracker(),
+		now:           time.Now,
+		partitions:    disk.PartitionsWithContext,
+		usage:         disk.UsageWithContext,
+		ioCounters: func(ctx context.Context) (map[string]disk.IOCountersStat, error) {
+			return disk.IOCountersWithContext(ctx)
+		},
+	}, nil
+}
+
+// Name возвращает имя коллектора.
+func (c *Collector) Name() string {
+	return Name
+}
+
+// Collect возвращает заполненность файловых систем и счётчики ввода-вывода устройств.
+// Ошибка одной файловой системы не мешает собрать остальные.
+func (c *Collector) Collect(ctx context.Context) ([]model.Metrics, error) {
+	errs := make([]error, 0)
+
+	metrics, err := c.collectUsage(ctx)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	io, err := c.collectIO(ctx)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	return append(metrics, io...), errors.Join(errs...)
+}
+
+func (c *Collector) collectUsage(ctx context.Context) ([]model.Metrics, error) {
+	partitions, err := c.partitions(ctx, c.allPartitions)
+	if err != nil {
+		return nil, fmt.Errorf("partitions: %w", err)
+	}
+
+	metrics := make([]model.Metrics, 0)
+	errs := make([]error, 0)
+	seen := make(map[string]struct{}, len(partitions))
+
+	for _, p := range partitions {
+		if _, ok := seen[p.Mountpoint]; ok {
+			continue
+		}
+
+		if !c.fsTypes.Match(p.Fstype) || !c.mounts.Match(p.Mountpoint) {
+			continue
+		}
+
+		seen[p.Mountpoint] = struct{}{}
+
+		u, err := c.usage(ctx, p.Mountpoint)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("usage %s: %w", p.Mountpoint, err))
+
+			continue
+		}
+
+		labels := map[string]string{LabelMount: p.Mountpoint}
+
+		metrics = append(metrics,
+			collector.LabeledGauge(MetricTotal, labels, float64(u.Total)),
+			collector.LabeledGauge(MetricUsed, labels, float64(u.Used)),
+			collector.LabeledGauge(MetricFree, labels, float64(u.Free)),
+			collector.LabeledGauge(MetricUsedPercent, labels, u.UsedPercent),
+		)
+
+		// Некоторые файловые системы (например, btrfs, vfat) не ведут учёт inode'ов.
+		if u.InodesTotal > 0 {
+			metrics = append(metrics,
+				collector.LabeledGauge(MetricInodesTotal, labels, float64(u.InodesTotal)),
+				collector.LabeledGauge(MetricInodesUsed, labels, float64(u.InodesUsed)),
+				collector.LabeledGauge(MetricInodesFree, labels, float64(u.InodesFree)),
+			)
+		}
+	}
+
+	return metrics, errors.Join(errs...)
+}
+
+func (c *Collector) collectIO(ctx context.Context) ([]model.Metrics, error) {
+	counters, err := c.ioCounters(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("io counters: %w", err)
+	}
+
+	now := c.now()
+	metrics := make([]model.Metrics, 0)
+
+	for name, io := range counters {
+		if !c.devices.Match(name) {
+			continue
+		}
+
+		labels := map[string]string{LabelDevice: name}
+
+		for _, cnt := range []struct {
+			prefix string
+			value  uint64
+		}{
+			{MetricReadBytes, io.ReadBytes},
+			{MetricWriteBytes, io.WriteBytes},
+			{MetricReadOps, io.ReadCount},
+			{MetricWriteOps, io.WriteCount},
+		} {
+			delta, elapsed, ok := c.deltas.Delta(model.SeriesKey(cnt.prefix, labels), cnt.value, now)
+			if !ok {
+				continue
+			}
+
+			metrics = append(metrics, collector.LabeledCounter(cnt.prefix, labels, int64(delta)))
+
+			if elapsed <= 0 {
+				continue
+			}
+
+			switch cnt.prefix {
+			case MetricReadOps:
+				metrics = append(metrics, collector.LabeledGauge(MetricReadIOPS, labels, float64(delta)/elapsed.Seconds()))
+			case MetricWriteOps:
+				metrics = append(metrics, collector.LabeledGauge(MetricWriteIOPS, labels, float64(delta)/elapsed.Seconds()))
+			}
+		}
+	}
+
+	return metrics, nil
+}
@@ -0,0 +1,107 @@
+package disk
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/vorotislav/alert-service/internal/model"
+
+	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func newTestCollector(t *testing.T, cfg string) *Collector {
+	t.Helper()
+
+	c, err := New(zap.NewNop(), json.RawMessage(cfg))
+	require.NoError(t, err)
+
+	dc := c.(*Collector) //nolint:forcetypeassert
+
+	dc.partitions = func(_ context.Context, _ bool) ([]disk.PartitionStat, error) {
+		return []disk.PartitionStat{
+			{Device: "/dev/sda1", Mountpoint: "/", Fstype: "ext4"},
+			{Device: "/dev/sda2", Mountpoint: "/var/lib", Fstype: "xfs"},
+			{Device: "tmpfs", Mountpoint: "/run", Fstype: "tmpfs"},
+		}, nil
+	}
+	dc.usage = func(_ context.Context, path string) (*disk.UsageStat, error) {
+		return &disk.UsageStat{Path: path, Total: 100, Used: 40, Free: 60, UsedPercent: 40, InodesTotal: 10}, nil
+	}
+
+	reads := uint64(1000)
+	dc.ioCounters = func(_ context.Context) (map[string]disk.IOCountersStat, error) {
+		reads += 500
+
+		return map[string]disk.IOCountersStat{
+			"sda":   {Name: "sda", ReadCount: reads, ReadBytes: reads * 512},
+			"loop0": {Name: "loop0", ReadCount: reads},
+		}, nil
+	}
+
+	return dc
+}
+
+// series возвращает ключ серии метрики с одной меткой экземпляра.
+func series(name, label, value string) string {
+	return model.SeriesKey(name, map[string]string{label: value})
+}
+
+func collect(t *testing.T, c *Collector) map[string]float64 {
+	t.Helper()
+
+	metrics, err := c.Collect(context.Background())
+	require.NoError(t, err)
+
+	got := make(map[string]float64, len(metrics))
+
+	for _, m := range metrics {
+		switch {
+		case m.Value != nil:
+			got[m.SeriesKey()] = *m.Value
+		case m.Delta != nil:
+			got[m.SeriesKey()] = float64(*m.Delta)
+		}
+	}
+
+	return got
+}
+
+func TestCollector_Collect(t *testing.T) {
+	t.Parallel()
+
+	c := newTestCollector(t, `{}`)
+
+	now := time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+
+	first := collect(t, c)
+	assert.Equal(t, float64(40), first[series(MetricUsedPercent, LabelMount, "/")])
+	assert.Equal(t, float64(60), first[series(MetricFree, LabelMount, "/var/lib")])
+	assert.Equal(t, float64(10), first[series(MetricInodesTotal, LabelMount, "/")])
+	assert.NotContains(t, first, series(MetricUsed, LabelMount, "/run"), "tmpfs is excluded by default")
+	assert.NotContains(t, first, series(MetricReadOps, LabelDevice, "sda"), "first observation has no delta")
+
+	now = now.Add(10 * time.Second)
+
+	second := collect(t, c)
+	assert.Equal(t, float64(500), second[series(MetricReadOps, LabelDevice, "sda")])
+	assert.Equal(t, float64(500*512), second[series(MetricReadBytes, LabelDevice, "sda")])
+	assert.Equal(t, float64(50), second[series(MetricReadIOPS, LabelDevice, "sda")])
+	assert.NotContains(t, second, series(MetricReadOps, LabelDevice, "loop0"))
+}
+
+func TestCollector_Filters(t *testing.T) {
+	t.Parallel()
+
+	c := newTestCollector(t, `{"fs_types": {"include": ["^tmpfs$"]}, "mounts": {"exclude": ["^/var"]}}`)
+
+	got := collect(t, c)
+	assert.Contains(t, got, series(MetricUsed, LabelMount, "/run"))
+	assert.NotContains(t, got, series(MetricUsed, LabelMount, "/"))
+	assert.NotContains(t, got, series(MetricUsed, LabelMount, "/var/lib"))
+}
@@ -0,0 +1,129 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"github.com/vorotislav/alert-service/internal/model"
+)
+
+// Filter отбирает имена по регулярным выражениям. Имя проходит фильтр, если оно подходит
+// хотя бы под одно выражение из include (или include пуст) и ни под одно из exclude.
+type Filter struct {
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+}
+
+// NewFilter конструктор для Filter.
+func NewFilter(include, exclude []string) (*Filter, error) {
+	f := &Filter{}
+
+	var err error
+
+	if f.include, err = compile(include); err != nil {
+		return nil, err
+	}
+
+	if f.exclude, err = compile(exclude); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func compile(patterns []string) ([]*regexp.Regexp, error) {
+	res := make([]*regexp.Regexp, 0, len(patterns))
+
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("%w: pattern %q: %w", ErrInvalidConfig, p, err)
+		}
+
+		res = append(res, re)
+	}
+
+	return res, nil
+}
+
+// Match проверяет, проходит ли имя фильтр. Nil-фильтр пропускает всё.
+func (f *Filter) Match(name string) bool {
+	if f == nil {
+		return true
+	}
+
+	if len(f.include) > 0 && !matchAny(f.include, name) {
+		return false
+	}
+
+	return !matchAny(f.exclude, name)
+}
+
+func matchAny(res []*regexp.Regexp, name string) bool {
+	for _, re := range res {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// filtered коллектор, метрики которого проходят через фильтр имён.
+type filtered struct {
+	Collector
+	filter *Filter
+}
+
+func (f *filtered) Collect(ctx context.Context) ([]model.Metrics, error) {
+	metrics, err := f.Collector.Collect(ctx)
+
+	return f.match(metrics), err //nolint:wrapcheck
+}
+
+func (f *filtered) match(metrics []model.Metrics) []model.Metrics {
+	res := make([]model.Metrics, 0, len(metrics))
+
+	for _, m := range metrics {
+		if f.filter.Match(m.ID) {
+			res = append(res, m)
+		}
+	}
+
+	return res
+}
+
+// Start запускает фоновую работу обёрнутого коллектора, если она у него есть.
+func (f *filtered) Start(ctx context.Context) error {
+	if s, ok := f.Collector.(Starter); ok {
+		return s.Start(ctx) //nolint:wrapcheck
+	}
+
+	return nil
+}
+
+// Flush возвращает агрегаты обёрнутого коллектора, если он их собирает, после фильтрации.
+func (f *filtered) Flush() []model.Metrics {
+	fl, ok := f.Collector.(Flusher)
+	if !ok {
+		return nil
+	}
+
+	return f.match(fl.Flush())
+}
+
+// Patterns списки регулярных выражений для настройки фильтра в разделе коллектора.
+type Patterns struct {
+	Include []string `json:"include"`
+	Exclude []string `json:"exclude"`
+}
+
+// Filter компилирует выражения в Filter. Если оба списка пусты, используется def.
+func (p Patterns) Filter(def Patterns) (*Filter, error) {
+	if len(p.Include) == 0 && len(p.Exclude) == 0 {
+		p = def
+	}
+
+	return NewFilter(p.Include, p.Exclude)
+}
@@ -0,0 +1,108 @@
+// Пакет goruntime представляет коллектор статистики памяти runtime Go.
+package goruntime
+
+import (
+	"context"
+	"encoding/json"
+	"runtime"
+
+	"github.com/vorotislav/alert-service/internal/collector"
+	"github.com/vorotislav/alert-service/internal/model"
+
+	"go.uber.org/zap"
+)
+
+// Name имя коллектора в настройках.
+const Name = "runtime"
+
+// Собираемые метрики.
+const (
+	MetricAlloc         = "Alloc"
+	MetricBuckHashSys   = "BuckHashSys"
+	MetricFrees         = "Frees"
+	MetricGCSys         = "GCSys"
+	MetricHeapAlloc     = "HeapAlloc"
+	MetricHeapIdle      = "HeapIdle"
+	MetricHeapInuse     = "HeapInuse"
+	MetricHeapObjects   = "HeapObjects"
+	MetricHeapReleased  = "HeapReleased"
+	MetricHeapSys       = "HeapSys"
+	MetricLastGC        = "LastGC"
+	MetricLookups       = "Lookups"
+	MetricMCacheInuse   = "MCacheInuse"
+	MetricMCacheSys     = "MCacheSys"
+	MetricMSpanInuse    = "MSpanInuse"
+	MetricMSpanSys      = "MSpanSys"
+	MetricMallocs       = "Mallocs"
+	MetricNextGC        = "NextGC"
+	MetricNumForcedGC   = "NumForcedGC"
+	MetricNumGC         = "NumGC"
+	MetricOtherSys      = "OtherSys"
+	MetricPauseTotalNs  = "PauseTotalNs"
+	MetricStackInuse    = "StackInuse"
+	MetricStackSys      = "StackSys"
+	MetricSys           = "Sys"
+	MetricTotalAlloc    = "TotalAlloc"
+	MetricGCCPUFraction = "GCCPUFraction"
+)
+
+//nolint:gochecknoglobals
+var readers = []struct {
+	name string
+	read func(ms *runtime.MemStats) float64
+}{
+	{MetricAlloc, func(ms *runtime.MemStats) float64 { return float64(ms.Alloc) }},
+	{MetricBuckHashSys, func(ms *runtime.MemStats) float64 { return float64(ms.BuckHashSys) }},
+	{MetricFrees, func(ms *runtime.MemStats) float64 { return float64(ms.Frees) }},
+	{MetricGCSys, func(ms *runtime.MemStats) float64 { return float64(ms.GCSys) }},
+	{MetricHeapAlloc, func(ms *runtime.MemStats) float64 { return float64(ms.HeapAlloc) }},
+	{MetricHeapIdle, func(ms *runtime.MemStats) float64 { return float64(ms.HeapIdle) }},
+	{MetricHeapInuse, func(ms *runtime.MemStats) float64 { return float64(ms.HeapInuse) }},
+	{MetricHeapObjects, func(ms *runtime.MemStats) float64 { return float64(ms.HeapObjects) }},
+	{MetricHeapReleased, func(ms *runtime.MemStats) float64 { return float64(ms.HeapReleased) }},
+	{MetricHeapSys, func(ms *runtime.MemStats) float64 { return float64(ms.HeapSys) }},
+	{MetricLastGC, func(ms *runtime.MemStats) float64 { return float64(ms.LastGC) }},
+	{MetricLookups, func(ms *runtime.MemStats) float64 { return float64(ms.Lookups) }},
+	{MetricMCacheInuse, func(ms *runtime.MemStats) float64 { return float64(ms.MCacheInuse) }},
+	{MetricMCacheSys, func(ms *runtime.MemStats) float64 { return float64(ms.MCacheSys) }},
+	{MetricMSpanInuse, func(ms *runtime.MemStats) float64 { return float64(ms.MSpanInuse) }},
+	{MetricMSpanSys, func(ms *runtime.MemStats) float64 { return float64(ms.MSpanSys) }},
+	{MetricMallocs, func(ms *runtime.MemStats) float64 { return float64(ms.Mallocs) }},
+	{MetricNextGC, func(ms *runtime.MemStats) float64 { return float64(ms.NextGC) }},
+	{MetricNumForcedGC, func(ms *runtime.MemStats) float64 { return float64(ms.NumForcedGC) }},
+	{MetricNumGC, func(ms *runtime.MemStats) float64 { return float64(ms.NumGC) }},
+	{MetricOtherSys, func(ms *runtime.MemStats) float64 { return float64(ms.OtherSys) }},
+	{MetricPauseTotalNs, func(ms *runtime.MemStats) float64 { return float64(ms.PauseTotalNs) }},
+	{MetricStackInuse, func(ms *runtime.MemStats) float64 { return float64(ms.StackInuse) }},
+	{MetricStackSys, func(ms *runtime.MemStats) float64 { return float64(ms.StackSys) }},
+	{MetricSys, func(ms *runtime.MemStats) float64 { return float64(ms.Sys) }},
+	{MetricTotalAlloc, func(ms *runtime.MemStats) float64 { return float64(ms.TotalAlloc) }},
+	{MetricGCCPUFraction, func(ms *runtime.MemStats) float64 { return ms.GCCPUFraction }},
+}
+
+// Collector коллектор статистики runtime.MemStats.
+type Collector struct{}
+
+// New фабрика коллектора. Собственных настроек у коллектора нет.
+func New(_ *zap.Logger, _ json.RawMessage) (collector.Collector, error) {
+	return &Collector{}, nil
+}
+
+// Name возвращает имя коллектора.
+func (c *Collector) Name() string {
+	return Name
+}
+
+// Collect читает runtime.MemStats и возвращает их поля как метрики gauge.
+func (c *Collector) Collect(_ context.Context) ([]model.Metrics, error) {
+	ms := runtime.MemStats{}
+	runtime.ReadMemStats(&ms)
+
+	metrics := make([]model.Metrics, 0, len(readers))
+
+	for _, r := range readers {
+		metrics = append(metrics, collector.Gauge(r.name, r.read(&ms)))
+	}
+
+	return metrics, nil
+}
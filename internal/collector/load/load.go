@@ -0,0 +1,51 @@
+// Пакет load представляет коллектор средней загрузки системы за 1, 5 и 15 минут.
+package load
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/vorotislav/alert-service/internal/collector"
+	"github.com/vorotislav/alert-service/internal/model"
+
+	"github.com/shirou/gopsutil/v3/load"
+	"go.uber.org/zap"
+)
+
+// Name имя коллектора в настройках.
+const Name = "load"
+
+// Собираемые метрики.
+const (
+	MetricLoadAverage1  = "LoadAverage1"
+	MetricLoadAverage5  = "LoadAverage5"
+	MetricLoadAverage15 = "LoadAverage15"
+)
+
+// Collector коллектор средней загрузки.
+type Collector struct{}
+
+// New фабрика коллектора. Собственных настроек у коллектора нет.
+func New(_ *zap.Logger, _ json.RawMessage) (collector.Collector, error) {
+	return &Collector{}, nil
+}
+
+// Name возвращает имя коллектора.
+func (c *Collector) Name() string {
+	return Name
+}
+
+// Collect возвращает среднюю загрузку системы.
+func (c *Collector) Collect(ctx context.Context) ([]model.Metrics, error) {
+	avg, err := load.AvgWithContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("load average: %w", err)
+	}
+
+	return []model.Metrics{
+		collector.Gauge(MetricLoadAverage1, avg.Load1),
+		collector.Gauge(MetricLoadAverage5, avg.Load5),
+		collector.Gauge(MetricLoadAverage15, avg.Load15),
+	}, nil
+}
@@ -0,0 +1,444 @@
+// Пакет logtail представляет коллектор, который читает дописываемые строки лог-файлов
+// и считает совпадения с заданными регулярными выражениями. Ротация (файл переименован
+// и создан заново) и усечение файла обрабатываются: строки старого файла дочитываются,
+// а новый или усечённый файл читается с начала.
+//
+// Для каждого шаблона можно задать счётчик совпадений и gauge, в который попадает числовое
+// значение группы захвата из последнего совпадения. Имена метрик задаются в настройках.
+package logtail
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/vorotislav/alert-service/internal/collector"
+	"github.com/vorotislav/alert-service/internal/model"
+
+	"go.uber.org/zap"
+)
+
+// Name имя коллектора в настройках.
+const Name = "logtail"
+
+const (
+	defaultInterval = time.Second
+	defaultGroup    = "1"
+	// maxLineLength строки длиннее обрезаются: шаблоны применяются к началу строки.
+	maxLineLength = 64 << 10
+	readBufSize   = 32 << 10
+)
+
+// Ошибки настройки коллектора.
+var (
+	ErrNoFiles        = errors.New("no log files")
+	ErrInvalidFile    = errors.New("invalid log file")
+	ErrInvalidPattern = errors.New("invalid log pattern")
+)
+
+// Pattern шаблон строки. Counter - имя счётчика совпадений, Gauge - имя gauge для значения группы
+// захвата Group (номер или имя группы, по умолчанию 1). Нужно задать хотя бы одно из имён.
+type Pattern struct {
+	Regex   string `json:"regex"`
+	Counter string `json:"counter"`
+	Gauge   string `json:"gauge"`
+	Group   string `json:"group"`
+}
+
+// File лог-файл. FromStart - при запуске агента читать файл с начала, а не только новые строки.
+type File struct {
+	Path      string    `json:"path"`
+	FromStart bool      `json:"from_start"`
+	Patterns  []Pattern `json:"patterns"`
+}
+
+// Config настройки коллектора. Interval - период проверки файлов в формате time.ParseDuration (по умолчанию 1s).
+type Config struct {
+	Interval string `json:"interval"`
+	Files    []File `json:"files"`
+}
+
+type pattern struct {
+	Pattern
+	re    *regexp.Regexp
+	group int
+}
+
+// tail состояние чтения одного файла.
+type tail struct {
+	path      string
+	fromStart bool
+	patterns  []pattern
+
+	file    *os.File
+	info    os.FileInfo
+	offset  int64
+	partial []byte
+}
+
+// Collector коллектор лог-файлов.
+type Collector struct {
+	log      *zap.Logger
+	interval time.Duration
+	tails    []*tail
+
+	mu       sync.Mutex
+	counters map[string]int64
+	gauges   map[string]float64
+}
+
+// New фабрика коллектора.
+func New(log *zap.Logger, raw json.RawMessage) (collector.Collector, error) {
+	cfg := Config{}
+
+	if err := collector.Decode(raw, &cfg); err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	if len(cfg.Files) == 0 {
+		return nil, ErrNoFiles
+	}
+
+	interval := defaultInterval
+
+	if cfg.Interval != "" {
+		d, err := time.ParseDuration(cfg.Interval)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("%w: interval %q", collector.ErrInvalidConfig, cfg.Interval)
+		}
+
+		interval = d
+	}
+
+	c := &Collector{
+		log:      log,
+		interval: interval,
+		tails:    make([]*tail, 0, len(cfg.Files)),
+		counters: make(map[string]int64),
+		gauges:   make(map[string]float64),
+	}
+
+	for _, f := range cfg.Files {
+		t, err := newTail(f)
+		if err != nil {
+			return nil, err
+		}
+
+		// Счётчики отправляются и без совпадений, чтобы по ним можно было настроить правила.
+		for _, p := range t.patterns {
+			if p.Counter != "" {
+				c.counters[p.Counter] += 0
+			}
+		}
+
+		c.tails = append(c.tails, t)
+	}
+
+	return c, nil
+}
+
+func newTail(f File) (*tail, error) {
+	if f.Path == "" {
+		return nil, fmt.Errorf("%w: empty path", ErrInvalidFile)
+	}
+
+	if len(f.Patterns) == 0 {
+		return nil, fmt.Errorf("%w: %s: no patterns", ErrInvalidFile, f.Path)
+	}
+
+	t := &tail{
+		path:      f.Path,
+		fromStart: f.FromStart,
+		patterns:  make([]pattern, 0, len(f.Patterns)),
+	}
+
+	for i, p := range f.Patterns {
+		pt, err := parsePattern(p)
+		if err != nil {
+			return nil, fmt.Errorf("%s: pattern %d: %w", f.Path, i, err)
+		}
+
+		t.patterns = append(t.patterns, pt)
+	}
+
+	return t, nil
+}
+
+func parsePattern(p Pattern) (pattern, error) {
+	if p.Counter == "" && p.Gauge == "" {
+		return pattern{}, fmt.Errorf("%w: counter or gauge name is required", ErrInvalidPattern)
+	}
+
+	re, err := regexp.Compile(p.Regex)
+	if err != nil {
+		return pattern{}, fmt.Errorf("%w: %w", ErrInvalidPattern, err)
+	}
+
+	pt := pattern{Pattern: p, re: re}
+
+	if p.Gauge == "" {
+		return pt, nil
+	}
+
+	if p.Group == "" {
+		p.Group = defaultGroup
+	}
+
+	pt.group = re.SubexpIndex(p.Group)
+
+	if pt.group < 0 {
+		n, err := strconv.Atoi(p.Group)
+		if err != nil || n < 0 || n > re.NumSubexp() {
+			return pattern{}, fmt.Errorf("%w: no group %q in %s", ErrInvalidPattern, p.Group, p.Regex)
+		}
+
+		pt.group = n
+	}
+
+	return pt, nil
+}
+
+// Name возвращает имя коллектора.
+func (c *Collector) Name() string {
+	return Name
+}
+
+// Start открывает файлы и начинает периодически читать новые строки.
+func (c *Collector) Start(ctx context.Context) error {
+	c.openAll()
+
+	go c.loop(ctx)
+
+	return nil
+}
+
+// openAll открывает файлы при запуске. Файл, которого ещё нет, будет прочитан с начала, когда появится.
+func (c *Collector) openAll() {
+	for _, t := range c.tails {
+		if err := t.open(!t.fromStart); err != nil && !errors.Is(err, os.ErrNotExist) {
+			c.log.Warn("cannot open log file", zap.String("path", t.path), zap.Error(err))
+		}
+	}
+}
+
+func (c *Collector) loop(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			for _, t := range c.tails {
+				t.close()
+			}
+
+			return
+		case <-ticker.C:
+			c.poll()
+		}
+	}
+}
+
+// poll дочитывает все файлы.
+func (c *Collector) poll() {
+	for _, t := range c.tails {
+		if err := t.read(c.match); err != nil {
+			c.log.Warn("cannot read log file", zap.String("path", t.path), zap.Error(err))
+		}
+	}
+}
+
+// match применяет шаблоны файла к строке.
+func (c *Collector) match(patterns []pattern, line []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, p := range patterns {
+		sub := p.re.FindSubmatch(line)
+		if sub == nil {
+			continue
+		}
+
+		if p.Counter != "" {
+			c.counters[p.Counter]++
+		}
+
+		if p.Gauge == "" {
+			continue
+		}
+
+		v, err := strconv.ParseFloat(string(sub[p.group]), 64)
+		if err != nil {
+			c.log.Debug("captured value is not a number", zap.String("gauge", p.Gauge), zap.Error(err))
+
+			continue
+		}
+
+		c.gauges[p.Gauge] = v
+	}
+}
+
+// Collect возвращает совпадения с предыдущего опроса и последние значения gauge.
+func (c *Collector) Collect(_ context.Context) ([]model.Metrics, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	metrics := make([]model.Metrics, 0, len(c.counters)+len(c.gauges))
+
+	for id, d := range c.counters {
+		metrics = append(metrics, collector.Counter(id, d))
+		c.counters[id] = 0
+	}
+
+	for id, v := range c.gauges {
+		metrics = append(metrics, collector.Gauge(id, v))
+	}
+
+	return metrics, nil
+}
+
+// open открывает файл. atEnd - начать чтение с конца файла.
+func (t *tail) open(atEnd bool) error {
+	f, err := os.Open(t.path)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+
+		return fmt.Errorf("stat: %w", err)
+	}
+
+	t.file, t.info, t.offset, t.partial = f, info, 0, nil
+
+	if atEnd {
+		t.offset, err = f.Seek(0, io.SeekEnd)
+		if err != nil {
+			t.close()
+
+			return fmt.Errorf("seek: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (t *tail) close() {
+	if t.file != nil {
+		_ = t.file.Close()
+		t.file = nil
+	}
+}
+
+// read дочитывает файл. Если по пути теперь другой файл (ротация), сначала дочитывается старый,
+// затем новый читается с начала. Если файл стал короче прочитанного (усечение), он читается с начала.
+func (t *tail) read(match func([]pattern, []byte)) error {
+	info, err := os.Stat(t.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			// Файл переименован, а новый ещё не создан: дочитываем старый, если он открыт.
+			return t.drain(match)
+		}
+
+		return fmt.Errorf("stat: %w", err)
+	}
+
+	if t.file != nil && !os.SameFile(t.info, info) {
+		if err := t.drain(match); err != nil {
+			return err
+		}
+
+		t.flush(match)
+		t.close()
+	}
+
+	if t.file == nil {
+		// Файл появился после запуска агента или после ротации: все его строки новые.
+		if err := t.open(false); err != nil {
+			return err
+		}
+	}
+
+	if info.Size() < t.offset {
+		if _, err := t.file.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("seek: %w", err)
+		}
+
+		t.offset, t.partial = 0, nil
+	}
+
+	t.info = info
+
+	return t.drain(match)
+}
+
+// drain читает открытый файл до конца и передаёт полные строки в match.
+// Незавершённая последняя строка остаётся в буфере до следующего чтения.
+func (t *tail) drain(match func([]pattern, []byte)) error {
+	if t.file == nil {
+		return nil
+	}
+
+	buf := make([]byte, readBufSize)
+
+	for {
+		n, err := t.file.Read(buf)
+		t.offset += int64(n)
+		t.consume(buf[:n], match)
+
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("read: %w", err)
+		}
+	}
+}
+
+func (t *tail) consume(data []byte, match func([]pattern, []byte)) {
+	for len(data) > 0 {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			t.partial = appendLimited(t.partial, data)
+
+			return
+		}
+
+		line := data[:i]
+		if len(t.partial) > 0 {
+			line = appendLimited(t.partial, line)
+			t.partial = nil
+		}
+
+		match(t.patterns, bytes.TrimSuffix(line, []byte("\r")))
+
+		data = data[i+1:]
+	}
+}
+
+// flush обрабатывает незавершённую последнюю строку файла, который больше не будет дописываться.
+func (t *tail) flush(match func([]pattern, []byte)) {
+	if len(t.partial) > 0 {
+		match(t.patterns, t.partial)
+		t.partial = nil
+	}
+}
+
+func appendLimited(dst, src []byte) []byte {
+	if room := maxLineLength - len(dst); len(src) > room {
+		src = src[:max(room, 0)]
+	}
+
+	return append(dst, src...)
+}
@@ -0,0 +1,127 @@
+package logtail
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func collect(t *testing.T, c *Collector) map[string]float64 {
+	t.Helper()
+
+	metrics, err := c.Collect(context.Background())
+	require.NoError(t, err)
+
+	got := make(map[string]float64, len(metrics))
+
+	for _, m := range metrics {
+		switch {
+		case m.Value != nil:
+			got[m.ID] = *m.Value
+		case m.Delta != nil:
+			got[m.ID] = float64(*m.Delta)
+		}
+	}
+
+	return got
+}
+
+func appendFile(t *testing.T, path, data string) {
+	t.Helper()
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	require.NoError(t, err)
+
+	_, err = f.WriteString(data)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+}
+
+func TestCollector_Tail(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "app.log")
+	appendFile(t, path, "ERROR before start\n")
+
+	cfg, err := json.Marshal(Config{Files: []File{{
+		Path: path,
+		Patterns: []Pattern{
+			{Regex: `ERROR`, Counter: "AppErrors"},
+			{Regex: `panic:`, Counter: "AppPanics"},
+			{Regex: `latency=(?P<ms>[0-9.]+)ms`, Counter: "AppRequests", Gauge: "AppLatency", Group: "ms"},
+		},
+	}}})
+	require.NoError(t, err)
+
+	raw, err := New(zap.NewNop(), cfg)
+	require.NoError(t, err)
+
+	c := raw.(*Collector) //nolint:forcetypeassert
+
+	c.openAll()
+
+	appendFile(t, path, "INFO latency=12.5ms\nERROR db\nERROR disk\nINFO latency=")
+	c.poll()
+
+	got := collect(t, c)
+	assert.Equal(t, float64(2), got["AppErrors"])
+	assert.Equal(t, float64(0), got["AppPanics"])
+	assert.Equal(t, float64(1), got["AppRequests"])
+	assert.Equal(t, 12.5, got["AppLatency"])
+
+	// Строка дописана, затем файл ротирован: хвост старого файла и новый файл читаются полностью.
+	appendFile(t, path, "40ms\npanic: boom\n")
+	require.NoError(t, os.Rename(path, path+".1"))
+	appendFile(t, path, "ERROR after rotation\n")
+	c.poll()
+
+	got = collect(t, c)
+	assert.Equal(t, float64(1), got["AppErrors"])
+	assert.Equal(t, float64(1), got["AppPanics"])
+	assert.Equal(t, float64(40), got["AppLatency"])
+
+	// Усечение: файл читается с начала.
+	require.NoError(t, os.Truncate(path, 0))
+	appendFile(t, path, "ERROR\n")
+	c.poll()
+
+	got = collect(t, c)
+	assert.Equal(t, float64(1), got["AppErrors"])
+	assert.Equal(t, float64(0), got["AppPanics"])
+}
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		cfg  string
+		err  error
+	}{
+		{name: "no files", cfg: `{}`, err: ErrNoFiles},
+		{name: "no patterns", cfg: `{"files":[{"path":"/tmp/a.log"}]}`, err: ErrInvalidFile},
+		{name: "no names", cfg: `{"files":[{"path":"/tmp/a.log","patterns":[{"regex":"x"}]}]}`, err: ErrInvalidPattern},
+		{
+			name: "missing group",
+			cfg:  `{"files":[{"path":"/tmp/a.log","patterns":[{"regex":"x","gauge":"X"}]}]}`,
+			err:  ErrInvalidPattern,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := New(zap.NewNop(), json.RawMessage(tc.cfg))
+			require.ErrorIs(t, err, tc.err)
+		})
+	}
+}
@@ -0,0 +1,94 @@
+// Пакет memory представляет коллектор объёма оперативной памяти системы.
+// Если агент работает в cgroup с ограничением памяти (например, в контейнере), общим объёмом
+// считается это ограничение, а свободным - его остаток, а не память всей машины.
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/vorotislav/alert-service/internal/collector"
+	"github.com/vorotislav/alert-service/internal/collector/cgroup"
+	"github.com/vorotislav/alert-service/internal/model"
+
+	"github.com/shirou/gopsutil/v3/mem"
+	"go.uber.org/zap"
+)
+
+// Name имя коллектора в настройках.
+const Name = "memory"
+
+// Собираемые метрики.
+const (
+	MetricTotalMemory = "TotalMemory"
+	MetricFreeMemory  = "FreeMemory"
+)
+
+// Config настройки коллектора. Cgroup - учитывать ограничение памяти cgroup (по умолчанию true).
+type Config struct {
+	Cgroup *bool `json:"cgroup"`
+}
+
+// Collector коллектор объёма памяти.
+type Collector struct {
+	group *cgroup.Group
+
+	virtualMemory func(ctx context.Context) (*mem.VirtualMemoryStat, error)
+}
+
+// New фабрика коллектора.
+func New(log *zap.Logger, raw json.RawMessage) (collector.Collector, error) {
+	cfg := Config{}
+
+	if err := collector.Decode(raw, &cfg); err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	c := &Collector{
+		virtualMemory: mem.VirtualMemoryWithContext,
+	}
+
+	if cfg.Cgroup == nil || *cfg.Cgroup {
+		g, err := cgroup.Detect(cgroup.DefaultRoot, cgroup.DefaultProcFile)
+		if err != nil {
+			log.Debug("memory limits of cgroup are not used", zap.String("package", Name), zap.Error(err))
+		}
+
+		c.group = g
+	}
+
+	return c, nil
+}
+
+// Name возвращает имя коллектора.
+func (c *Collector) Name() string {
+	return Name
+}
+
+// Collect возвращает общий и свободный объём памяти.
+func (c *Collector) Collect(ctx context.Context) ([]model.Metrics, error) {
+	vm, err := c.virtualMemory(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("virtual memory: %w", err)
+	}
+
+	total, free := vm.Total, vm.Free
+
+	if c.group != nil {
+		// Ограничение больше памяти машины ничего не ограничивает, как и недоступный контроллер memory.
+		if m, err := c.group.Memory(); err == nil && m.Limit > 0 && m.Limit < total {
+			total = m.Limit
+			free = 0
+
+			if m.Usage < m.Limit {
+				free = m.Limit - m.Usage
+			}
+		}
+	}
+
+	return []model.Metrics{
+		collector.Gauge(MetricTotalMemory, float64(total)),
+		collector.Gauge(MetricFreeMemory, float64(free)),
+	}, nil
+}
@@ -0,0 +1,84 @@
+package memory
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/vorotislav/alert-service/internal/collector/cgroup"
+
+	"github.com/shirou/gopsutil/v3/mem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollector_Collect(t *testing.T) {
+	t.Parallel()
+
+	v2, err := cgroup.Open(filepath.Join("..", "cgroup", "testdata", "v2"), "app.slice/agent.service")
+	require.NoError(t, err)
+
+	// В фикстуре v1 память не ограничена.
+	v1, err := cgroup.Open(filepath.Join("..", "cgroup", "testdata", "v1"), "")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		group     *cgroup.Group
+		hostTotal uint64
+		wantTotal float64
+		wantFree  float64
+	}{
+		{
+			name:      "no cgroup",
+			hostTotal: 1 << 30,
+			wantTotal: 1 << 30,
+			wantFree:  1 << 29,
+		},
+		{
+			name:      "cgroup limit",
+			group:     v2,
+			hostTotal: 1 << 30,
+			wantTotal: 268435456,
+			wantFree:  268435456 - 104857600,
+		},
+		{
+			name:      "limit above host memory",
+			group:     v2,
+			hostTotal: 1 << 27,
+			wantTotal: 1 << 27,
+			wantFree:  1 << 29,
+		},
+		{
+			name:      "unlimited cgroup",
+			group:     v1,
+			hostTotal: 1 << 30,
+			wantTotal: 1 << 30,
+			wantFree:  1 << 29,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			c := &Collector{
+				group: tc.group,
+				virtualMemory: func(_ context.Context) (*mem.VirtualMemoryStat, error) {
+					return &mem.VirtualMemoryStat{Total: tc.hostTotal, Free: 1 << 29}, nil
+				},
+			}
+
+			metrics, err := c.Collect(context.Background())
+			require.NoError(t, err)
+			require.Len(t, metrics, 2)
+
+			assert.Equal(t, MetricTotalMemory, metrics[0].ID)
+			assert.Equal(t, tc.wantTotal, *metrics[0].Value)
+			assert.Equal(t, MetricFreeMemory, metrics[1].ID)
+			assert.Equal(t, tc.wantFree, *metrics[1].Value)
+		})
+	}
+}
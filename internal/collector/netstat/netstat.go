@@ -0,0 +1,191 @@
+// Пакет netstat представляет коллектор сетевых интерфейсов и состояний TCP-соединений.
+//
+// Имена метрик:
+//   - NetBytesSent, NetBytesRecv, NetPacketsSent, NetPacketsRecv, NetErrIn, NetErrOut, NetDropIn, NetDropOut -
+//     счётчики интерфейса с меткой interface;
+//   - TCPConnections - количество TCP-соединений (IPv4 и IPv6) с меткой state,
+//     например TCPConnections{state="ESTABLISHED"}.
+package netstat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/vorotislav/alert-service/internal/collector"
+	"github.com/vorotislav/alert-service/internal/model"
+
+	"github.com/shirou/gopsutil/v3/net"
+	"go.uber.org/zap"
+)
+
+// Name имя коллектора в настройках.
+const Name = "net"
+
+// Имена собираемых метрик.
+const (
+	MetricBytesSent      = "NetBytesSent"
+	MetricBytesRecv      = "NetBytesRecv"
+	MetricPacketsSent    = "NetPacketsSent"
+	MetricPacketsRecv    = "NetPacketsRecv"
+	MetricErrIn          = "NetErrIn"
+	MetricErrOut         = "NetErrOut"
+	MetricDropIn         = "NetDropIn"
+	MetricDropOut        = "NetDropOut"
+	MetricTCPConnections = "TCPConnections"
+)
+
+// Метки экземпляров.
+const (
+	LabelInterface = "interface"
+	LabelState     = "state"
+)
+
+// TCPStates состояния TCP-соединений, по которым всегда отправляются метрики,
+// даже если соединений в этом состоянии нет.
+//
+//nolint:gochecknoglobals
+var TCPStates = []string{
+	"ESTABLISHED", "SYN_SENT", "SYN_RECV", "FIN_WAIT1", "FIN_WAIT2", "TIME_WAIT",
+	"CLOSE", "CLOSE_WAIT", "LAST_ACK", "LISTEN", "CLOSING",
+}
+
+//nolint:gochecknoglobals
+var defaultInterfaces = collector.Patterns{Exclude: []string{`^lo$`}}
+
+// Config настройки коллектора. Interfaces - фильтр по имени интерфейса (по умолчанию исключается lo),
+// Connections - считать TCP-соединения по состояниям.
+type Config struct {
+	Interfaces  collector.Patterns `json:"interfaces"`
+	Connections *bool              `json:"connections"`
+}
+
+// Collector коллектор сети.
+type Collector struct {
+	interfaces  *collector.Filter
+	connections bool
+	deltas      *collector.DeltaTracker
+
+	ioCounters      func(ctx context.Context) ([]net.IOCountersStat, error)
+	listConnections func(ctx context.Context) ([]net.ConnectionStat, error)
+}
+
+// New фабрика коллектора.
+func New(_ *zap.Logger, raw json.RawMessage) (collector.Collector, error) {
+	cfg := Config{}
+
+	if err := collector.Decode(raw, &cfg); err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	interfaces, err := cfg.Interfaces.Filter(defaultInterfaces)
+	if err != nil {
+		return nil, fmt.Errorf("interfaces: %w", err)
+	}
+
+	return &Collector{
+		interfaces:  interfaces,
+		connections: cfg.Connections == nil || *cfg.Connections,
+		deltas:      collector.NewDeltaTracker(),
+		ioCounters: func(ctx context.Context) ([]net.IOCountersStat, error) {
+			return net.IOCountersWithContext(ctx, true)
+		},
+		listConnections: func(ctx context.Context) ([]net.ConnectionStat, error) {
+			return net.ConnectionsWithoutUidsWithContext(ctx, "tcp")
+		},
+	}, nil
+}
+
+// Name возвращает имя коллектора.
+func (c *Collector) Name() string {
+	return Name
+}
+
+// Collect возвращает приращения счётчиков интерфейсов и количество TCP-соединений по состояниям.
+func (c *Collector) Collect(ctx context.Context) ([]model.Metrics, error) {
+	errs := make([]error, 0)
+
+	metrics, err := c.collectInterfaces(ctx)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	if c.connections {
+		conns, err := c.collectConnections(ctx)
+		if err != nil {
+			errs = append(errs, err)
+		}
+
+		metrics = append(metrics, conns...)
+	}
+
+	return metrics, errors.Join(errs...)
+}
+
+func (c *Collector) collectInterfaces(ctx context.Context) ([]model.Metrics, error) {
+	counters, err := c.ioCounters(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("io counters: %w", err)
+	}
+
+	now := time.Now()
+	metrics := make([]model.Metrics, 0)
+
+	for _, io := range counters {
+		if !c.interfaces.Match(io.Name) {
+			continue
+		}
+
+		labels := map[string]string{LabelInterface: io.Name}
+
+		for _, cnt := range []struct {
+			prefix string
+			value  uint64
+		}{
+			{MetricBytesSent, io.BytesSent},
+			{MetricBytesRecv, io.BytesRecv},
+			{MetricPacketsSent, io.PacketsSent},
+			{MetricPacketsRecv, io.PacketsRecv},
+			{MetricErrIn, io.Errin},
+			{MetricErrOut, io.Errout},
+			{MetricDropIn, io.Dropin},
+			{MetricDropOut, io.Dropout},
+		} {
+			if delta, _, ok := c.deltas.Delta(model.SeriesKey(cnt.prefix, labels), cnt.value, now); ok {
+				metrics = append(metrics, collector.LabeledCounter(cnt.prefix, labels, int64(delta)))
+			}
+		}
+	}
+
+	return metrics, nil
+}
+
+func (c *Collector) collectConnections(ctx context.Context) ([]model.Metrics, error) {
+	conns, err := c.listConnections(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("tcp connections: %w", err)
+	}
+
+	counts := make(map[string]int, len(TCPStates))
+	for _, s := range TCPStates {
+		counts[s] = 0
+	}
+
+	for _, conn := range conns {
+		if conn.Status == "" || conn.Status == "NONE" {
+			continue
+		}
+
+		counts[conn.Status]++
+	}
+
+	metrics := make([]model.Metrics, 0, len(counts))
+
+	for state, n := range counts {
+		metrics = append(metrics, collector.LabeledGauge(MetricTCPConnections, map[string]string{LabelState: state}, float64(n)))
+	}
+
+	return metrics, nil
+}
@@ -0,0 +1,71 @@
+package netstat
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/vorotislav/alert-service/internal/model"
+
+	"github.com/shirou/gopsutil/v3/net"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestCollector_Collect(t *testing.T) {
+	t.Parallel()
+
+	c, err := New(zap.NewNop(), json.RawMessage(`{}`))
+	require.NoError(t, err)
+
+	nc := c.(*Collector) //nolint:forcetypeassert
+
+	sent := uint64(1000)
+	nc.ioCounters = func(_ context.Context) ([]net.IOCountersStat, error) {
+		sent += 250
+
+		return []net.IOCountersStat{
+			{Name: "eth0", BytesSent: sent, Dropin: 3},
+			{Name: "lo", BytesSent: sent},
+		}, nil
+	}
+	nc.listConnections = func(_ context.Context) ([]net.ConnectionStat, error) {
+		return []net.ConnectionStat{
+			{Status: "ESTABLISHED"},
+			{Status: "ESTABLISHED"},
+			{Status: "TIME_WAIT"},
+			{Status: "LISTEN"},
+		}, nil
+	}
+
+	_, err = nc.Collect(context.Background())
+	require.NoError(t, err)
+
+	metrics, err := nc.Collect(context.Background())
+	require.NoError(t, err)
+
+	got := make(map[string]float64, len(metrics))
+
+	for _, m := range metrics {
+		switch {
+		case m.Value != nil:
+			got[m.SeriesKey()] = *m.Value
+		case m.Delta != nil:
+			got[m.SeriesKey()] = float64(*m.Delta)
+		}
+	}
+
+	eth0 := map[string]string{LabelInterface: "eth0"}
+	state := func(s string) string {
+		return model.SeriesKey(MetricTCPConnections, map[string]string{LabelState: s})
+	}
+
+	assert.Equal(t, float64(250), got[model.SeriesKey(MetricBytesSent, eth0)])
+	assert.Equal(t, float64(0), got[model.SeriesKey(MetricDropIn, eth0)])
+	assert.NotContains(t, got, model.SeriesKey(MetricBytesSent, map[string]string{LabelInterface: "lo"}))
+
+	assert.Equal(t, float64(2), got[state("ESTABLISHED")])
+	assert.Equal(t, float64(1), got[state("TIME_WAIT")])
+	assert.Equal(t, float64(0), got[state("CLOSE_WAIT")])
+}
@@ -0,0 +1,29 @@
+package collector
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+const percent = 100
+
+// Percentile возвращает перцентиль p (от 0 до 100) отсортированных по возрастанию значений
+// методом ближайшего ранга. sorted не должен быть пустым.
+func Percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p / percent * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+
+	if rank > len(sorted) {
+		rank = len(sorted)
+	}
+
+	return sorted[rank-1]
+}
+
+// PercentileSuffix возвращает суффикс имени метрики для перцентиля: 95 - "_p95", 99.9 - "_p99_9".
+func PercentileSuffix(p float64) string {
+	return "_p" + strings.ReplaceAll(strconv.FormatFloat(p, 'f', -1, 64), ".", "_")
+}
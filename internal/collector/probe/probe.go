@@ -0,0 +1,442 @@
+// Пакет probe представляет коллектор синтетических проверок: HTTP-запросов с ожидаемым
+// кодом ответа и телом и TCP-подключений (при необходимости с TLS). Каждая проверка выполняется
+// в своей горутине по собственному расписанию, не зависящему от интервала опроса агента:
+// опрос возвращает результат последней завершённой проверки.
+//
+// Имена метрик (метка target - имя проверки из настроек):
+//   - ProbeSuccess - 1, если проверка прошла, иначе 0;
+//   - ProbeLatency - длительность проверки в секундах;
+//   - ProbeStatusCode - код ответа HTTP;
+//   - ProbeTLSExpiryDays - дней до истечения сертификата, который истекает раньше других в цепочке.
+package probe
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vorotislav/alert-service/internal/collector"
+	"github.com/vorotislav/alert-service/internal/model"
+
+	"go.uber.org/zap"
+)
+
+// Name имя коллектора в настройках.
+const Name = "probe"
+
+// Имена собираемых метрик.
+const (
+	MetricSuccess       = "ProbeSuccess"
+	MetricLatency       = "ProbeLatency"
+	MetricStatusCode    = "ProbeStatusCode"
+	MetricTLSExpiryDays = "ProbeTLSExpiryDays"
+)
+
+// LabelTarget метка с именем проверки.
+const LabelTarget = "target"
+
+// Типы проверок.
+const (
+	TypeHTTP = "http"
+	TypeTCP  = "tcp"
+)
+
+const (
+	defaultInterval = 30 * time.Second
+	defaultTimeout  = 5 * time.Second
+	// maxBody сколько байт тела ответа проверяется регулярным выражением.
+	maxBody     = 1 << 20
+	hoursPerDay = 24
+)
+
+// Ошибки настройки и выполнения проверок.
+var (
+	ErrNoTargets        = errors.New("no probe targets")
+	ErrInvalidTarget    = errors.New("invalid probe target")
+	ErrUnexpectedStatus = errors.New("unexpected status code")
+	ErrUnexpectedBody   = errors.New("body does not match")
+)
+
+// Target проверка. Для http задаются URL, Method (по умолчанию GET), Body, Headers,
+// ExpectStatus (по умолчанию любой 2xx) и ExpectBody - регулярное выражение для тела ответа.
+// Для tcp задаются Address ("host:port") и TLS - выполнять ли TLS-рукопожатие.
+// Timeout - длительность в формате time.ParseDuration, по умолчанию общий для коллектора.
+type Target struct {
+	Name               string            `json:"name"`
+	Type               string            `json:"type"`
+	URL                string            `json:"url"`
+	Method             string            `json:"method"`
+	Body               string            `json:"body"`
+	Headers            map[string]string `json:"headers"`
+	ExpectStatus       []int             `json:"expect_status"`
+	ExpectBody         string            `json:"expect_body"`
+	Address            string            `json:"address"`
+	TLS                bool              `json:"tls"`
+	InsecureSkipVerify bool              `json:"insecure_skip_verify"`
+	Timeout            string            `json:"timeout"`
+}
+
+// Config настройки коллектора. Interval - интервал проверок (30s), Timeout - таймаут проверки
+// по умолчанию (5s). Таймаут больше интервала уменьшается до интервала.
+type Config struct {
+	Interval string   `json:"interval"`
+	Timeout  string   `json:"timeout"`
+	Targets  []Target `json:"targets"`
+}
+
+type target struct {
+	Target
+	timeout    time.Duration
+	expectBody *regexp.Regexp
+	client     *http.Client
+	tlsConfig  *tls.Config
+
+	mu   sync.Mutex
+	last *result
+}
+
+// result результат одной проверки.
+type result struct {
+	latency time.Duration
+	status  int
+	certs   []*x509.Certificate
+	err     error
+}
+
+// Collector коллектор проверок.
+type Collector struct {
+	log      *zap.Logger
+	interval time.Duration
+	targets  []*target
+	now      func() time.Time
+}
+
+// New фабрика коллектора.
+func New(log *zap.Logger, raw json.RawMessage) (collector.Collector, error) {
+	cfg := Config{}
+
+	if err := collector.Decode(raw, &cfg); err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	if len(cfg.Targets) == 0 {
+		return nil, ErrNoTargets
+	}
+
+	interval, err := parseTimeout(cfg.Interval, defaultInterval)
+	if err != nil {
+		return nil, fmt.Errorf("%w: interval: %w", collector.ErrInvalidConfig, err)
+	}
+
+	timeout, err := parseTimeout(cfg.Timeout, defaultTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("%w: timeout: %w", collector.ErrInvalidConfig, err)
+	}
+
+	targets := make([]*target, 0, len(cfg.Targets))
+	names := make(map[string]struct{}, len(cfg.Targets))
+
+	for i, t := range cfg.Targets {
+		tg, err := parseTarget(t, timeout, interval)
+		if err != nil {
+			return nil, fmt.Errorf("target %d: %w", i, err)
+		}
+
+		if _, ok := names[t.Name]; ok {
+			return nil, fmt.Errorf("%w: duplicate name %s", ErrInvalidTarget, t.Name)
+		}
+
+		names[t.Name] = struct{}{}
+		targets = append(targets, tg)
+	}
+
+	return &Collector{
+		log:      log,
+		interval: interval,
+		targets:  targets,
+		now:      time.Now,
+	}, nil
+}
+
+func parseTarget(t Target, def, interval time.Duration) (*target, error) {
+	if t.Name == "" {
+		return nil, fmt.Errorf("%w: empty name", ErrInvalidTarget)
+	}
+
+	timeout, err := parseTimeout(t.Timeout, def)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: timeout: %w", ErrInvalidTarget, t.Name, err)
+	}
+
+	// Следующая проверка не начнётся, пока не закончилась предыдущая, поэтому таймаут больше интервала
+	// сдвигал бы расписание.
+	if timeout > interval {
+		timeout = interval
+	}
+
+	tg := &target{
+		Target:  t,
+		timeout: timeout,
+		//nolint:gosec // проверка сертификата отключается только явно в настройках.
+		tlsConfig: &tls.Config{InsecureSkipVerify: t.InsecureSkipVerify},
+	}
+
+	switch t.Type {
+	case TypeHTTP:
+		if t.URL == "" {
+			return nil, fmt.Errorf("%w: %s: empty url", ErrInvalidTarget, t.Name)
+		}
+
+		if t.Method == "" {
+			tg.Method = http.MethodGet
+		}
+
+		if t.ExpectBody != "" {
+			tg.expectBody, err = regexp.Compile(t.ExpectBody)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s: expect_body: %w", ErrInvalidTarget, t.Name, err)
+			}
+		}
+
+		transport := http.DefaultTransport.(*http.Transport).Clone() //nolint:forcetypeassert
+		transport.TLSClientConfig = tg.tlsConfig
+		// Каждая проверка - новое подключение, иначе задержка не учитывала бы установку соединения.
+		transport.DisableKeepAlives = true
+
+		tg.client = &http.Client{Transport: transport}
+	case TypeTCP:
+		if _, _, err := net.SplitHostPort(t.Address); err != nil {
+			return nil, fmt.Errorf("%w: %s: address: %w", ErrInvalidTarget, t.Name, err)
+		}
+	default:
+		return nil, fmt.Errorf("%w: %s: unknown type %q", ErrInvalidTarget, t.Name, t.Type)
+	}
+
+	return tg, nil
+}
+
+func parseTimeout(raw string, def time.Duration) (time.Duration, error) {
+	if raw == "" {
+		return def, nil
+	}
+
+	d, err := time.ParseDuration(raw)
+	if err != nil {
+		return 0, err //nolint:wrapcheck
+	}
+
+	if d <= 0 {
+		return 0, fmt.Errorf("must be positive, got %s", raw) //nolint:goerr113
+	}
+
+	return d, nil
+}
+
+// Name возвращает имя коллектора.
+func (c *Collector) Name() string {
+	return Name
+}
+
+// Start запускает каждую проверку в отдельной горутине: сразу и затем с интервалом коллектора.
+// Проверки ограничены только своим таймаутом и останавливаются с отменой ctx.
+func (c *Collector) Start(ctx context.Context) error {
+	for _, t := range c.targets {
+		go c.loop(ctx, t)
+	}
+
+	return nil
+}
+
+func (c *Collector) loop(ctx context.Context, t *target) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		c.run(ctx, t)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// run выполняет проверку один раз и запоминает результат.
+func (c *Collector) run(ctx context.Context, t *target) {
+	res := t.probe(ctx)
+
+	// Агент останавливается: это не сбой проверки.
+	if ctx.Err() != nil {
+		return
+	}
+
+	if res.err != nil {
+		c.log.Info("probe failed", zap.String("target", t.Name), zap.Error(res.err))
+	}
+
+	t.mu.Lock()
+	t.last = &res
+	t.mu.Unlock()
+}
+
+// Collect возвращает результаты последних завершённых проверок. Неудачная проверка - это метрика
+// ProbeSuccess, равная 0, а не ошибка коллектора; причина пишется в журнал при проверке.
+func (c *Collector) Collect(_ context.Context) ([]model.Metrics, error) {
+	now := c.now()
+	metrics := make([]model.Metrics, 0)
+
+	for _, t := range c.targets {
+		t.mu.Lock()
+		last := t.last
+		t.mu.Unlock()
+
+		if last == nil {
+			continue
+		}
+
+		res := *last
+		labels := map[string]string{LabelTarget: t.Name}
+
+		success := 1.0
+		if res.err != nil {
+			success = 0
+		}
+
+		metrics = append(metrics,
+			collector.LabeledGauge(MetricSuccess, labels, success),
+			collector.LabeledGauge(MetricLatency, labels, res.latency.Seconds()),
+		)
+
+		if res.status != 0 {
+			metrics = append(metrics, collector.LabeledGauge(MetricStatusCode, labels, float64(res.status)))
+		}
+
+		if expiry, ok := earliestExpiry(res.certs); ok {
+			metrics = append(metrics, collector.LabeledGauge(MetricTLSExpiryDays, labels, expiry.Sub(now).Hours()/hoursPerDay))
+		}
+	}
+
+	return metrics, nil
+}
+
+func (t *target) probe(ctx context.Context) result {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+
+	start := time.Now()
+
+	var res result
+
+	if t.Type == TypeHTTP {
+		res = t.probeHTTP(ctx)
+	} else {
+		res = t.probeTCP(ctx)
+	}
+
+	res.latency = time.Since(start)
+
+	return res
+}
+
+func (t *target) probeHTTP(ctx context.Context) result {
+	req, err := http.NewRequestWithContext(ctx, t.Method, t.URL, strings.NewReader(t.Body))
+	if err != nil {
+		return result{err: fmt.Errorf("create request: %w", err)}
+	}
+
+	for k, v := range t.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return result{err: err} //nolint:wrapcheck
+	}
+
+	defer resp.Body.Close()
+
+	res := result{status: resp.StatusCode}
+	if resp.TLS != nil {
+		res.certs = resp.TLS.PeerCertificates
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBody))
+	if err != nil {
+		res.err = fmt.Errorf("read body: %w", err)
+
+		return res
+	}
+
+	switch {
+	case !t.statusOK(resp.StatusCode):
+		res.err = fmt.Errorf("%w: %d", ErrUnexpectedStatus, resp.StatusCode)
+	case t.expectBody != nil && !t.expectBody.Match(body):
+		res.err = fmt.Errorf("%w: %s", ErrUnexpectedBody, t.ExpectBody)
+	}
+
+	return res
+}
+
+func (t *target) statusOK(code int) bool {
+	if len(t.ExpectStatus) == 0 {
+		return code >= http.StatusOK && code < http.StatusMultipleChoices
+	}
+
+	for _, s := range t.ExpectStatus {
+		if s == code {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (t *target) probeTCP(ctx context.Context) result {
+	var d net.Dialer
+
+	conn, err := d.DialContext(ctx, "tcp", t.Address)
+	if err != nil {
+		return result{err: err} //nolint:wrapcheck
+	}
+
+	defer conn.Close()
+
+	if !t.TLS {
+		return result{}
+	}
+
+	host, _, _ := net.SplitHostPort(t.Address)
+
+	cfg := t.tlsConfig.Clone()
+	cfg.ServerName = host
+
+	tc := tls.Client(conn, cfg)
+	if err := tc.HandshakeContext(ctx); err != nil {
+		return result{err: fmt.Errorf("tls handshake: %w", err)}
+	}
+
+	return result{certs: tc.ConnectionState().PeerCertificates}
+}
+
+func earliestExpiry(certs []*x509.Certificate) (time.Time, bool) {
+	var earliest time.Time
+
+	for _, c := range certs {
+		if earliest.IsZero() || c.NotAfter.Before(earliest) {
+			earliest = c.NotAfter
+		}
+	}
+
+	return earliest, !earliest.IsZero()
+}
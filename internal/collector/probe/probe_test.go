@@ -0,0 +1,231 @@
+package probe
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vorotislav/alert-service/internal/collector"
+	"github.com/vorotislav/alert-service/internal/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// series возвращает ключ серии метрики проверки.
+func series(name, target string) string {
+	return model.SeriesKey(name, map[string]string{LabelTarget: target})
+}
+
+func collect(t *testing.T, targets ...Target) map[string]float64 {
+	t.Helper()
+
+	raw, err := json.Marshal(Config{Timeout: "2s", Targets: targets})
+	require.NoError(t, err)
+
+	c, err := New(zap.NewNop(), raw)
+	require.NoError(t, err)
+
+	pc := c.(*Collector) //nolint:forcetypeassert
+
+	var wg sync.WaitGroup
+
+	for _, tg := range pc.targets {
+		wg.Add(1)
+
+		go func(tg *target) {
+			defer wg.Done()
+
+			pc.run(context.Background(), tg)
+		}(tg)
+	}
+
+	wg.Wait()
+
+	metrics, err := c.Collect(context.Background())
+	require.NoError(t, err)
+
+	got := make(map[string]float64, len(metrics))
+
+	for _, m := range metrics {
+		got[m.SeriesKey()] = *m.Value
+	}
+
+	return got
+}
+
+func TestCollector_HTTP(t *testing.T) {
+	t.Parallel()
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/health":
+			_, _ = w.Write([]byte(`{"status":"ok"}`))
+		case "/login":
+			if r.Method != http.MethodPost || r.Header.Get("X-Probe") != "1" {
+				w.WriteHeader(http.StatusBadRequest)
+
+				return
+			}
+
+			w.WriteHeader(http.StatusUnauthorized)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	tlsSrv := httptest.NewTLSServer(handler)
+	defer tlsSrv.Close()
+
+	got := collect(t,
+		Target{Name: "health", Type: TypeHTTP, URL: srv.URL + "/health", ExpectBody: `"status":"ok"`},
+		Target{Name: "wrong-body", Type: TypeHTTP, URL: srv.URL + "/health", ExpectBody: `"status":"down"`},
+		Target{Name: "missing", Type: TypeHTTP, URL: srv.URL + "/missing"},
+		Target{
+			Name:         "login",
+			Type:         TypeHTTP,
+			URL:          srv.URL + "/login",
+			Method:       http.MethodPost,
+			Body:         `{"user":"probe"}`,
+			Headers:      map[string]string{"X-Probe": "1"},
+			ExpectStatus: []int{http.StatusUnauthorized},
+		},
+		Target{Name: "tls", Type: TypeHTTP, URL: tlsSrv.URL + "/health", InsecureSkipVerify: true},
+		Target{Name: "tls-verify", Type: TypeHTTP, URL: tlsSrv.URL + "/health"},
+	)
+
+	assert.Equal(t, float64(1), got[series(MetricSuccess, "health")])
+	assert.Equal(t, float64(200), got[series(MetricStatusCode, "health")])
+	assert.Contains(t, got, series(MetricLatency, "health"))
+	assert.NotContains(t, got, series(MetricTLSExpiryDays, "health"))
+
+	assert.Equal(t, float64(0), got[series(MetricSuccess, "wrong-body")])
+	assert.Equal(t, float64(0), got[series(MetricSuccess, "missing")])
+	assert.Equal(t, float64(404), got[series(MetricStatusCode, "missing")])
+	assert.Equal(t, float64(1), got[series(MetricSuccess, "login")])
+
+	assert.Equal(t, float64(1), got[series(MetricSuccess, "tls")])
+	assert.Greater(t, got[series(MetricTLSExpiryDays, "tls")], float64(0))
+
+	// Сертификат тестового сервера самоподписанный.
+	assert.Equal(t, float64(0), got[series(MetricSuccess, "tls-verify")])
+	assert.NotContains(t, got, series(MetricStatusCode, "tls-verify"))
+}
+
+func TestCollector_TCP(t *testing.T) {
+	t.Parallel()
+
+	tlsSrv := httptest.NewTLSServer(http.NotFoundHandler())
+	defer tlsSrv.Close()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	closed := l.Addr().String()
+	require.NoError(t, l.Close())
+
+	addr := strings.TrimPrefix(tlsSrv.URL, "https://")
+
+	got := collect(t,
+		Target{Name: "open", Type: TypeTCP, Address: addr},
+		Target{Name: "closed", Type: TypeTCP, Address: closed},
+		Target{Name: "tls", Type: TypeTCP, Address: addr, TLS: true, InsecureSkipVerify: true},
+	)
+
+	assert.Equal(t, float64(1), got[series(MetricSuccess, "open")])
+	assert.NotContains(t, got, series(MetricTLSExpiryDays, "open"))
+	assert.Equal(t, float64(0), got[series(MetricSuccess, "closed")])
+	assert.Equal(t, float64(1), got[series(MetricSuccess, "tls")])
+	assert.Greater(t, got[series(MetricTLSExpiryDays, "tls")], float64(0))
+}
+
+func TestCollector_Start(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer srv.Close()
+
+	raw, err := json.Marshal(Config{
+		Interval: "1h",
+		Targets:  []Target{{Name: "slow", Type: TypeHTTP, URL: srv.URL, Timeout: "2s"}},
+	})
+	require.NoError(t, err)
+
+	c, err := New(zap.NewNop(), raw)
+	require.NoError(t, err)
+
+	// До первой завершённой проверки метрик нет.
+	metrics, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, metrics)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s, ok := c.(collector.Starter)
+	require.True(t, ok)
+	require.NoError(t, s.Start(ctx))
+
+	// Проверка не зависит от контекста опроса: он может истечь раньше, чем ответит цель.
+	collectCtx, collectCancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer collectCancel()
+
+	require.Eventually(t, func() bool {
+		metrics, err := c.Collect(collectCtx)
+
+		return err == nil && len(metrics) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	metrics, err = c.Collect(collectCtx)
+	require.NoError(t, err)
+	assert.Equal(t, series(MetricSuccess, "slow"), metrics[0].SeriesKey())
+	assert.Equal(t, float64(1), *metrics[0].Value)
+}
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		cfg  string
+		err  error
+	}{
+		{name: "no targets", cfg: `{}`, err: ErrNoTargets},
+		{name: "unknown type", cfg: `{"targets":[{"name":"a","type":"icmp"}]}`, err: ErrInvalidTarget},
+		{name: "no url", cfg: `{"targets":[{"name":"a","type":"http"}]}`, err: ErrInvalidTarget},
+		{name: "bad address", cfg: `{"targets":[{"name":"a","type":"tcp","address":"db"}]}`, err: ErrInvalidTarget},
+		{
+			name: "bad interval",
+			cfg:  `{"interval":"0s","targets":[{"name":"a","type":"tcp","address":"db:1"}]}`,
+			err:  collector.ErrInvalidConfig,
+		},
+		{
+			name: "bad timeout",
+			cfg:  `{"timeout":"-1s","targets":[{"name":"a","type":"tcp","address":"db:1"}]}`,
+			err:  collector.ErrInvalidConfig,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := New(zap.NewNop(), json.RawMessage(tc.cfg))
+			require.ErrorIs(t, err, tc.err)
+		})
+	}
+}
@@ -0,0 +1,399 @@
+// Пакет process представляет коллектор, который следит за заданными процессами (сервисами).
+// Процесс ищется по имени исполняемого файла, регулярному выражению для командной строки или pid-файлу.
+//
+// Имена метрик (метка process - имя цели из настроек):
+//   - ProcessUp - 1, если найден хотя бы один процесс, иначе 0;
+//   - ProcessCount - количество найденных процессов;
+//   - ProcessCPUPercent - загрузка процессора с предыдущего опроса в процентах одного ядра;
+//   - ProcessRSS - резидентная память в байтах;
+//   - ProcessFDs - открытые файловые дескрипторы;
+//   - ProcessThreads - потоки;
+//   - ProcessUptime - время работы самого старого процесса в секундах.
+//
+// Если под цель подходят несколько процессов, значения суммируются.
+package process
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vorotislav/alert-service/internal/collector"
+	"github.com/vorotislav/alert-service/internal/model"
+
+	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/shirou/gopsutil/v3/process"
+	"go.uber.org/zap"
+)
+
+// Name имя коллектора в настройках.
+const Name = "process"
+
+// Имена собираемых метрик.
+const (
+	MetricUp         = "ProcessUp"
+	MetricCount      = "ProcessCount"
+	MetricCPUPercent = "ProcessCPUPercent"
+	MetricRSS        = "ProcessRSS"
+	MetricFDs        = "ProcessFDs"
+	MetricThreads    = "ProcessThreads"
+	MetricUptime     = "ProcessUptime"
+)
+
+// LabelProcess метка с именем цели.
+const LabelProcess = "process"
+
+const percent = 100
+
+// Ошибки настройки целей.
+var (
+	ErrNoTargets     = errors.New("no process targets")
+	ErrInvalidTarget = errors.New("invalid process target")
+)
+
+// Target цель наблюдения. Name - метка в именах метрик. Должен быть задан ровно один способ поиска:
+// ProcessName - точное имя исполняемого файла, Cmdline - регулярное выражение для командной строки,
+// Pidfile - файл с pid процесса.
+type Target struct {
+	Name        string `json:"name"`
+	ProcessName string `json:"process_name"`
+	Cmdline     string `json:"cmdline"`
+	Pidfile     string `json:"pidfile"`
+}
+
+// Config настройки коллектора.
+type Config struct {
+	Targets []Target `json:"targets"`
+}
+
+// proc часть *process.Process, которая нужна коллектору.
+type proc interface {
+	NameWithContext(ctx context.Context) (string, error)
+	CmdlineWithContext(ctx context.Context) (string, error)
+	CreateTimeWithContext(ctx context.Context) (int64, error)
+	TimesWithContext(ctx context.Context) (*cpu.TimesStat, error)
+	MemoryInfoWithContext(ctx context.Context) (*process.MemoryInfoStat, error)
+	NumFDsWithContext(ctx context.Context) (int32, error)
+	NumThreadsWithContext(ctx context.Context) (int32, error)
+}
+
+type target struct {
+	Target
+	cmdline *regexp.Regexp
+}
+
+// cpuSample предыдущий замер времени процессора процесса. Процесс определяется парой pid и времени запуска,
+// чтобы не спутать его с новым процессом, получившим тот же pid.
+type cpuSample struct {
+	seconds float64
+	at      time.Time
+}
+
+type procKey struct {
+	pid     int32
+	created int64
+}
+
+// Collector коллектор процессов.
+type Collector struct {
+	log     *zap.Logger
+	targets []target
+	now     func() time.Time
+
+	mu   sync.Mutex
+	prev map[procKey]cpuSample
+
+	list  func(ctx context.Context) (map[int32]proc, error)
+	byPid func(ctx context.Context, pid int32) (proc, error)
+}
+
+// New фабрика коллектора.
+func New(log *zap.Logger, raw json.RawMessage) (collector.Collector, error) {
+	cfg := Config{}
+
+	if err := collector.Decode(raw, &cfg); err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	if len(cfg.Targets) == 0 {
+		return nil, ErrNoTargets
+	}
+
+	targets := make([]target, 0, len(cfg.Targets))
+
+	for i, t := range cfg.Targets {
+		tg, err := parseTarget(t)
+		if err != nil {
+			return nil, fmt.Errorf("target %d: %w", i, err)
+		}
+
+		targets = append(targets, tg)
+	}
+
+	return &Collector{
+		log:     log,
+		targets: targets,
+		now:     time.Now,
+		prev:    make(map[procKey]cpuSample),
+		list:    listProcesses,
+		byPid: func(ctx context.Context, pid int32) (proc, error) {
+			return process.NewProcessWithContext(ctx, pid)
+		},
+	}, nil
+}
+
+func parseTarget(t Target) (target, error) {
+	if t.Name == "" {
+		return target{}, fmt.Errorf("%w: empty name", ErrInvalidTarget)
+	}
+
+	matchers := 0
+
+	for _, m := range []string{t.ProcessName, t.Cmdline, t.Pidfile} {
+		if m != "" {
+			matchers++
+		}
+	}
+
+	if matchers != 1 {
+		return target{}, fmt.Errorf("%w: %s: exactly one of process_name, cmdline and pidfile is required",
+			ErrInvalidTarget, t.Name)
+	}
+
+	tg := target{Target: t}
+
+	if t.Cmdline != "" {
+		re, err := regexp.Compile(t.Cmdline)
+		if err != nil {
+			return target{}, fmt.Errorf("%w: %s: %w", ErrInvalidTarget, t.Name, err)
+		}
+
+		tg.cmdline = re
+	}
+
+	return tg, nil
+}
+
+func listProcesses(ctx context.Context) (map[int32]proc, error) {
+	ps, err := process.ProcessesWithContext(ctx)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	res := make(map[int32]proc, len(ps))
+	for _, p := range ps {
+		res[p.Pid] = p
+	}
+
+	return res, nil
+}
+
+// Name возвращает имя коллектора.
+func (c *Collector) Name() string {
+	return Name
+}
+
+// Collect находит процессы каждой цели и возвращает их метрики.
+func (c *Collector) Collect(ctx context.Context) ([]model.Metrics, error) {
+	var (
+		all     map[int32]proc
+		listErr error
+		listed  bool
+	)
+
+	metrics := make([]model.Metrics, 0)
+	errs := make([]error, 0)
+	now := c.now()
+	seen := make(map[procKey]struct{})
+
+	for _, t := range c.targets {
+		var (
+			found map[int32]proc
+			err   error
+		)
+
+		if t.Pidfile != "" {
+			found, err = c.fromPidfile(ctx, t.Pidfile)
+		} else {
+			if !listed {
+				all, listErr = c.list(ctx)
+				listed = true
+			}
+
+			found, err = c.match(ctx, t, all), listErr
+		}
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("target %s: %w", t.Name, err))
+
+			continue
+		}
+
+		metrics = append(metrics, c.collectTarget(ctx, t.Name, found, now, seen)...)
+	}
+
+	c.forget(seen)
+
+	return metrics, errors.Join(errs...)
+}
+
+func (c *Collector) fromPidfile(ctx context.Context, path string) (map[int32]proc, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil //nolint:nilnil
+		}
+
+		return nil, fmt.Errorf("read pidfile: %w", err)
+	}
+
+	pid, err := strconv.ParseInt(strings.TrimSpace(string(raw)), 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("parse pidfile: %w", err)
+	}
+
+	p, err := c.byPid(ctx, int32(pid))
+	if err != nil {
+		// Процесса из pid-файла больше нет: это не ошибка, а упавший сервис.
+		return nil, nil //nolint:nilerr
+	}
+
+	return map[int32]proc{int32(pid): p}, nil
+}
+
+func (c *Collector) match(ctx context.Context, t target, all map[int32]proc) map[int32]proc {
+	found := make(map[int32]proc)
+
+	for pid, p := range all {
+		if t.ProcessName != "" {
+			name, err := p.NameWithContext(ctx)
+			if err == nil && name == t.ProcessName {
+				found[pid] = p
+			}
+
+			continue
+		}
+
+		cmdline, err := p.CmdlineWithContext(ctx)
+		if err == nil && cmdline != "" && t.cmdline.MatchString(cmdline) {
+			found[pid] = p
+		}
+	}
+
+	return found
+}
+
+func (c *Collector) collectTarget(
+	ctx context.Context,
+	name string,
+	found map[int32]proc,
+	now time.Time,
+	seen map[procKey]struct{},
+) []model.Metrics {
+	var (
+		count, fds, threads int
+		rss                 uint64
+		cpuPercent          float64
+		oldest              int64
+	)
+
+	for pid, p := range found {
+		created, err := p.CreateTimeWithContext(ctx)
+		if err != nil {
+			// Процесс завершился между поиском и опросом.
+			continue
+		}
+
+		count++
+
+		if oldest == 0 || created < oldest {
+			oldest = created
+		}
+
+		if mi, err := p.MemoryInfoWithContext(ctx); err == nil {
+			rss += mi.RSS
+		}
+
+		if n, err := p.NumFDsWithContext(ctx); err == nil {
+			fds += int(n)
+		}
+
+		if n, err := p.NumThreadsWithContext(ctx); err == nil {
+			threads += int(n)
+		}
+
+		if times, err := p.TimesWithContext(ctx); err == nil {
+			key := procKey{pid: pid, created: created}
+			seen[key] = struct{}{}
+			cpuPercent += c.cpuPercent(key, times.User+times.System, now)
+		}
+	}
+
+	up := 0.0
+	if count > 0 {
+		up = 1
+	}
+
+	labels := map[string]string{LabelProcess: name}
+
+	metrics := []model.Metrics{
+		collector.LabeledGauge(MetricUp, labels, up),
+		collector.LabeledGauge(MetricCount, labels, float64(count)),
+	}
+
+	if count == 0 {
+		return metrics
+	}
+
+	uptime := now.Sub(time.UnixMilli(oldest)).Seconds()
+	if uptime < 0 {
+		uptime = 0
+	}
+
+	return append(metrics,
+		collector.LabeledGauge(MetricCPUPercent, labels, cpuPercent),
+		collector.LabeledGauge(MetricRSS, labels, float64(rss)),
+		collector.LabeledGauge(MetricFDs, labels, float64(fds)),
+		collector.LabeledGauge(MetricThreads, labels, float64(threads)),
+		collector.LabeledGauge(MetricUptime, labels, uptime),
+	)
+}
+
+// cpuPercent возвращает загрузку процессора процессом с предыдущего замера. Для нового процесса возвращает 0.
+func (c *Collector) cpuPercent(key procKey, seconds float64, now time.Time) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	prev, ok := c.prev[key]
+	c.prev[key] = cpuSample{seconds: seconds, at: now}
+
+	if !ok {
+		return 0
+	}
+
+	elapsed := now.Sub(prev.at).Seconds()
+	if elapsed <= 0 || seconds < prev.seconds {
+		return 0
+	}
+
+	return (seconds - prev.seconds) / elapsed * percent
+}
+
+// forget удаляет замеры процессов, которые больше не наблюдаются.
+func (c *Collector) forget(seen map[procKey]struct{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key := range c.prev {
+		if _, ok := seen[key]; !ok {
+			delete(c.prev, key)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package process
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/vorotislav/alert-service/internal/model"
+
+	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/shirou/gopsutil/v3/process"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+var errGone = errors.New("process gone")
+
+// series возвращает ключ серии метрики цели.
+func series(name, target string) string {
+	return model.SeriesKey(name, map[string]string{LabelProcess: target})
+}
+
+type fakeProc struct {
+	name    string
+	cmdline string
+	created int64
+	cpu     float64
+	rss     uint64
+	fds     int32
+	threads int32
+}
+
+func (p *fakeProc) NameWithContext(_ context.Context) (string, error)    { return p.name, nil }
+func (p *fakeProc) CmdlineWithContext(_ context.Context) (string, error) { return p.cmdline, nil }
+func (p *fakeProc) CreateTimeWithContext(_ context.Context) (int64, error) {
+	return p.created, nil
+}
+
+func (p *fakeProc) TimesWithContext(_ context.Context) (*cpu.TimesStat, error) {
+	return &cpu.TimesStat{User: p.cpu}, nil
+}
+
+func (p *fakeProc) MemoryInfoWithContext(_ context.Context) (*process.MemoryInfoStat, error) {
+	return &process.MemoryInfoStat{RSS: p.rss}, nil
+}
+
+func (p *fakeProc) NumFDsWithContext(_ context.Context) (int32, error)     { return p.fds, nil }
+func (p *fakeProc) NumThreadsWithContext(_ context.Context) (int32, error) { return p.threads, nil }
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		cfg     string
+		wantErr error
+	}{
+		{name: "no targets", cfg: `{}`, wantErr: ErrNoTargets},
+		{name: "no name", cfg: `{"targets": [{"process_name": "nginx"}]}`, wantErr: ErrInvalidTarget},
+		{name: "two matchers", cfg: `{"targets": [{"name": "n", "process_name": "nginx", "pidfile": "/run/n.pid"}]}`,
+			wantErr: ErrInvalidTarget},
+		{name: "bad regexp", cfg: `{"targets": [{"name": "n", "cmdline": "("}]}`, wantErr: ErrInvalidTarget},
+		{name: "success", cfg: `{"targets": [{"name": "n", "cmdline": "nginx: master"}]}`},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := New(zap.NewNop(), json.RawMessage(tc.cfg))
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+
+				return
+			}
+
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestCollector_Collect(t *testing.T) {
+	t.Parallel()
+
+	pidfile := filepath.Join(t.TempDir(), "db.pid")
+	require.NoError(t, os.WriteFile(pidfile, []byte("300\n"), 0o600))
+
+	cfg := `{"targets": [
+		{"name": "web", "process_name": "nginx"},
+		{"name": "worker", "cmdline": "python .*worker\\.py"},
+		{"name": "db", "pidfile": "` + pidfile + `"}
+	]}`
+
+	c, err := New(zap.NewNop(), json.RawMessage(cfg))
+	require.NoError(t, err)
+
+	pc := c.(*Collector) //nolint:forcetypeassert
+
+	now := time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+	started := now.Add(-time.Hour).UnixMilli()
+
+	web1 := &fakeProc{name: "nginx", created: started, rss: 100, fds: 10, threads: 1, cpu: 10}
+	web2 := &fakeProc{name: "nginx", created: started + 1000, rss: 50, fds: 5, threads: 2, cpu: 5}
+	worker := &fakeProc{name: "python3", cmdline: "python /srv/worker.py", created: started}
+	db := &fakeProc{name: "postgres", created: started}
+
+	procs := map[int32]proc{100: web1, 101: web2, 200: worker}
+	dbAlive := true
+
+	pc.now = func() time.Time { return now }
+	pc.list = func(_ context.Context) (map[int32]proc, error) { return procs, nil }
+	pc.byPid = func(_ context.Context, pid int32) (proc, error) {
+		if pid != 300 || !dbAlive {
+			return nil, errGone
+		}
+
+		return db, nil
+	}
+
+	collect := func() map[string]float64 {
+		metrics, err := pc.Collect(context.Background())
+		require.NoError(t, err)
+
+		got := make(map[string]float64, len(metrics))
+		for _, m := range metrics {
+			got[m.SeriesKey()] = *m.Value
+		}
+
+		return got
+	}
+
+	got := collect()
+	assert.Equal(t, float64(1), got[series(MetricUp, "web")])
+	assert.Equal(t, float64(2), got[series(MetricCount, "web")])
+	assert.Equal(t, float64(150), got[series(MetricRSS, "web")])
+	assert.Equal(t, float64(15), got[series(MetricFDs, "web")])
+	assert.Equal(t, float64(3), got[series(MetricThreads, "web")])
+	assert.Equal(t, float64(3600), got[series(MetricUptime, "web")])
+	assert.Equal(t, float64(1), got[series(MetricUp, "worker")])
+	assert.Equal(t, float64(1), got[series(MetricUp, "db")])
+
+	now = now.Add(10 * time.Second)
+	web1.cpu += 5
+	web2.cpu += 1
+	delete(procs, 200)
+	dbAlive = false
+
+	got = collect()
+	assert.InDelta(t, 60.0, got[series(MetricCPUPercent, "web")], 1e-9)
+	assert.Equal(t, float64(0), got[series(MetricUp, "worker")])
+	assert.NotContains(t, got, series(MetricRSS, "worker"))
+	assert.Equal(t, float64(0), got[series(MetricUp, "db")])
+}
@@ -0,0 +1,321 @@
+// Пакет push представляет коллектор, который принимает метрики от приложений на той же машине
+// по HTTP (на localhost или Unix-сокете) в формате JSON-API сервера: POST /update/ - одна
+// model.Metrics, POST /updates/ - массив. Принятые метрики отправляются на сервер вместе
+// с собственными метриками агента, с его подписью, шифрованием и повторами, поэтому приложениям
+// не нужны ключи сервера.
+//
+// Счётчики от приложений суммируются до ближайшего опроса агента, для gauge берётся последнее значение.
+package push
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/vorotislav/alert-service/internal/collector"
+	"github.com/vorotislav/alert-service/internal/http/middlewares"
+	"github.com/vorotislav/alert-service/internal/model"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// Name имя коллектора в настройках.
+const Name = "push"
+
+const (
+	defaultAddress    = "127.0.0.1:8081"
+	defaultMaxMetrics = 10000
+	maxBodySize       = 1 << 20
+
+	jsonContentType          = "application/json"
+	defaultReadHeaderTimeout = time.Second
+	shutdownTimeout          = 5 * time.Second
+)
+
+// Ошибки настройки и приёма метрик.
+var (
+	ErrNoListeners     = errors.New("no push listeners")
+	ErrTooManyMetrics  = errors.New("too many pending metrics")
+	errUnknownContType = errors.New("unknown Content-Type")
+)
+
+// Config настройки коллектора. Address - TCP-адрес (по умолчанию "127.0.0.1:8081", "-" отключает приём по TCP),
+// Unix - путь к Unix-сокету (по умолчанию не используется), MaxMetrics - сколько разных метрик может
+// накопиться до опроса агента (по умолчанию 10000); сверх этого запросы отклоняются с кодом 429.
+type Config struct {
+	Address    string `json:"address"`
+	Unix       string `json:"unix"`
+	MaxMetrics int    `json:"max_metrics"`
+}
+
+// Collector коллектор метрик от приложений.
+type Collector struct {
+	log        *zap.Logger
+	address    string
+	unix       string
+	maxMetrics int
+	handler    http.Handler
+
+	listeners []net.Listener
+
+	mu sync.Mutex
+	// pending принятые метрики по ключу серии.
+	pending map[string]model.Metrics
+}
+
+// New фабрика коллектора.
+func New(log *zap.Logger, raw json.RawMessage) (collector.Collector, error) {
+	cfg := Config{
+		Address:    defaultAddress,
+		MaxMetrics: defaultMaxMetrics,
+	}
+
+	if err := collector.Decode(raw, &cfg); err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	if cfg.Address == "-" {
+		cfg.Address = ""
+	}
+
+	if cfg.Address == "" && cfg.Unix == "" {
+		return nil, ErrNoListeners
+	}
+
+	if cfg.MaxMetrics <= 0 {
+		return nil, fmt.Errorf("%w: max_metrics must be positive", collector.ErrInvalidConfig)
+	}
+
+	c := &Collector{
+		log:        log,
+		address:    cfg.Address,
+		unix:       cfg.Unix,
+		maxMetrics: cfg.MaxMetrics,
+		pending:    make(map[string]model.Metrics),
+	}
+
+	r := chi.NewRouter()
+	r.Use(middlewares.CompressMiddleware)
+
+	r.Route("/updates", func(r chi.Router) {
+		r.Post("/", c.updates)
+	})
+	r.Route("/update", func(r chi.Router) {
+		r.Post("/", c.update)
+	})
+
+	c.handler = r
+
+	return c, nil
+}
+
+// Name возвращает имя коллектора.
+func (c *Collector) Name() string {
+	return Name
+}
+
+// Start открывает сокеты и запускает HTTP-сервер. Сервер останавливается с отменой ctx.
+func (c *Collector) Start(ctx context.Context) error {
+	if c.address != "" {
+		l, err := net.Listen("tcp", c.address)
+		if err != nil {
+			return fmt.Errorf("listen tcp: %w", err)
+		}
+
+		c.listeners = append(c.listeners, l)
+	}
+
+	if c.unix != "" {
+		if err := os.Remove(c.unix); err != nil && !errors.Is(err, os.ErrNotExist) {
+			c.closeListeners()
+
+			return fmt.Errorf("remove stale socket: %w", err)
+		}
+
+		l, err := net.Listen("unix", c.unix)
+		if err != nil {
+			c.closeListeners()
+
+			return fmt.Errorf("listen unix: %w", err)
+		}
+
+		c.listeners = append(c.listeners, l)
+	}
+
+	srv := &http.Server{
+		Handler:           c.handler,
+		ReadHeaderTimeout: defaultReadHeaderTimeout,
+	}
+
+	for _, l := range c.listeners {
+		c.log.Info("push listener started", zap.String("address", l.Addr().String()))
+
+		go func(l net.Listener) {
+			if err := srv.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				c.log.Error("push server", zap.Error(err))
+			}
+		}(l)
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			c.log.Error("push server shutdown", zap.Error(err))
+		}
+
+		if c.unix != "" {
+			_ = os.Remove(c.unix)
+		}
+	}()
+
+	return nil
+}
+
+func (c *Collector) closeListeners() {
+	for _, l := range c.listeners {
+		_ = l.Close()
+	}
+
+	c.listeners = nil
+}
+
+// Collect возвращает метрики, принятые с предыдущего опроса.
+func (c *Collector) Collect(_ context.Context) ([]model.Metrics, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	metrics := make([]model.Metrics, 0, len(c.pending))
+	for _, m := range c.pending {
+		metrics = append(metrics, m)
+	}
+
+	c.pending = make(map[string]model.Metrics)
+
+	return metrics, nil
+}
+
+// add добавляет метрики к накопленным. Пакет принимается целиком или не принимается.
+func (c *Collector) add(metrics []model.Metrics) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	added := 0
+
+	for _, m := range metrics {
+		if _, ok := c.pending[m.SeriesKey()]; !ok {
+			added++
+		}
+	}
+
+	if len(c.pending)+added > c.maxMetrics {
+		return ErrTooManyMetrics
+	}
+
+	for _, m := range metrics {
+		key := m.SeriesKey()
+
+		cur, ok := c.pending[key]
+		if ok && cur.MType == model.MetricCounter && m.MType == model.MetricCounter {
+			*cur.Delta += *m.Delta
+
+			continue
+		}
+
+		c.pending[key] = m.Clone()
+	}
+
+	return nil
+}
+
+// update обработчик для POST /update/: одна метрика.
+func (c *Collector) update(w http.ResponseWriter, r *http.Request) {
+	m := model.Metrics{}
+
+	if err := decode(w, r, &m); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	if err := m.Validate(); err != nil {
+		http.Error(w, fmt.Sprintf("invalid metric: %s", err.Error()), http.StatusBadRequest)
+
+		return
+	}
+
+	c.accept(w, []model.Metrics{m})
+}
+
+// updates обработчик для POST /updates/: массив метрик. При ошибках проверки, как и сервер,
+// возвращает список отклонённых метрик.
+func (c *Collector) updates(w http.ResponseWriter, r *http.Request) {
+	metrics := make([]model.Metrics, 0)
+
+	if err := decode(w, r, &metrics); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	if err := model.ValidateBatch(metrics); err != nil {
+		var batchErr *model.BatchError
+		if errors.As(err, &batchErr) {
+			writeJSON(w, http.StatusBadRequest, batchErr)
+
+			return
+		}
+
+		http.Error(w, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	c.accept(w, metrics)
+}
+
+func (c *Collector) accept(w http.ResponseWriter, metrics []model.Metrics) {
+	if err := c.add(metrics); err != nil {
+		c.log.Warn("push rejected", zap.Int("metrics", len(metrics)), zap.Error(err))
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, struct{}{})
+}
+
+func decode(w http.ResponseWriter, r *http.Request, v any) error {
+	if contentType := r.Header.Get("Content-Type"); contentType != jsonContentType {
+		return fmt.Errorf("%w: %s", errUnknownContType, contentType)
+	}
+
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize)).Decode(v); err != nil {
+		return fmt.Errorf("cannot decode body: %w", err)
+	}
+
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	resp, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", jsonContentType)
+	w.WriteHeader(status)
+	_, _ = w.Write(resp)
+}
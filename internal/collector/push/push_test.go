@@ -0,0 +1,145 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/vorotislav/alert-service/internal/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func newTestCollector(t *testing.T, cfg Config) *Collector {
+	t.Helper()
+
+	raw, err := json.Marshal(cfg)
+	require.NoError(t, err)
+
+	c, err := New(zap.NewNop(), raw)
+	require.NoError(t, err)
+
+	return c.(*Collector) //nolint:forcetypeassert
+}
+
+func post(t *testing.T, h http.Handler, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", jsonContentType)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	return rec
+}
+
+func values(t *testing.T, c *Collector) map[string]float64 {
+	t.Helper()
+
+	metrics, err := c.Collect(context.Background())
+	require.NoError(t, err)
+
+	got := make(map[string]float64, len(metrics))
+
+	for _, m := range metrics {
+		switch {
+		case m.Value != nil:
+			got[m.ID] = *m.Value
+		case m.Delta != nil:
+			got[m.ID] = float64(*m.Delta)
+		}
+	}
+
+	return got
+}
+
+func TestCollector_Handlers(t *testing.T) {
+	t.Parallel()
+
+	c := newTestCollector(t, Config{Address: "127.0.0.1:0", MaxMetrics: 3})
+
+	tests := []struct {
+		name   string
+		path   string
+		body   string
+		status int
+	}{
+		{name: "single", path: "/update/", body: `{"id":"Jobs","type":"counter","delta":2}`, status: http.StatusOK},
+		{
+			name:   "batch",
+			path:   "/updates/",
+			body:   `[{"id":"Jobs","type":"counter","delta":3},{"id":"Queue","type":"gauge","value":1.5}]`,
+			status: http.StatusOK,
+		},
+		{name: "invalid single", path: "/update/", body: `{"id":"Queue","type":"gauge"}`, status: http.StatusBadRequest},
+		{
+			name:   "invalid batch",
+			path:   "/updates/",
+			body:   `[{"id":"Other","type":"gauge","value":1},{"id":"","type":"gauge","value":1}]`,
+			status: http.StatusBadRequest,
+		},
+		{name: "not json", path: "/updates/", body: `Jobs 1`, status: http.StatusBadRequest},
+		{
+			name:   "too many",
+			path:   "/updates/",
+			body:   `[{"id":"A","type":"gauge","value":1},{"id":"B","type":"gauge","value":1}]`,
+			status: http.StatusTooManyRequests,
+		},
+	}
+
+	for _, tc := range tests {
+		rec := post(t, c.handler, tc.path, tc.body)
+		assert.Equal(t, tc.status, rec.Code, tc.name)
+	}
+
+	assert.Equal(t, map[string]float64{"Jobs": 5, "Queue": 1.5}, values(t, c))
+	assert.Empty(t, values(t, c))
+}
+
+func TestCollector_Start(t *testing.T) {
+	t.Parallel()
+
+	sock := filepath.Join(t.TempDir(), "push.sock")
+	c := newTestCollector(t, Config{Address: "127.0.0.1:0", Unix: sock, MaxMetrics: 10})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	require.NoError(t, c.Start(ctx))
+	require.Len(t, c.listeners, 2)
+
+	body := `{"id":"Jobs","type":"counter","delta":1}`
+
+	resp, err := http.Post("http://"+c.listeners[0].Addr().String()+"/update/", jsonContentType, //nolint:noctx
+		bytes.NewBufferString(body))
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	unixClient := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+
+			return d.DialContext(ctx, "unix", sock)
+		},
+	}}
+
+	resp, err = unixClient.Post("http://agent/update/", jsonContentType, bytes.NewBufferString(body)) //nolint:noctx
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	metrics, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	require.Len(t, metrics, 1)
+	assert.Equal(t, model.MetricCounter, metrics[0].MType)
+	assert.Equal(t, int64(2), *metrics[0].Delta)
+}
@@ -0,0 +1,135 @@
+package script
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/vorotislav/alert-service/internal/model"
+)
+
+// Форматы вывода команды.
+const (
+	FormatAuto = "auto"
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// ErrInvalidOutput возвращается, если вывод команды не удалось разобрать.
+var ErrInvalidOutput = errors.New("invalid command output")
+
+// Parse разбирает вывод команды. Текстовый формат - строки "имя значение [тип]", где тип gauge
+// (по умолчанию) или counter; пустые строки и строки, начинающиеся с '#', пропускаются.
+// JSON - массив model.Metrics. В формате auto JSON распознаётся по открывающей скобке массива.
+func Parse(out []byte, format string) ([]model.Metrics, error) {
+	trimmed := bytes.TrimSpace(out)
+
+	if format == FormatAuto {
+		format = FormatText
+		if bytes.HasPrefix(trimmed, []byte("[")) {
+			format = FormatJSON
+		}
+	}
+
+	var (
+		metrics []model.Metrics
+		err     error
+	)
+
+	switch format {
+	case FormatJSON:
+		metrics, err = parseJSON(trimmed)
+	case FormatText:
+		metrics, err = parseText(trimmed)
+	default:
+		return nil, fmt.Errorf("%w: unknown format %q", ErrInvalidOutput, format)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := model.ValidateBatch(metrics); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidOutput, err)
+	}
+
+	return metrics, nil
+}
+
+func parseJSON(out []byte) ([]model.Metrics, error) {
+	metrics := make([]model.Metrics, 0)
+
+	if len(out) == 0 {
+		return metrics, nil
+	}
+
+	if err := json.Unmarshal(out, &metrics); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidOutput, err)
+	}
+
+	return metrics, nil
+}
+
+func parseText(out []byte) ([]model.Metrics, error) {
+	metrics := make([]model.Metrics, 0)
+
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	line := 0
+
+	for scanner.Scan() {
+		line++
+
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		m, err := parseLine(text)
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: %w", ErrInvalidOutput, line, err)
+		}
+
+		metrics = append(metrics, m)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidOutput, err)
+	}
+
+	return metrics, nil
+}
+
+func parseLine(text string) (model.Metrics, error) {
+	fields := strings.Fields(text)
+	if len(fields) != 2 && len(fields) != 3 {
+		return model.Metrics{}, fmt.Errorf("expected \"name value [type]\", got %q", text) //nolint:goerr113
+	}
+
+	mType := model.MetricGauge
+	if len(fields) == 3 {
+		mType = fields[2]
+	}
+
+	switch mType {
+	case model.MetricGauge:
+		v, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return model.Metrics{}, fmt.Errorf("parse gauge value: %w", err)
+		}
+
+		return model.Metrics{ID: fields[0], MType: mType, Value: &v}, nil
+	case model.MetricCounter:
+		d, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return model.Metrics{}, fmt.Errorf("parse counter value: %w", err)
+		}
+
+		return model.Metrics{ID: fields[0], MType: mType, Delta: &d}, nil
+	default:
+		return model.Metrics{}, fmt.Errorf("%w: %q", model.ErrUnknownType, mType)
+	}
+}
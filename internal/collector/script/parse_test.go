@@ -0,0 +1,90 @@
+package script
+
+import (
+	"testing"
+
+	"github.com/vorotislav/alert-service/internal/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	gauge := func(id string, v float64) model.Metrics {
+		return model.Metrics{ID: id, MType: model.MetricGauge, Value: &v}
+	}
+	counter := func(id string, d int64) model.Metrics {
+		return model.Metrics{ID: id, MType: model.MetricCounter, Delta: &d}
+	}
+
+	tests := []struct {
+		name    string
+		out     string
+		format  string
+		want    []model.Metrics
+		wantErr bool
+	}{
+		{
+			name:   "text",
+			out:    "# backup check\nBackupAge 3600\n\nBackupFiles 12 gauge\nBackupErrors 2 counter\n",
+			format: FormatAuto,
+			want:   []model.Metrics{gauge("BackupAge", 3600), gauge("BackupFiles", 12), counter("BackupErrors", 2)},
+		},
+		{
+			name:   "json",
+			out:    `[{"id":"QueueLen","type":"gauge","value":1.5},{"id":"Jobs","type":"counter","delta":3}]`,
+			format: FormatAuto,
+			want:   []model.Metrics{gauge("QueueLen", 1.5), counter("Jobs", 3)},
+		},
+		{
+			name:   "empty",
+			out:    "\n",
+			format: FormatAuto,
+			want:   []model.Metrics{},
+		},
+		{
+			name:    "json as text",
+			out:     `[{"id":"QueueLen","type":"gauge","value":1.5}]`,
+			format:  FormatText,
+			wantErr: true,
+		},
+		{
+			name:    "bad counter",
+			out:     "Jobs 1.5 counter",
+			format:  FormatText,
+			wantErr: true,
+		},
+		{
+			name:    "unknown type",
+			out:     "Jobs 1 histogram",
+			format:  FormatText,
+			wantErr: true,
+		},
+		{
+			name:    "json without value",
+			out:     `[{"id":"QueueLen","type":"gauge"}]`,
+			format:  FormatJSON,
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := Parse([]byte(tc.out), tc.format)
+			if tc.wantErr {
+				require.ErrorIs(t, err, ErrInvalidOutput)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
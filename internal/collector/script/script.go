@@ -0,0 +1,355 @@
+// Пакет script представляет коллектор, который запускает заданные команды (shell- и Python-проверки)
+// по собственному расписанию и превращает их вывод в метрики. Форматы вывода описаны в Parse.
+//
+// Кроме метрик из вывода, для каждой команды (метка command - имя команды из настроек) отправляются:
+//   - ExecSuccess - 1, если последний запуск завершился успешно, иначе 0;
+//   - ExecDuration - длительность последнего запуска в секундах;
+//   - ExecFailures - счётчик неудачных запусков (ненулевой код выхода, таймаут, неверный вывод);
+//   - ExecTimeouts - счётчик запусков, прерванных по таймауту.
+//
+// Метрики gauge из вывода берутся из последнего успешного запуска, счётчики из вывода
+// накапливаются между опросами агента.
+package script
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vorotislav/alert-service/internal/collector"
+	"github.com/vorotislav/alert-service/internal/model"
+
+	"go.uber.org/zap"
+)
+
+// Name имя коллектора в настройках.
+const Name = "exec"
+
+// Имена метрик о запусках команд.
+const (
+	MetricSuccess  = "ExecSuccess"
+	MetricDuration = "ExecDuration"
+	MetricFailures = "ExecFailures"
+	MetricTimeouts = "ExecTimeouts"
+)
+
+// LabelCommand метка с именем команды.
+const LabelCommand = "command"
+
+const (
+	defaultInterval = time.Minute
+	defaultTimeout  = 10 * time.Second
+	// waitDelay сколько ждать закрытия вывода после завершения команды по таймауту:
+	// дочерние процессы скрипта могут держать его открытым.
+	waitDelay = time.Second
+	// maxStderr сколько байт stderr попадает в текст ошибки.
+	maxStderr = 512
+)
+
+// Ошибки настройки команд.
+var (
+	ErrNoCommands     = errors.New("no commands")
+	ErrInvalidCommand = errors.New("invalid command")
+)
+
+// Command команда для запуска. Command - исполняемый файл и аргументы (запускается без shell),
+// Interval и Timeout - длительности в формате time.ParseDuration (по умолчанию 1m и 10s),
+// Format - формат вывода: auto (по умолчанию), text или json.
+type Command struct {
+	Name     string   `json:"name"`
+	Command  []string `json:"command"`
+	Interval string   `json:"interval"`
+	Timeout  string   `json:"timeout"`
+	Format   string   `json:"format"`
+}
+
+// Config настройки коллектора.
+type Config struct {
+	Commands []Command `json:"commands"`
+}
+
+// state результаты запусков команды, накопленные с предыдущего опроса.
+type state struct {
+	ran      bool
+	success  bool
+	duration time.Duration
+	gauges   []model.Metrics
+	counters map[string]int64
+	failures int64
+	timeouts int64
+}
+
+type command struct {
+	Command
+	interval time.Duration
+	timeout  time.Duration
+
+	mu    sync.Mutex
+	state state
+}
+
+// Collector коллектор команд.
+type Collector struct {
+	log      *zap.Logger
+	commands []*command
+}
+
+// New фабрика коллектора.
+func New(log *zap.Logger, raw json.RawMessage) (collector.Collector, error) {
+	cfg := Config{}
+
+	if err := collector.Decode(raw, &cfg); err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	if len(cfg.Commands) == 0 {
+		return nil, ErrNoCommands
+	}
+
+	commands := make([]*command, 0, len(cfg.Commands))
+	names := make(map[string]struct{}, len(cfg.Commands))
+
+	for i, c := range cfg.Commands {
+		cmd, err := parseCommand(c)
+		if err != nil {
+			return nil, fmt.Errorf("command %d: %w", i, err)
+		}
+
+		if _, ok := names[c.Name]; ok {
+			return nil, fmt.Errorf("%w: duplicate name %s", ErrInvalidCommand, c.Name)
+		}
+
+		names[c.Name] = struct{}{}
+		commands = append(commands, cmd)
+	}
+
+	return &Collector{
+		log:      log,
+		commands: commands,
+	}, nil
+}
+
+func parseCommand(c Command) (*command, error) {
+	if c.Name == "" {
+		return nil, fmt.Errorf("%w: empty name", ErrInvalidCommand)
+	}
+
+	if len(c.Command) == 0 || c.Command[0] == "" {
+		return nil, fmt.Errorf("%w: %s: empty command", ErrInvalidCommand, c.Name)
+	}
+
+	switch c.Format {
+	case "":
+		c.Format = FormatAuto
+	case FormatAuto, FormatText, FormatJSON:
+	default:
+		return nil, fmt.Errorf("%w: %s: unknown format %q", ErrInvalidCommand, c.Name, c.Format)
+	}
+
+	interval, err := parseDuration(c.Interval, defaultInterval)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: interval: %w", ErrInvalidCommand, c.Name, err)
+	}
+
+	timeout, err := parseDuration(c.Timeout, defaultTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: timeout: %w", ErrInvalidCommand, c.Name, err)
+	}
+
+	// Следующий запуск не начнётся, пока не закончился предыдущий, поэтому таймаут больше интервала
+	// сдвигал бы расписание.
+	if timeout > interval {
+		timeout = interval
+	}
+
+	return &command{
+		Command:  c,
+		interval: interval,
+		timeout:  timeout,
+		state:    state{counters: make(map[string]int64)},
+	}, nil
+}
+
+func parseDuration(raw string, def time.Duration) (time.Duration, error) {
+	if raw == "" {
+		return def, nil
+	}
+
+	d, err := time.ParseDuration(raw)
+	if err != nil {
+		return 0, err //nolint:wrapcheck
+	}
+
+	if d <= 0 {
+		return 0, fmt.Errorf("must be positive, got %s", raw) //nolint:goerr113
+	}
+
+	return d, nil
+}
+
+// Name возвращает имя коллектора.
+func (c *Collector) Name() string {
+	return Name
+}
+
+// Start запускает каждую команду в отдельной горутине: сразу и затем с её интервалом.
+func (c *Collector) Start(ctx context.Context) error {
+	for _, cmd := range c.commands {
+		go c.loop(ctx, cmd)
+	}
+
+	return nil
+}
+
+func (c *Collector) loop(ctx context.Context, cmd *command) {
+	ticker := time.NewTicker(cmd.interval)
+	defer ticker.Stop()
+
+	for {
+		c.run(ctx, cmd)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// run запускает команду один раз и запоминает результат.
+func (c *Collector) run(ctx context.Context, cmd *command) {
+	runCtx, cancel := context.WithTimeout(ctx, cmd.timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+
+	//nolint:gosec // команды задаются в настройках агента.
+	ec := exec.CommandContext(runCtx, cmd.Command.Command[0], cmd.Command.Command[1:]...)
+	ec.Stdout = &stdout
+	ec.Stderr = &stderr
+	ec.WaitDelay = waitDelay
+
+	start := time.Now()
+	err := ec.Run()
+	duration := time.Since(start)
+
+	// Агент останавливается: это не сбой команды.
+	if ctx.Err() != nil {
+		return
+	}
+
+	timedOut := errors.Is(runCtx.Err(), context.DeadlineExceeded)
+
+	var metrics []model.Metrics
+
+	switch {
+	case timedOut:
+		err = fmt.Errorf("timed out after %s", cmd.timeout) //nolint:goerr113
+	case err != nil:
+		err = fmt.Errorf("%w: %s", err, stderrText(stderr.Bytes()))
+	default:
+		metrics, err = Parse(stdout.Bytes(), cmd.Format)
+	}
+
+	if err != nil {
+		c.log.Warn("command failed", zap.String("command", cmd.Name), zap.Error(err))
+	}
+
+	cmd.record(metrics, duration, err, timedOut)
+}
+
+func stderrText(stderr []byte) string {
+	text := strings.TrimSpace(string(stderr))
+	if len(text) > maxStderr {
+		text = text[:maxStderr] + "..."
+	}
+
+	return text
+}
+
+func (cmd *command) record(metrics []model.Metrics, duration time.Duration, err error, timedOut bool) {
+	cmd.mu.Lock()
+	defer cmd.mu.Unlock()
+
+	s := &cmd.state
+	s.ran = true
+	s.duration = duration
+	s.success = err == nil
+
+	if err != nil {
+		s.failures++
+		s.gauges = nil
+
+		if timedOut {
+			s.timeouts++
+		}
+
+		return
+	}
+
+	s.gauges = s.gauges[:0]
+
+	for _, m := range metrics {
+		if m.MType == model.MetricCounter {
+			s.counters[m.ID] += *m.Delta
+
+			continue
+		}
+
+		s.gauges = append(s.gauges, m)
+	}
+}
+
+// Collect возвращает метрики команд, которые уже запускались. Счётчики обнуляются.
+func (c *Collector) Collect(_ context.Context) ([]model.Metrics, error) {
+	metrics := make([]model.Metrics, 0)
+
+	for _, cmd := range c.commands {
+		metrics = append(metrics, cmd.collect()...)
+	}
+
+	return metrics, nil
+}
+
+func (cmd *command) collect() []model.Metrics {
+	cmd.mu.Lock()
+	defer cmd.mu.Unlock()
+
+	s := &cmd.state
+	if !s.ran {
+		return nil
+	}
+
+	success := 0.0
+	if s.success {
+		success = 1
+	}
+
+	labels := map[string]string{LabelCommand: cmd.Name}
+
+	metrics := []model.Metrics{
+		collector.LabeledGauge(MetricSuccess, labels, success),
+		collector.LabeledGauge(MetricDuration, labels, s.duration.Seconds()),
+		collector.LabeledCounter(MetricFailures, labels, s.failures),
+		collector.LabeledCounter(MetricTimeouts, labels, s.timeouts),
+	}
+
+	for _, m := range s.gauges {
+		metrics = append(metrics, m.Clone())
+	}
+
+	for id, d := range s.counters {
+		metrics = append(metrics, collector.Counter(id, d))
+		delete(s.counters, id)
+	}
+
+	s.failures, s.timeouts = 0, 0
+
+	return metrics
+}
@@ -0,0 +1,122 @@
+package script
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/vorotislav/alert-service/internal/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func newTestCollector(t *testing.T, commands ...Command) *Collector {
+	t.Helper()
+
+	raw, err := json.Marshal(Config{Commands: commands})
+	require.NoError(t, err)
+
+	c, err := New(zap.NewNop(), raw)
+	require.NoError(t, err)
+
+	return c.(*Collector) //nolint:forcetypeassert
+}
+
+// series возвращает ключ серии метрики о запусках команды.
+func series(name, command string) string {
+	return model.SeriesKey(name, map[string]string{LabelCommand: command})
+}
+
+func collect(t *testing.T, c *Collector) map[string]float64 {
+	t.Helper()
+
+	metrics, err := c.Collect(context.Background())
+	require.NoError(t, err)
+
+	got := make(map[string]float64, len(metrics))
+
+	for _, m := range metrics {
+		switch {
+		case m.Value != nil:
+			got[m.SeriesKey()] = *m.Value
+		case m.Delta != nil:
+			got[m.SeriesKey()] = float64(*m.Delta)
+		}
+	}
+
+	return got
+}
+
+func TestCollector_Run(t *testing.T) {
+	t.Parallel()
+
+	c := newTestCollector(t,
+		Command{Name: "ok", Command: []string{"sh", "-c", "echo 'Queue 5'; echo 'Jobs 2 counter'"}},
+		Command{Name: "fail", Command: []string{"sh", "-c", "echo 'Queue 1'; echo boom >&2; exit 3"}},
+		Command{Name: "slow", Command: []string{"sleep", "5"}, Timeout: "50ms"},
+		Command{Name: "garbage", Command: []string{"echo", "not a metric line"}},
+	)
+
+	assert.Empty(t, collect(t, c))
+
+	for _, cmd := range c.commands {
+		c.run(context.Background(), cmd)
+	}
+
+	c.run(context.Background(), c.commands[0])
+
+	got := collect(t, c)
+
+	assert.Equal(t, float64(1), got[series(MetricSuccess, "ok")])
+	assert.Equal(t, float64(5), got["Queue"])
+	assert.Equal(t, float64(4), got["Jobs"])
+	assert.Equal(t, float64(0), got[series(MetricFailures, "ok")])
+
+	for _, name := range []string{"fail", "slow", "garbage"} {
+		assert.Equal(t, float64(0), got[series(MetricSuccess, name)], name)
+		assert.Equal(t, float64(1), got[series(MetricFailures, name)], name)
+	}
+
+	assert.Equal(t, float64(1), got[series(MetricTimeouts, "slow")])
+	assert.Equal(t, float64(0), got[series(MetricTimeouts, "fail")])
+	assert.Less(t, got[series(MetricDuration, "slow")], float64(5))
+
+	// Счётчики отдаются один раз, gauge - до следующего запуска.
+	again := collect(t, c)
+	assert.Equal(t, float64(5), again["Queue"])
+	assert.NotContains(t, again, "Jobs")
+	assert.Equal(t, float64(0), again[series(MetricFailures, "fail")])
+}
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		cfg  string
+		err  error
+	}{
+		{name: "no commands", cfg: `{}`, err: ErrNoCommands},
+		{name: "empty command", cfg: `{"commands":[{"name":"a"}]}`, err: ErrInvalidCommand},
+		{name: "bad interval", cfg: `{"commands":[{"name":"a","command":["true"],"interval":"soon"}]}`, err: ErrInvalidCommand},
+		{name: "bad format", cfg: `{"commands":[{"name":"a","command":["true"],"format":"xml"}]}`, err: ErrInvalidCommand},
+		{
+			name: "duplicate",
+			cfg:  `{"commands":[{"name":"a","command":["true"]},{"name":"a","command":["false"]}]}`,
+			err:  ErrInvalidCommand,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := New(zap.NewNop(), json.RawMessage(tc.cfg))
+			require.ErrorIs(t, err, tc.err)
+		})
+	}
+}
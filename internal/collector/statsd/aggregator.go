@@ -0,0 +1,205 @@
+package statsd
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/vorotislav/alert-service/internal/collector"
+	"github.com/vorotislav/alert-service/internal/model"
+)
+
+// Типы метрик StatsD.
+const (
+	typeCounter   = "c"
+	typeGauge     = "g"
+	typeTimer     = "ms"
+	typeHistogram = "h"
+	typeSet       = "s"
+)
+
+// Суффиксы метрик, в которые превращается таймер.
+const (
+	suffixCount = "_count"
+	suffixMin   = "_min"
+	suffixMax   = "_max"
+	suffixMean  = "_mean"
+)
+
+const (
+	// minParts в строке есть как минимум значение и тип.
+	minParts = 2
+	percent  = 100
+)
+
+// ErrInvalidLine возвращается для строки, которая не соответствует формату StatsD.
+var ErrInvalidLine = errors.New("invalid statsd line")
+
+// sample разобранная строка StatsD.
+type sample struct {
+	name     string
+	mType    string
+	value    float64
+	raw      string
+	relative bool
+	rate     float64
+}
+
+// parseLine разбирает строку вида "имя:значение|тип[|@частота][|#теги]". Теги игнорируются.
+func parseLine(line string) (sample, error) {
+	name, rest, ok := strings.Cut(line, ":")
+	if !ok || name == "" {
+		return sample{}, fmt.Errorf("%w: %q", ErrInvalidLine, line)
+	}
+
+	parts := strings.Split(rest, "|")
+	if len(parts) < minParts {
+		return sample{}, fmt.Errorf("%w: %q", ErrInvalidLine, line)
+	}
+
+	s := sample{name: name, mType: parts[1], raw: parts[0], rate: 1}
+
+	for _, p := range parts[2:] {
+		if !strings.HasPrefix(p, "@") {
+			continue
+		}
+
+		rate, err := strconv.ParseFloat(p[1:], 64)
+		if err != nil || rate <= 0 || rate > 1 {
+			return sample{}, fmt.Errorf("%w: sample rate %q", ErrInvalidLine, p)
+		}
+
+		s.rate = rate
+	}
+
+	switch s.mType {
+	case typeSet:
+		return s, nil
+	case typeCounter, typeGauge, typeTimer, typeHistogram:
+	default:
+		return sample{}, fmt.Errorf("%w: unknown type %q", ErrInvalidLine, s.mType)
+	}
+
+	v, err := strconv.ParseFloat(s.raw, 64)
+	if err != nil {
+		return sample{}, fmt.Errorf("%w: value %q", ErrInvalidLine, s.raw)
+	}
+
+	s.value = v
+	s.relative = s.mType == typeGauge && (s.raw[0] == '+' || s.raw[0] == '-')
+
+	return s, nil
+}
+
+// aggregator копит значения между отправками. Значения gauge сохраняются и после Flush,
+// как это принято в StatsD, чтобы относительные изменения применялись к последнему значению.
+type aggregator struct {
+	percentiles []float64
+
+	mu       sync.Mutex
+	counters map[string]float64
+	gauges   map[string]float64
+	timers   map[string][]float64
+	sets     map[string]map[string]struct{}
+	// timerCounts сколько значений таймера было отправлено с учётом частоты выборки.
+	timerCounts map[string]float64
+}
+
+func newAggregator(percentiles []float64) *aggregator {
+	a := &aggregator{
+		percentiles: percentiles,
+		gauges:      make(map[string]float64),
+	}
+
+	a.reset()
+
+	return a
+}
+
+func (a *aggregator) reset() {
+	a.counters = make(map[string]float64)
+	a.timers = make(map[string][]float64)
+	a.timerCounts = make(map[string]float64)
+	a.sets = make(map[string]map[string]struct{})
+}
+
+func (a *aggregator) add(s sample) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	switch s.mType {
+	case typeCounter:
+		a.counters[s.name] += s.value / s.rate
+	case typeGauge:
+		if s.relative {
+			a.gauges[s.name] += s.value
+		} else {
+			a.gauges[s.name] = s.value
+		}
+	case typeTimer, typeHistogram:
+		a.timers[s.name] = append(a.timers[s.name], s.value)
+		a.timerCounts[s.name] += 1 / s.rate
+	case typeSet:
+		set, ok := a.sets[s.name]
+		if !ok {
+			set = make(map[string]struct{})
+			a.sets[s.name] = set
+		}
+
+		set[s.raw] = struct{}{}
+	}
+}
+
+// flush возвращает агрегаты за интервал и начинает новый.
+func (a *aggregator) flush() []model.Metrics {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	metrics := make([]model.Metrics, 0, len(a.counters)+len(a.gauges)+len(a.sets))
+
+	for name, v := range a.counters {
+		metrics = append(metrics, collector.Counter(name, int64(math.Round(v))))
+	}
+
+	for name, v := range a.gauges {
+		metrics = append(metrics, collector.Gauge(name, v))
+	}
+
+	for name, set := range a.sets {
+		metrics = append(metrics, collector.Gauge(name, float64(len(set))))
+	}
+
+	for name, values := range a.timers {
+		metrics = append(metrics, a.timerMetrics(name, values)...)
+	}
+
+	a.reset()
+
+	return metrics
+}
+
+func (a *aggregator) timerMetrics(name string, values []float64) []model.Metrics {
+	sort.Float64s(values)
+
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+
+	metrics := []model.Metrics{
+		collector.Counter(name+suffixCount, int64(math.Round(a.timerCounts[name]))),
+		collector.Gauge(name+suffixMin, values[0]),
+		collector.Gauge(name+suffixMax, values[len(values)-1]),
+		collector.Gauge(name+suffixMean, sum/float64(len(values))),
+	}
+
+	for _, p := range a.percentiles {
+		metrics = append(metrics, collector.Gauge(name+collector.PercentileSuffix(p), collector.Percentile(values, p)))
+	}
+
+	return metrics
+}
@@ -0,0 +1,213 @@
+// Пакет statsd представляет коллектор, который принимает метрики приложений по протоколу StatsD
+// через UDP и, при необходимости, Unix datagram сокет и агрегирует их между отправками на сервер.
+//
+// Поддерживаются счётчики (c, с частотой выборки @rate), gauge (g, "+N" и "-N" - относительные
+// изменения), таймеры (ms и h) и множества (s). Таймер превращается в метрики <name>_count (counter),
+// <name>_min, <name>_max, <name>_mean и <name>_p<N> для настроенных перцентилей (gauge),
+// множество - в gauge с количеством уникальных значений.
+//
+// Коллектор также отправляет StatsdPackets и StatsdInvalidLines - счётчики принятых пакетов и строк,
+// которые не удалось разобрать.
+package statsd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync/atomic"
+
+	"github.com/vorotislav/alert-service/internal/collector"
+	"github.com/vorotislav/alert-service/internal/model"
+
+	"go.uber.org/zap"
+)
+
+// Name имя коллектора в настройках.
+const Name = "statsd"
+
+// Метрики самого коллектора.
+const (
+	MetricPackets      = "StatsdPackets"
+	MetricInvalidLines = "StatsdInvalidLines"
+)
+
+const (
+	defaultUDP = ":8125"
+	maxPacket  = 65535
+)
+
+// ErrNoListeners возвращается, если не задан ни один адрес для приёма метрик.
+var ErrNoListeners = errors.New("no statsd listeners")
+
+//nolint:gochecknoglobals
+var defaultPercentiles = []float64{50, 90, 95, 99}
+
+// Config настройки коллектора. UDP - адрес UDP (по умолчанию ":8125", "-" отключает приём по UDP),
+// Unixgram - путь к Unix datagram сокету (по умолчанию не используется),
+// Percentiles - перцентили таймеров (по умолчанию 50, 90, 95 и 99).
+type Config struct {
+	UDP         string    `json:"udp"`
+	Unixgram    string    `json:"unixgram"`
+	Percentiles []float64 `json:"percentiles"`
+}
+
+// Collector коллектор StatsD.
+type Collector struct {
+	log      *zap.Logger
+	udp      string
+	unixgram string
+	agg      *aggregator
+
+	conns []net.PacketConn
+
+	packets      atomic.Int64
+	invalidLines atomic.Int64
+}
+
+// New фабрика коллектора.
+func New(log *zap.Logger, raw json.RawMessage) (collector.Collector, error) {
+	cfg := Config{
+		UDP:         defaultUDP,
+		Percentiles: defaultPercentiles,
+	}
+
+	if err := collector.Decode(raw, &cfg); err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	if cfg.UDP == "-" {
+		cfg.UDP = ""
+	}
+
+	if cfg.UDP == "" && cfg.Unixgram == "" {
+		return nil, ErrNoListeners
+	}
+
+	for _, p := range cfg.Percentiles {
+		if p <= 0 || p > percent {
+			return nil, fmt.Errorf("%w: percentile %v", collector.ErrInvalidConfig, p)
+		}
+	}
+
+	return &Collector{
+		log:      log,
+		udp:      cfg.UDP,
+		unixgram: cfg.Unixgram,
+		agg:      newAggregator(cfg.Percentiles),
+	}, nil
+}
+
+// Name возвращает имя коллектора.
+func (c *Collector) Name() string {
+	return Name
+}
+
+// Start открывает сокеты и начинает принимать метрики. Сокеты закрываются с отменой ctx.
+func (c *Collector) Start(ctx context.Context) error {
+	if c.udp != "" {
+		conn, err := net.ListenPacket("udp", c.udp)
+		if err != nil {
+			return fmt.Errorf("listen udp: %w", err)
+		}
+
+		c.conns = append(c.conns, conn)
+	}
+
+	if c.unixgram != "" {
+		// Сокет, оставшийся от предыдущего запуска, мешает открыть новый.
+		if err := os.Remove(c.unixgram); err != nil && !errors.Is(err, os.ErrNotExist) {
+			c.close()
+
+			return fmt.Errorf("remove stale socket: %w", err)
+		}
+
+		conn, err := net.ListenPacket("unixgram", c.unixgram)
+		if err != nil {
+			c.close()
+
+			return fmt.Errorf("listen unixgram: %w", err)
+		}
+
+		c.conns = append(c.conns, conn)
+	}
+
+	for _, conn := range c.conns {
+		c.log.Info("statsd listener started", zap.String("address", conn.LocalAddr().String()))
+
+		go c.serve(conn)
+	}
+
+	go func() {
+		<-ctx.Done()
+		c.close()
+	}()
+
+	return nil
+}
+
+func (c *Collector) close() {
+	for _, conn := range c.conns {
+		_ = conn.Close()
+	}
+
+	// Закрытие unixgram-сокета не удаляет его файл.
+	if c.unixgram != "" {
+		_ = os.Remove(c.unixgram)
+	}
+}
+
+func (c *Collector) serve(conn net.PacketConn) {
+	buf := make([]byte, maxPacket)
+
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				c.log.Error("statsd read", zap.Error(err))
+			}
+
+			return
+		}
+
+		c.handle(buf[:n])
+	}
+}
+
+// handle разбирает пакет: несколько метрик разделяются переводом строки.
+func (c *Collector) handle(packet []byte) {
+	c.packets.Add(1)
+
+	for _, line := range bytes.Split(packet, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+
+		s, err := parseLine(string(line))
+		if err != nil {
+			c.invalidLines.Add(1)
+			c.log.Debug("skip statsd line", zap.Error(err))
+
+			continue
+		}
+
+		c.agg.add(s)
+	}
+}
+
+// Collect ничего не возвращает: значения отдаются агрегатами за интервал отправки в Flush.
+func (c *Collector) Collect(_ context.Context) ([]model.Metrics, error) {
+	return nil, nil
+}
+
+// Flush возвращает агрегаты с предыдущей отправки и счётчики самого коллектора.
+func (c *Collector) Flush() []model.Metrics {
+	return append(c.agg.flush(),
+		collector.Counter(MetricPackets, c.packets.Swap(0)),
+		collector.Counter(MetricInvalidLines, c.invalidLines.Swap(0)),
+	)
+}
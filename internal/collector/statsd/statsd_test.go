@@ -0,0 +1,154 @@
+package statsd
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/vorotislav/alert-service/internal/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func values(metrics []model.Metrics) map[string]float64 {
+	got := make(map[string]float64, len(metrics))
+
+	for _, m := range metrics {
+		switch {
+		case m.Value != nil:
+			got[m.ID] = *m.Value
+		case m.Delta != nil:
+			got[m.ID] = float64(*m.Delta)
+		}
+	}
+
+	return got
+}
+
+func TestParseLine(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		line    string
+		want    sample
+		wantErr bool
+	}{
+		{line: "api.hits:1|c", want: sample{name: "api.hits", mType: "c", value: 1, raw: "1", rate: 1}},
+		{line: "api.hits:3|c|@0.5|#env:prod", want: sample{name: "api.hits", mType: "c", value: 3, raw: "3", rate: 0.5}},
+		{line: "queue:-2|g", want: sample{name: "queue", mType: "g", value: -2, raw: "-2", relative: true, rate: 1}},
+		{line: "api.latency:12.5|ms", want: sample{name: "api.latency", mType: "ms", value: 12.5, raw: "12.5", rate: 1}},
+		{line: "users:alice|s", want: sample{name: "users", mType: "s", raw: "alice", rate: 1}},
+		{line: "api.hits", wantErr: true},
+		{line: "api.hits:1", wantErr: true},
+		{line: "api.hits:x|c", wantErr: true},
+		{line: "api.hits:1|d", wantErr: true},
+		{line: "api.hits:1|c|@2", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+
+		t.Run(tc.line, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := parseLine(tc.line)
+			if tc.wantErr {
+				require.ErrorIs(t, err, ErrInvalidLine)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestAggregator_Flush(t *testing.T) {
+	t.Parallel()
+
+	a := newAggregator([]float64{50, 99.9})
+
+	for _, line := range []string{
+		"hits:1|c", "hits:2|c|@0.5",
+		"queue:10|g", "queue:+5|g", "queue:-3|g",
+		"users:alice|s", "users:bob|s", "users:alice|s",
+	} {
+		s, err := parseLine(line)
+		require.NoError(t, err)
+		a.add(s)
+	}
+
+	for i := 1; i <= 10; i++ {
+		a.add(sample{name: "latency", mType: typeTimer, value: float64(i * 10), rate: 1})
+	}
+
+	got := values(a.flush())
+	assert.Equal(t, map[string]float64{
+		"hits":          5,
+		"queue":         12,
+		"users":         2,
+		"latency_count": 10,
+		"latency_min":   10,
+		"latency_max":   100,
+		"latency_mean":  55,
+		"latency_p50":   50,
+		"latency_p99_9": 100,
+	}, got)
+
+	// Gauge сохраняется между отправками, остальное начинается заново.
+	s, err := parseLine("queue:+1|g")
+	require.NoError(t, err)
+	a.add(s)
+
+	assert.Equal(t, map[string]float64{"queue": 13}, values(a.flush()))
+}
+
+func TestCollector_Listen(t *testing.T) {
+	t.Parallel()
+
+	sock := filepath.Join(t.TempDir(), "statsd.sock")
+
+	cfg, err := json.Marshal(Config{UDP: "127.0.0.1:0", Unixgram: sock})
+	require.NoError(t, err)
+
+	raw, err := New(zap.NewNop(), cfg)
+	require.NoError(t, err)
+
+	c := raw.(*Collector) //nolint:forcetypeassert
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	require.NoError(t, c.Start(ctx))
+	require.Len(t, c.conns, 2)
+
+	udp, err := net.Dial("udp", c.conns[0].LocalAddr().String())
+	require.NoError(t, err)
+
+	defer udp.Close()
+
+	_, err = udp.Write([]byte("hits:1|c\nqueue:7|g\nbroken\n"))
+	require.NoError(t, err)
+
+	unix, err := net.Dial("unixgram", sock)
+	require.NoError(t, err)
+
+	defer unix.Close()
+
+	_, err = unix.Write([]byte("hits:2|c"))
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool { return c.packets.Load() == 2 }, time.Second, 5*time.Millisecond)
+
+	got := values(c.Flush())
+	assert.Equal(t, float64(3), got["hits"])
+	assert.Equal(t, float64(7), got["queue"])
+	assert.Equal(t, float64(2), got[MetricPackets])
+	assert.Equal(t, float64(1), got[MetricInvalidLines])
+}
@@ -1,6 +1,7 @@
 package encrypt
 
 import (
+	"bytes"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
@@ -10,8 +11,17 @@ import (
 	"os"
 )
 
-var ErrDecodePublicKey = errors.New("decode pem public key")
+var (
+	ErrDecodePublicKey = errors.New("decode pem public key")
+	ErrBadCipherText   = errors.New("bad cipher text length")
+)
+
+// pkcs1v15Overhead количество байт, которое занимает дополнение PKCS #1 v1.5 в каждом зашифрованном блоке.
+const pkcs1v15Overhead = 11
 
+// Encrypt шифрует данные открытым ключом из сертификата. RSA не может зашифровать за раз больше,
+// чем размер ключа без дополнения, поэтому данные делятся на блоки, а зашифрованные блоки
+// (каждый размером с ключ) склеиваются.
 func Encrypt(publicKeyPath string, data []byte) ([]byte, error) {
 	publicKeyPEM, err := os.ReadFile(publicKeyPath)
 	if err != nil {
@@ -28,10 +38,51 @@ func Encrypt(publicKeyPath string, data []byte) ([]byte, error) {
 		return nil, fmt.Errorf("parse public key: %w", err)
 	}
 
-	encrypted, err := rsa.EncryptPKCS1v15(rand.Reader, cert.PublicKey.(*rsa.PublicKey), data)
-	if err != nil {
-		return nil, fmt.Errorf("encrypt data: %w", err)
+	publicKey, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, ErrDecodePublicKey
+	}
+
+	chunkSize := publicKey.Size() - pkcs1v15Overhead
+
+	var buf bytes.Buffer
+
+	for start := 0; start < len(data) || start == 0; start += chunkSize {
+		end := start + chunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+
+		encrypted, err := rsa.EncryptPKCS1v15(rand.Reader, publicKey, data[start:end])
+		if err != nil {
+			return nil, fmt.Errorf("encrypt data: %w", err)
+		}
+
+		buf.Write(encrypted)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Decrypt расшифровывает данные, зашифрованные Encrypt: делит их на блоки размером с ключ
+// и расшифровывает каждый блок.
+func Decrypt(privateKey *rsa.PrivateKey, data []byte) ([]byte, error) {
+	size := privateKey.Size()
+
+	if len(data) == 0 || len(data)%size != 0 {
+		return nil, fmt.Errorf("%w: %d", ErrBadCipherText, len(data))
+	}
+
+	var buf bytes.Buffer
+
+	for start := 0; start < len(data); start += size {
+		decrypted, err := rsa.DecryptPKCS1v15(rand.Reader, privateKey, data[start:start+size])
+		if err != nil {
+			return nil, fmt.Errorf("decrypt data: %w", err)
+		}
+
+		buf.Write(decrypted)
 	}
 
-	return encrypted, nil
+	return buf.Bytes(), nil
 }
@@ -0,0 +1,64 @@
+package encrypt
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	t.Parallel()
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "agent"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &privateKey.PublicKey, privateKey)
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "public.pem")
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}), 0o600))
+
+	cases := []struct {
+		name string
+		data []byte
+	}{
+		{name: "one block", data: []byte("metrics")},
+		{name: "several blocks", data: bytes.Repeat([]byte("0123456789"), 100)},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			encrypted, err := Encrypt(path, tc.data)
+			require.NoError(t, err)
+			assert.Zero(t, len(encrypted)%privateKey.Size())
+
+			decrypted, err := Decrypt(privateKey, encrypted)
+			require.NoError(t, err)
+			assert.Equal(t, tc.data, decrypted)
+		})
+	}
+
+	_, err = Decrypt(privateKey, []byte("short"))
+	assert.ErrorIs(t, err, ErrBadCipherText)
+}
@@ -0,0 +1,76 @@
+// Пакет history агрегирует сохранённые значения метрик по шагам одинаковой длительности.
+package history
+
+import (
+	"time"
+
+	"github.com/vorotislav/alert-service/internal/model"
+)
+
+// Align возвращает начало шага, в который попадает t. Шаги выравниваются относительно Unix-эпохи.
+func Align(t time.Time, step time.Duration) time.Time {
+	ns := t.UnixNano()
+	rem := ns % int64(step)
+
+	if rem < 0 {
+		rem += int64(step)
+	}
+
+	return time.Unix(0, ns-rem).UTC()
+}
+
+// Aggregate группирует значения из полуинтервала [from, to) по шагам step и считает для каждого шага min, max и avg.
+// Значения должны быть упорядочены по времени. Шаги без значений в результат не попадают.
+func Aggregate(samples []model.Sample, from, to time.Time, step time.Duration) []model.HistoryPoint {
+	points := make([]model.HistoryPoint, 0)
+
+	if step <= 0 {
+		return points
+	}
+
+	var (
+		cur *model.HistoryPoint
+		sum float64
+	)
+
+	flush := func() {
+		if cur != nil {
+			cur.Avg = sum / float64(cur.Count)
+			points = append(points, *cur)
+		}
+	}
+
+	for _, s := range samples {
+		if s.Timestamp.Before(from) || !s.Timestamp.Before(to) {
+			continue
+		}
+
+		ts := Align(s.Timestamp, step)
+
+		if cur == nil || !cur.Timestamp.Equal(ts) {
+			flush()
+
+			cur = &model.HistoryPoint{
+				Timestamp: ts,
+				Min:       s.Value,
+				Max:       s.Value,
+			}
+			sum = 0
+		}
+
+		cur.Count++
+		sum += s.Value
+
+		if s.Value < cur.Min {
+			cur.Min = s.Value
+		}
+
+		if s.Value > cur.Max {
+			cur.Max = s.Value
+		}
+	}
+
+	flush()
+
+	return points
+}
@@ -0,0 +1,52 @@
+package history
+
+import (
+	"testing"
+	"time"
+
+	"github.com/vorotislav/alert-service/internal/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAggregate(t *testing.T) {
+	t.Parallel()
+
+	base := time.Date(2023, 10, 20, 12, 0, 0, 0, time.UTC)
+	at := func(sec int) time.Time { return base.Add(time.Duration(sec) * time.Second) }
+
+	samples := []model.Sample{
+		{Timestamp: at(-5), Value: 100},
+		{Timestamp: at(1), Value: 1},
+		{Timestamp: at(20), Value: 5},
+		{Timestamp: at(59), Value: 3},
+		{Timestamp: at(130), Value: 7},
+		{Timestamp: at(180), Value: 9},
+	}
+
+	points := Aggregate(samples, at(0), at(180), time.Minute)
+
+	assert.Equal(t, []model.HistoryPoint{
+		{Timestamp: at(0), Min: 1, Max: 5, Avg: 3, Count: 3},
+		{Timestamp: at(120), Min: 7, Max: 7, Avg: 7, Count: 1},
+	}, points)
+}
+
+func TestAggregate_Empty(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+
+	assert.Empty(t, Aggregate(nil, now.Add(-time.Hour), now, time.Minute))
+	assert.Empty(t, Aggregate([]model.Sample{{Timestamp: now, Value: 1}}, now.Add(-time.Hour), now.Add(time.Hour), 0))
+}
+
+func TestAlign(t *testing.T) {
+	t.Parallel()
+
+	ts := time.Date(2023, 10, 20, 12, 34, 56, 789, time.UTC)
+
+	assert.Equal(t, time.Date(2023, 10, 20, 12, 34, 0, 0, time.UTC), Align(ts, time.Minute))
+	assert.Equal(t, time.Date(2023, 10, 20, 12, 30, 0, 0, time.UTC), Align(ts, 15*time.Minute))
+	assert.Equal(t, time.Date(2023, 10, 20, 12, 34, 50, 0, time.UTC), Align(ts, 10*time.Second))
+}
@@ -3,15 +3,23 @@ package client
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/vorotislav/alert-service/internal/encrypt"
+	"github.com/vorotislav/alert-service/internal/idempotency"
 	"github.com/vorotislav/alert-service/internal/model"
 	"github.com/vorotislav/alert-service/internal/settings/agent"
 	"github.com/vorotislav/alert-service/internal/utils"
@@ -22,7 +30,8 @@ import (
 
 // ErrSendMetrics ошибка, в случае неудачи отправки.
 var (
-	ErrSendMetrics = errors.New("cannot send metrics")
+	ErrSendMetrics      = errors.New("cannot send metrics")
+	ErrUnexpectedStatus = errors.New("unexpected response status")
 )
 
 const (
@@ -31,14 +40,37 @@ const (
 
 const (
 	defaultClientTimeout = time.Millisecond * 700
+	defaultBatchSize     = 100
+	sendTimeout          = time.Second
 )
 
+// statusError ошибка ответа сервера с неожиданным кодом. Если сервер отклонил метрики пакета,
+// rejected содержит их список из тела ответа.
+type statusError struct {
+	code     int
+	rejected *model.BatchError
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("%s: %d", ErrUnexpectedStatus.Error(), e.code)
+}
+
+func (e *statusError) Unwrap() error {
+	return ErrUnexpectedStatus
+}
+
 // Client основная сущность для отправки метрик. Содержит в себе http.Client, логгер, настройки и URL сервера.
+// По умолчанию метрики отправляются пакетами на /updates. Если сервер отклоняет пакет, его метрики
+// отправляются по одной на /update; если сервер не поддерживает пакеты, клиент запоминает это
+// и дальше отправляет метрики только по одной.
 type Client struct {
 	dc        *http.Client
 	logger    *zap.Logger
 	set       *agent.Settings
 	serverURL string
+	batchURL  string
+
+	batchUnsupported atomic.Bool
 }
 
 // NewClient конструктор для Client.
@@ -50,20 +82,181 @@ func NewClient(logger *zap.Logger, set *agent.Settings) *Client {
 		logger:    logger,
 		set:       set,
 		serverURL: fmt.Sprintf("http://%s/update", set.ServerAddress),
+		batchURL:  fmt.Sprintf("http://%s/updates", set.ServerAddress),
 	}
 
 	return c
 }
 
-// SendMetrics метод отправки метрик на сервер. Принимает карту с метриками и возвращает ошибку.
-func (c *Client) SendMetrics(metrics map[string]*model.Metrics) error {
+// SendMetrics метод отправки метрик на сервер. Принимает ключ пакета и карту с метриками и возвращает ошибку,
+// объединяющую ошибки всех неудачных отправок. Если часть метрик не доставлена,
+// ошибка - *model.UnsentError с копиями этих метрик.
+// Ключ каждого запроса выводится из ключа пакета и серий запроса (см. idempotency.Derive), поэтому пакет,
+// повторно отправленный с тем же ключом, сервер не применит дважды. Пустой key заменяется случайным.
+func (c *Client) SendMetrics(key string, metrics map[string]*model.Metrics) error {
+	if key == "" {
+		key = idempotency.NewKey()
+	}
+
 	ms := c.convertMetricsToSlice(metrics)
 
-	jobs := make(chan *model.Metrics, c.set.RateLimit)
-	results := make(chan error, c.set.RateLimit)
+	if c.batchUnsupported.Load() {
+		return unsentError(c.sendEach(key, ms))
+	}
+
+	size := c.set.BatchSize
+	if size <= 0 {
+		size = defaultBatchSize
+	}
+
+	failed := make([]sendResult, 0)
+
+	for start := 0; start < len(ms); start += size {
+		end := start + size
+		if end > len(ms) {
+			end = len(ms)
+		}
+
+		chunk := ms[start:end]
+
+		err := c.sendBatch(batchKey(key, chunk), chunk)
+		if err == nil {
+			continue
+		}
+
+		if !c.fallback(err) {
+			failed = append(failed, sendResult{metrics: chunk, err: err})
+
+			continue
+		}
+
+		failed = append(failed, c.sendEach(key, chunk)...)
+	}
+
+	return unsentError(failed)
+}
+
+// sendResult неудачная отправка: метрики запроса и ошибка.
+type sendResult struct {
+	metrics []*model.Metrics
+	err     error
+}
+
+func unsentError(failed []sendResult) error {
+	if len(failed) == 0 {
+		return nil
+	}
+
+	ue := &model.UnsentError{
+		Metrics:  make([]model.Metrics, 0, len(failed)),
+		Rejected: make([]model.Metrics, 0),
+	}
+	errs := make([]error, 0, len(failed))
+
+	for _, f := range failed {
+		for _, m := range f.metrics {
+			if rejected(f.err) {
+				ue.Rejected = append(ue.Rejected, m.Clone())
+			} else {
+				ue.Metrics = append(ue.Metrics, m.Clone())
+			}
+		}
+
+		errs = append(errs, f.err)
+	}
+
+	ue.Err = errors.Join(errs...)
 
-	for w := 1; w <= c.set.RateLimit; w++ {
-		go c.sendWorker(w, jobs, results)
+	return ue
+}
+
+// rejected проверяет, что сервер отклонил запрос ответом 4xx и повторять его бессмысленно.
+func rejected(err error) bool {
+	var se *statusError
+	if !errors.As(err, &se) {
+		return false
+	}
+
+	return se.code >= http.StatusBadRequest && se.code < http.StatusInternalServerError
+}
+
+// fallback решает, нужно ли после ошибки отправить метрики пакета по одной.
+func (c *Client) fallback(err error) bool {
+	var se *statusError
+	if !errors.As(err, &se) {
+		return false
+	}
+
+	switch se.code {
+	case http.StatusBadRequest:
+		// Без списка отклонённых метрик 400 означает ошибку самого запроса (подпись, сжатие),
+		// и отправка по одной её не исправит.
+		if se.rejected == nil {
+			return false
+		}
+
+		c.logger.Info("batch rejected, sending metrics one by one",
+			zap.Int("rejected", len(se.rejected.Rejected)), zap.Error(err))
+
+		return true
+	case http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		c.logger.Info("batch updates are not supported by server", zap.Error(err))
+		c.batchUnsupported.Store(true)
+
+		return true
+	}
+
+	return false
+}
+
+// batchKey возвращает ключ запроса для части пакета: он зависит от ключа пакета и набора серий части.
+func batchKey(key string, ms []*model.Metrics) string {
+	series := make([]string, 0, len(ms))
+	for _, m := range ms {
+		series = append(series, m.SeriesKey())
+	}
+
+	sort.Strings(series)
+
+	return idempotency.Derive(key, series...)
+}
+
+func (c *Client) sendBatch(requestID string, ms []*model.Metrics) error {
+	raw, err := json.Marshal(ms)
+	if err != nil {
+		c.logger.Error("cannot metrics marshal", zap.Error(err))
+
+		return fmt.Errorf("%w: %w", ErrSendMetrics, err)
+	}
+
+	if err := c.sendRetry(c.batchURL, raw, requestID); err != nil {
+		return fmt.Errorf("send batch: %w", err)
+	}
+
+	c.logger.Debug("send batch", zap.Int("metrics", len(ms)))
+
+	return nil
+}
+
+func (c *Client) sendEach(key string, ms []*model.Metrics) []sendResult {
+	rateLimit := c.set.RateLimit
+	if rateLimit <= 0 {
+		rateLimit = 1
+	}
+
+	jobs := make(chan *model.Metrics, len(ms))
+	results := make(chan sendResult, len(ms))
+
+	wg := &sync.WaitGroup{}
+
+	for w := 1; w <= rateLimit; w++ {
+		wg.Add(1)
+
+		go func(id int) {
+			defer wg.Done()
+
+			c.sendWorker(id, key, jobs, results)
+		}(w)
 	}
 
 	for _, m := range ms {
@@ -72,18 +265,25 @@ func (c *Client) SendMetrics(metrics map[string]*model.Metrics) error {
 	}
 
 	close(jobs)
+	wg.Wait()
+	close(results)
 
-	return nil
+	failed := make([]sendResult, 0)
+	for r := range results {
+		failed = append(failed, r)
+	}
+
+	return failed
 }
 
-func (c *Client) sendWorker(id int, jobs <-chan *model.Metrics, results chan<- error) {
+func (c *Client) sendWorker(id int, key string, jobs <-chan *model.Metrics, results chan<- sendResult) {
 	for j := range jobs {
 		c.logger.Debug(fmt.Sprintf("worker %d started job: %s", id, j.ID))
 
-		err := c.sendMetricRetry(j)
+		err := c.sendMetric(idempotency.Derive(key, j.SeriesKey()), j)
 		if err != nil {
 			c.logger.Debug(fmt.Sprintf("worker %d failed job: %s", id, j.ID))
-			results <- err
+			results <- sendResult{metrics: []*model.Metrics{j}, err: err}
 		}
 	}
 
@@ -97,13 +297,15 @@ func (c *Client) convertMetricsToSlice(metrics map[string]*model.Metrics) []*mod
 		m = append(m, v)
 	}
 
+	// Порядок по ключу серии устойчив, поэтому при повторной отправке пакет делится на те же части.
+	sort.Slice(m, func(i, j int) bool {
+		return m[i].SeriesKey() < m[j].SeriesKey()
+	})
+
 	return m
 }
 
-func (c *Client) sendMetricRetry(metric *model.Metrics) error { //nolint:funlen
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
-	defer cancel()
-
+func (c *Client) sendMetric(requestID string, metric *model.Metrics) error {
 	raw, err := json.Marshal(metric)
 	if err != nil {
 		c.logger.Error("cannot metric marshal", zap.Error(err))
@@ -111,6 +313,29 @@ func (c *Client) sendMetricRetry(metric *model.Metrics) error { //nolint:funlen
 		return fmt.Errorf("%w: %w", ErrSendMetrics, err)
 	}
 
+	if err := c.sendRetry(c.serverURL, raw, requestID); err != nil {
+		return fmt.Errorf("send metrics: %w", err)
+	}
+
+	if metric.Value != nil {
+		c.logger.Debug("send metric",
+			zap.String("name", metric.ID),
+			zap.Float64("value", *metric.Value))
+	} else if metric.Delta != nil {
+		c.logger.Debug("send metric",
+			zap.String("name", metric.ID),
+			zap.Int64("value", *metric.Delta))
+	}
+
+	return nil
+}
+
+// sendRetry подписывает, сжимает и при необходимости шифрует тело и отправляет его на url с ключом запроса requestID,
+// повторяя попытку при сетевых ошибках и ошибках сервера.
+func (c *Client) sendRetry(url string, raw []byte, requestID string) error { //nolint:funlen
+	ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+	defer cancel()
+
 	compressRaw, err := utils.Compress(raw)
 	if err != nil {
 		c.logger.Error("cannot compress data", zap.Error(err))
@@ -125,66 +350,120 @@ func (c *Client) sendMetricRetry(metric *model.Metrics) error { //nolint:funlen
 		}
 	}
 
-	req, err := http.NewRequest(
-		http.MethodPost,
-		c.serverURL,
-		bytes.NewBuffer(compressRaw),
-	)
-
-	if err != nil {
-		c.logger.Error("cannot request prepare", zap.Error(err))
-
-		return fmt.Errorf("%w: %w", ErrSendMetrics, err)
-	}
+	var hash string
 
 	if c.set.HashKey != "" {
-		hash, err := utils.GetHash(raw, []byte(c.set.HashKey))
+		h, err := utils.GetHash(raw, []byte(c.set.HashKey))
 		if err != nil {
 			c.logger.Error("cannot get hash of metric", zap.Error(err))
 		}
 
-		req.Header.Set("HashSHA256", base64.StdEncoding.EncodeToString(hash))
+		hash = base64.StdEncoding.EncodeToString(h)
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Accept-Encoding", "gzip")
-	req.Header.Set("Content-Encoding", "gzip")
-
+	// Ключ запроса одинаков для всех попыток, чтобы сервер не применил метрики повторно,
+	// если ответ на предыдущую попытку не дошёл.
 	err = retry.Do(
 		func() error {
-			resp, err := c.dc.Do(req)
-			if resp != nil {
-				defer func() {
-					_ = resp.Body.Close()
-				}()
+			req, err := http.NewRequestWithContext(
+				ctx,
+				http.MethodPost,
+				url,
+				bytes.NewReader(compressRaw),
+			)
+			if err != nil {
+				c.logger.Error("cannot request prepare", zap.Error(err))
+
+				return retry.Unrecoverable(fmt.Errorf("%w: %w", ErrSendMetrics, err))
 			}
 
-			if err != nil || resp.StatusCode >= http.StatusInternalServerError {
+			if hash != "" {
+				req.Header.Set("HashSHA256", hash)
+			}
+
+			req.Header.Set(idempotency.Header, requestID)
+			c.setAgentHeaders(req)
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Accept-Encoding", "gzip")
+			req.Header.Set("Content-Encoding", "gzip")
+
+			resp, err := c.dc.Do(req)
+			if err != nil {
 				return fmt.Errorf("cannot do request: %w", err)
 			}
 
+			defer func() {
+				_ = resp.Body.Close()
+			}()
+
+			switch {
+			case resp.StatusCode == http.StatusNotImplemented:
+				return retry.Unrecoverable(&statusError{code: resp.StatusCode})
+			case resp.StatusCode >= http.StatusInternalServerError:
+				return &statusError{code: resp.StatusCode}
+			case resp.StatusCode >= http.StatusBadRequest:
+				return retry.Unrecoverable(readStatusError(resp))
+			}
+
 			return nil
 		},
 		retry.RetryIf(func(err error) bool {
-			return err != nil
+			return err != nil && retry.IsRecoverable(err)
 		}),
 		retry.Attempts(maxRetryAttempt),
 		retry.Context(ctx),
+		retry.LastErrorOnly(true),
 	)
 
 	if err != nil {
-		return fmt.Errorf("send metrics: %w", err)
+		return fmt.Errorf("%w: %w", ErrSendMetrics, err)
 	}
 
-	if metric.Value != nil {
-		c.logger.Debug("send metric",
-			zap.String("name", metric.ID),
-			zap.Float64("value", *metric.Value))
-	} else if metric.Delta != nil {
-		c.logger.Debug("send metric",
-			zap.String("name", metric.ID),
-			zap.Int64("value", *metric.Delta))
+	return nil
+}
+
+// readStatusError возвращает ошибку ответа с кодом 4xx. Для ответа 400 с json-телом
+// разбирает список отклонённых метрик (см. handlers.Handler.Updates).
+func readStatusError(resp *http.Response) *statusError {
+	se := &statusError{code: resp.StatusCode}
+
+	if resp.StatusCode != http.StatusBadRequest ||
+		!strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		return se
 	}
 
-	return nil
+	body := io.Reader(resp.Body)
+
+	if strings.Contains(resp.Header.Get("Content-Encoding"), "gzip") {
+		zr, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return se
+		}
+
+		defer zr.Close()
+
+		body = zr
+	}
+
+	batchErr := &model.BatchError{}
+	if err := json.NewDecoder(body).Decode(batchErr); err == nil && len(batchErr.Rejected) > 0 {
+		se.rejected = batchErr
+	}
+
+	return se
+}
+
+// setAgentHeaders передаёт серверу сведения об агенте для реестра агентов.
+func (c *Client) setAgentHeaders(req *http.Request) {
+	if c.set.ID == "" {
+		return
+	}
+
+	req.Header.Set(model.HeaderAgentID, c.set.ID)
+	req.Header.Set(model.HeaderAgentHost, c.set.Host)
+	req.Header.Set(model.HeaderAgentVersion, c.set.Version)
+
+	if c.set.ReportInterval > 0 {
+		req.Header.Set(model.HeaderAgentReportInterval, strconv.Itoa(c.set.ReportInterval))
+	}
 }
@@ -0,0 +1,266 @@
+package client
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/vorotislav/alert-service/internal/idempotency"
+	"github.com/vorotislav/alert-service/internal/model"
+	"github.com/vorotislav/alert-service/internal/settings/agent"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type recorder struct {
+	mu      sync.Mutex
+	batches [][]model.Metrics
+	single  []model.Metrics
+}
+
+func (rec *recorder) handler(t *testing.T, batchStatus int) http.HandlerFunc {
+	t.Helper()
+
+	return rec.handlerWithBody(t, batchStatus, "")
+}
+
+// handlerWithBody отвечает на пакет статусом batchStatus и json-телом batchBody, если оно задано.
+func (rec *recorder) handlerWithBody(t *testing.T, batchStatus int, batchBody string) http.HandlerFunc {
+	t.Helper()
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		zr, err := gzip.NewReader(r.Body)
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		rec.mu.Lock()
+		defer rec.mu.Unlock()
+
+		switch r.URL.Path {
+		case "/updates":
+			if batchStatus != http.StatusOK {
+				if batchBody != "" {
+					w.Header().Set("Content-Type", "application/json")
+				}
+
+				w.WriteHeader(batchStatus)
+				_, _ = w.Write([]byte(batchBody))
+
+				return
+			}
+
+			ms := make([]model.Metrics, 0)
+			assert.NoError(t, json.NewDecoder(zr).Decode(&ms))
+
+			rec.batches = append(rec.batches, ms)
+		case "/update":
+			m := model.Metrics{}
+			assert.NoError(t, json.NewDecoder(zr).Decode(&m))
+
+			rec.single = append(rec.single, m)
+		}
+	}
+}
+
+func testMetrics(n int) map[string]*model.Metrics {
+	ms := make(map[string]*model.Metrics, n)
+
+	for i := 0; i < n; i++ {
+		value := float64(i)
+		id := "metric" + string(rune('a'+i))
+
+		ms[id] = &model.Metrics{ID: id, MType: model.MetricGauge, Value: &value}
+	}
+
+	return ms
+}
+
+func newTestClient(t *testing.T, srv *httptest.Server, batchSize int) *Client {
+	t.Helper()
+
+	return NewClient(zap.NewNop(), &agent.Settings{
+		ServerAddress: strings.TrimPrefix(srv.URL, "http://"),
+		RateLimit:     2,
+		BatchSize:     batchSize,
+	})
+}
+
+func TestClient_SendMetricsBatch(t *testing.T) {
+	t.Parallel()
+
+	rec := &recorder{}
+	srv := httptest.NewServer(rec.handler(t, http.StatusOK))
+	defer srv.Close()
+
+	c := newTestClient(t, srv, 2)
+
+	require.NoError(t, c.SendMetrics("", testMetrics(5)))
+
+	require.Len(t, rec.batches, 3)
+	assert.Len(t, rec.batches[0], 2)
+	assert.Len(t, rec.batches[2], 1)
+	assert.Empty(t, rec.single)
+}
+
+func TestClient_SendMetricsFallback(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name            string
+		status          int
+		body            string
+		wantSingle      int
+		wantErr         bool
+		wantUnsupported bool
+	}{
+		{
+			name:       "rejected batch",
+			status:     http.StatusBadRequest,
+			body:       `{"rejected":[{"index":1,"id":"metricb","type":"gauge","reason":"no metrics value"}]}`,
+			wantSingle: 3,
+		},
+		{
+			name:    "bad request without rejected metrics",
+			status:  http.StatusBadRequest,
+			wantErr: true,
+		},
+		{
+			name:            "not found",
+			status:          http.StatusNotFound,
+			wantSingle:      3,
+			wantUnsupported: true,
+		},
+		{
+			name:            "not implemented",
+			status:          http.StatusNotImplemented,
+			wantSingle:      3,
+			wantUnsupported: true,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			rec := &recorder{}
+			srv := httptest.NewServer(rec.handlerWithBody(t, tc.status, tc.body))
+			defer srv.Close()
+
+			c := newTestClient(t, srv, 10)
+
+			err := c.SendMetrics("", testMetrics(3))
+			if tc.wantErr {
+				assert.ErrorIs(t, err, ErrUnexpectedStatus)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			assert.Len(t, rec.single, tc.wantSingle)
+			assert.Equal(t, tc.wantUnsupported, c.batchUnsupported.Load())
+		})
+	}
+}
+
+func TestClient_SendMetricsRequestKey(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu   sync.Mutex
+		keys = make(map[string][]string)
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		keys[r.URL.Path] = append(keys[r.URL.Path], r.Header.Get(idempotency.Header))
+		mu.Unlock()
+
+		if r.URL.Path == "/updates" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"rejected":[{"index":0,"id":"metrica","type":"gauge","reason":"bad"}]}`))
+		}
+	}))
+	defer srv.Close()
+
+	c := newTestClient(t, srv, 10)
+
+	// Повторная отправка пакета с тем же ключом идёт с теми же ключами запросов, и пакетных, и по одной метрике.
+	require.NoError(t, c.SendMetrics("batch-1", testMetrics(2)))
+	require.NoError(t, c.SendMetrics("batch-1", testMetrics(2)))
+	require.NoError(t, c.SendMetrics("batch-2", testMetrics(2)))
+
+	require.Len(t, keys["/updates"], 3)
+	assert.Equal(t, keys["/updates"][0], keys["/updates"][1])
+	assert.NotEqual(t, keys["/updates"][0], keys["/updates"][2])
+
+	require.Len(t, keys["/update"], 6)
+	assert.ElementsMatch(t, keys["/update"][0:2], keys["/update"][2:4])
+	assert.NotEqual(t, keys["/update"][0], keys["/update"][1])
+	assert.NotContains(t, keys["/update"][4:6], keys["/update"][0])
+}
+
+func TestClient_SendMetricsRejected(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/updates" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"rejected":[{"index":0,"id":"metrica","type":"gauge","reason":"bad"}]}`))
+
+			return
+		}
+
+		zr, err := gzip.NewReader(r.Body)
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		m := model.Metrics{}
+		assert.NoError(t, json.NewDecoder(zr).Decode(&m))
+
+		switch m.ID {
+		case "metrica":
+			w.WriteHeader(http.StatusBadRequest)
+		case "metricb":
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	c := newTestClient(t, srv, 10)
+
+	// Метрика, отклонённая сервером, не возвращается на повторную отправку, в отличие от метрики,
+	// не доставленной из-за ошибки сервера.
+	err := c.SendMetrics("", testMetrics(3))
+
+	var ue *model.UnsentError
+	require.ErrorAs(t, err, &ue)
+	require.Len(t, ue.Rejected, 1)
+	assert.Equal(t, "metrica", ue.Rejected[0].ID)
+	require.Len(t, ue.Metrics, 1)
+	assert.Equal(t, "metricb", ue.Metrics[0].ID)
+}
+
+func TestClient_SendMetricsError(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	c := newTestClient(t, srv, 10)
+
+	err := c.SendMetrics("", testMetrics(1))
+	require.ErrorIs(t, err, ErrSendMetrics)
+	assert.ErrorIs(t, err, ErrUnexpectedStatus)
+}
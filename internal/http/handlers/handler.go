@@ -4,11 +4,14 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"slices"
 	"strconv"
 	"time"
 
+	"github.com/vorotislav/alert-service/internal/agents"
 	"github.com/vorotislav/alert-service/internal/model"
 
 	"github.com/go-chi/chi/v5"
@@ -35,25 +38,56 @@ const (
 // Repository интерфейс хранилища, который необходим для работы с метриками.
 type Repository interface {
 	UpdateMetric(ctx context.Context, metric model.Metrics) (model.Metrics, error)
-	GetCounterValue(ctx context.Context, name string) (int64, error)
-	GetGaugeValue(ctx context.Context, name string) (float64, error)
+	GetCounterValue(ctx context.Context, name string, labels map[string]string) (int64, error)
+	GetGaugeValue(ctx context.Context, name string, labels map[string]string) (float64, error)
 	AllMetrics(ctx context.Context) ([]byte, error)
+	ListMetrics(ctx context.Context) ([]model.Metrics, error)
+	History(ctx context.Context, mtype, name string, labels map[string]string, from, to time.Time) ([]model.Sample, error)
 	Ping(ctx context.Context) error
 	UpdateMetrics(ctx context.Context, metrics []model.Metrics) error
 }
 
-// Handler обработчик. Хранит логгер и указатель на репозиторий.
+// Alerter интерфейс движка правил, который возвращает текущее состояние алертов.
+type Alerter interface {
+	Alerts() []model.Alert
+}
+
+// AgentRegistry интерфейс реестра агентов: отмечает агентов, приславших метрики, и возвращает их список.
+type AgentRegistry interface {
+	Observe(ctx context.Context, info agents.Info, metrics int)
+	List() []model.Agent
+}
+
+// Handler обработчик. Хранит логгер, указатель на репозиторий, движок правил и реестр агентов.
 type Handler struct {
-	log  *zap.Logger
-	repo Repository
+	log    *zap.Logger
+	repo   Repository
+	alerts Alerter
+	agents AgentRegistry
 }
 
-// NewHandler конструктор для Handler.
-func NewHandler(log *zap.Logger, r Repository) *Handler {
+// NewHandler конструктор для Handler. Движок правил и реестр агентов могут быть nil.
+func NewHandler(log *zap.Logger, r Repository, a Alerter, ar AgentRegistry) *Handler {
 	return &Handler{
-		log:  log,
-		repo: r,
+		log:    log,
+		repo:   r,
+		alerts: a,
+		agents: ar,
+	}
+}
+
+// observe отмечает в реестре агента, приславшего metrics метрик, если запрос пришёл от агента.
+func (h *Handler) observe(r *http.Request, metrics int) {
+	if h.agents == nil {
+		return
 	}
+
+	info, ok := agents.FromRequest(r)
+	if !ok {
+		return
+	}
+
+	h.agents.Observe(r.Context(), info, metrics)
 }
 
 func (h *Handler) logInfo(msg string, status, size int) {
@@ -174,7 +208,7 @@ func (h *Handler) updateGauge(w http.ResponseWriter, r *http.Request) {
 
 // UpdateJSON функция-обработчик для /update.
 // Endpoint принимает в качестве тела запроса json с описанием метрики и нового значения. Только одна метрика.
-func (h *Handler) UpdateJSON(w http.ResponseWriter, r *http.Request) { //nolint:funlen
+func (h *Handler) UpdateJSON(w http.ResponseWriter, r *http.Request) {
 	if contentType := r.Header.Get("Content-Type"); contentType != jsonContentType {
 		h.logInfo(fmt.Sprintf("Failed to update metrics: unknown ContentType %s", contentType),
 			http.StatusBadRequest, 0)
@@ -194,56 +228,28 @@ func (h *Handler) UpdateJSON(w http.ResponseWriter, r *http.Request) { //nolint:
 		return
 	}
 
-	var err error
-
-	ctx, cancel := context.WithTimeout(r.Context(), queryRepoTimeout)
-	defer cancel()
-
-	switch m.MType {
-	case MetricGauge:
-		if m.Value == nil {
-			h.logInfo("Failed update metrics: no metrics value", http.StatusBadRequest, 0)
-
-			http.Error(w, "no metrics value", http.StatusBadRequest)
-
-			return
-		}
-
-		m, err = h.repo.UpdateMetric(ctx, m)
-		if err != nil {
-			h.logInfo(fmt.Sprintf("Failed update metrics: %s", err.Error()), http.StatusBadRequest, 0)
+	if err := m.Validate(); err != nil {
+		h.logInfo(fmt.Sprintf("Failed update metrics: %s", err.Error()), http.StatusBadRequest, 0)
 
-			http.Error(w, fmt.Sprintf("update metrics value: %s", err.Error()), http.StatusBadRequest)
+		http.Error(w, fmt.Sprintf("invalid metric: %s", err.Error()), http.StatusBadRequest)
 
-			return
-		}
-
-	case MetricCounter:
-		if m.Delta == nil {
-			h.logInfo("Failed update metrics: no metrics value", http.StatusBadRequest, 0)
-
-			http.Error(w, "no metrics value", http.StatusBadRequest)
-
-			return
-		}
-
-		m, err = h.repo.UpdateMetric(ctx, m)
-		if err != nil {
-			h.logInfo(fmt.Sprintf("Failed update metrics: %s", err.Error()), http.StatusBadRequest, 0)
-
-			http.Error(w, fmt.Sprintf("update metrics value: %s", err.Error()), http.StatusBadRequest)
+		return
+	}
 
-			return
-		}
+	ctx, cancel := context.WithTimeout(r.Context(), queryRepoTimeout)
+	defer cancel()
 
-	default:
-		h.logInfo("Failed update metrics: unknown metrics type", http.StatusBadRequest, 0)
+	m, err := h.repo.UpdateMetric(ctx, m)
+	if err != nil {
+		h.logInfo(fmt.Sprintf("Failed update metrics: %s", err.Error()), http.StatusInternalServerError, 0)
 
-		http.Error(w, "unknown metrics type", http.StatusBadRequest)
+		http.Error(w, fmt.Sprintf("update metrics value: %s", err.Error()), http.StatusInternalServerError)
 
 		return
 	}
 
+	h.observe(r, 1)
+
 	resp, err := json.Marshal(m)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -263,6 +269,8 @@ func (h *Handler) UpdateJSON(w http.ResponseWriter, r *http.Request) { //nolint:
 }
 
 // Updates функция-обработчик для /updates. Тело состоит из массива json-объектов, с описанием метрики и нового значения.
+// Если хранилище отклонило метрики пакета, в ответе со статусом 400 возвращается их список,
+// при остальных ошибках хранилища возвращается статус 500.
 func (h *Handler) Updates(w http.ResponseWriter, r *http.Request) {
 	if contentType := r.Header.Get("Content-Type"); contentType != jsonContentType {
 		h.logInfo(fmt.Sprintf("Failed to update metrics: unknown Content-Type: %s", contentType),
@@ -289,14 +297,27 @@ func (h *Handler) Updates(w http.ResponseWriter, r *http.Request) {
 	defer cancel()
 
 	if err := h.repo.UpdateMetrics(ctx, metrics); err != nil {
+		var batchErr *model.BatchError
+		if errors.As(err, &batchErr) {
+			h.logInfo(fmt.Sprintf("Failed to update metrics: %s", err.Error()),
+				http.StatusBadRequest, 0)
+
+			h.writeRejected(w, batchErr)
+
+			return
+		}
+
+		// Остальные ошибки - сбой хранилища, а не некорректный пакет: клиент должен повторить пакет целиком.
 		h.logInfo(fmt.Sprintf("Failed to update metrics: %s", err.Error()),
-			http.StatusBadRequest, 0)
+			http.StatusInternalServerError, 0)
 
-		http.Error(w, fmt.Sprintf("cannot update metrics: %s", err.Error()), http.StatusBadRequest)
+		http.Error(w, fmt.Sprintf("cannot update metrics: %s", err.Error()), http.StatusInternalServerError)
 
 		return
 	}
 
+	h.observe(r, len(metrics))
+
 	setContentType(w, jsonContentType)
 	w.WriteHeader(http.StatusOK)
 
@@ -309,10 +330,29 @@ func (h *Handler) Updates(w http.ResponseWriter, r *http.Request) {
 	h.logInfo("Success update metrics", http.StatusOK, size)
 }
 
+func (h *Handler) writeRejected(w http.ResponseWriter, batchErr *model.BatchError) {
+	resp, err := json.Marshal(batchErr)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+
+		return
+	}
+
+	setContentType(w, jsonContentType)
+	w.WriteHeader(http.StatusBadRequest)
+
+	if _, err := w.Write(resp); err != nil {
+		h.logInfo(fmt.Sprintf("Error of write resp: %s", err.Error()),
+			http.StatusInternalServerError, 0)
+	}
+}
+
 // Value функция-обработчик для /values/counter/SomeMetric. В запросе указывается тип и название метрики и возвращается последнее значение метрики.
+// Серия метрики выбирается по меткам из параметров запроса, например /value/gauge/HeapAlloc?host=web-1.
 func (h *Handler) Value(w http.ResponseWriter, r *http.Request) {
 	metricType := chi.URLParam(r, "metricType")
 	metricName := chi.URLParam(r, "metricName")
+	labels := queryLabels(r)
 
 	var size int
 
@@ -321,11 +361,9 @@ func (h *Handler) Value(w http.ResponseWriter, r *http.Request) {
 
 	switch metricType {
 	case MetricGauge:
-		value, err := h.repo.GetGaugeValue(ctx, metricName)
+		value, err := h.repo.GetGaugeValue(ctx, metricName, labels)
 		if err != nil {
-			h.logInfo("Failed to update gauge metrics", http.StatusNotFound, 0)
-
-			http.Error(w, fmt.Sprintf("metrics %s if not found", metricName), http.StatusNotFound)
+			h.lookupError(w, metricName, err)
 
 			return
 		}
@@ -337,12 +375,9 @@ func (h *Handler) Value(w http.ResponseWriter, r *http.Request) {
 		}
 
 	case MetricCounter:
-		value, err := h.repo.GetCounterValue(ctx, metricName)
+		value, err := h.repo.GetCounterValue(ctx, metricName, labels)
 		if err != nil {
-			h.logInfo(fmt.Sprintf("Failed to get counter metrics: %s", err.Error()),
-				http.StatusNotFound, 0)
-
-			http.Error(w, fmt.Sprintf("metrics %s if not found", metricName), http.StatusNotFound)
+			h.lookupError(w, metricName, err)
 
 			return
 		}
@@ -364,7 +399,43 @@ func (h *Handler) Value(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
+// lookupError отвечает на ошибку поиска метрики: 400, если под метки подходят несколько серий, иначе 404.
+func (h *Handler) lookupError(w http.ResponseWriter, name string, err error) {
+	if errors.Is(err, model.ErrAmbiguousSeries) {
+		h.logInfo(fmt.Sprintf("Failed to get metrics: %s", err.Error()), http.StatusBadRequest, 0)
+
+		http.Error(w, fmt.Sprintf("metrics %s: %s", name, err.Error()), http.StatusBadRequest)
+
+		return
+	}
+
+	h.logInfo(fmt.Sprintf("Failed to get metrics: %s", err.Error()), http.StatusNotFound, 0)
+
+	http.Error(w, fmt.Sprintf("metrics %s if not found", name), http.StatusNotFound)
+}
+
+// queryLabels возвращает метки из параметров запроса, кроме перечисленных в skip.
+func queryLabels(r *http.Request, skip ...string) map[string]string {
+	query := r.URL.Query()
+	if len(query) == 0 {
+		return nil
+	}
+
+	labels := make(map[string]string, len(query))
+
+	for name, values := range query {
+		if slices.Contains(skip, name) || len(values) == 0 {
+			continue
+		}
+
+		labels[name] = values[0]
+	}
+
+	return labels
+}
+
 // ValueJSON функция-обработчик для /value. Через POST запрос передаётся json-объект с указанием метрики, значение которой необходимо вернуть.
+// Серия метрики выбирается по полю labels.
 func (h *Handler) ValueJSON(w http.ResponseWriter, r *http.Request) { //nolint:funlen
 	if contentType := r.Header.Get("Content-Type"); contentType != jsonContentType {
 		h.logInfo(fmt.Sprintf("Failed to get metrics: unknown Content-Type: %s", contentType),
@@ -398,22 +469,18 @@ func (h *Handler) ValueJSON(w http.ResponseWriter, r *http.Request) { //nolint:f
 
 	switch m.MType {
 	case MetricGauge:
-		value, err := h.repo.GetGaugeValue(ctx, m.ID)
+		value, err := h.repo.GetGaugeValue(ctx, m.ID, m.Labels)
 		if err != nil {
-			h.logInfo("Failed to get gauge metrics", http.StatusNotFound, 0)
-
-			http.Error(w, fmt.Sprintf("metrics %s if not found", m.ID), http.StatusNotFound)
+			h.lookupError(w, m.ID, err)
 
 			return
 		}
 
 		m.Value = &value
 	case MetricCounter:
-		value, err := h.repo.GetCounterValue(ctx, m.ID)
+		value, err := h.repo.GetCounterValue(ctx, m.ID, m.Labels)
 		if err != nil {
-			h.logInfo("Failed to get counter metrics", http.StatusNotFound, 0)
-
-			http.Error(w, fmt.Sprintf("metrics %s if not found", m.ID), http.StatusNotFound)
+			h.lookupError(w, m.ID, err)
 
 			return
 		}
@@ -471,3 +538,53 @@ func (h *Handler) AllValue(w http.ResponseWriter, r *http.Request) {
 
 	h.logInfo("Get all metrics", http.StatusOK, size)
 }
+
+// Alerts функция-обработчик для /alerts. Возвращает текущее состояние всех правил алертинга.
+func (h *Handler) Alerts(w http.ResponseWriter, _ *http.Request) {
+	alerts := make([]model.Alert, 0)
+	if h.alerts != nil {
+		alerts = h.alerts.Alerts()
+	}
+
+	resp, err := json.Marshal(alerts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+
+		return
+	}
+
+	setContentType(w, jsonContentType)
+	w.WriteHeader(http.StatusOK)
+
+	size, err := w.Write(resp)
+	if err != nil {
+		h.logInfo(fmt.Sprintf("Error of write resp: %s", err.Error()), http.StatusInternalServerError, 0)
+	}
+
+	h.logInfo("Get alerts", http.StatusOK, size)
+}
+
+// Agents функция-обработчик для /agents. Возвращает агентов, которые присылали метрики, и пропавших среди них.
+func (h *Handler) Agents(w http.ResponseWriter, _ *http.Request) {
+	list := make([]model.Agent, 0)
+	if h.agents != nil {
+		list = h.agents.List()
+	}
+
+	resp, err := json.Marshal(list)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+
+		return
+	}
+
+	setContentType(w, jsonContentType)
+	w.WriteHeader(http.StatusOK)
+
+	size, err := w.Write(resp)
+	if err != nil {
+		h.logInfo(fmt.Sprintf("Error of write resp: %s", err.Error()), http.StatusInternalServerError, 0)
+	}
+
+	h.logInfo("Get agents", http.StatusOK, size)
+}
@@ -6,12 +6,15 @@ import (
 	"encoding/json"
 	"errors"
 	"io"
+	"math"
 	"net/http"
 	"net/http/httptest"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/vorotislav/alert-service/internal/agents"
 	"github.com/vorotislav/alert-service/internal/http/handlers/mocks"
 	"github.com/vorotislav/alert-service/internal/http/middlewares"
 	"github.com/vorotislav/alert-service/internal/model"
@@ -105,6 +108,7 @@ func TestHandler_Updates(t *testing.T) {
 		giveMethod     string
 		giveBody       []byte
 		wantStatusCode int
+		wantBody       string
 	}{
 		{
 			name: "success metrics",
@@ -122,7 +126,19 @@ func TestHandler_Updates(t *testing.T) {
 			},
 			giveMethod:     http.MethodPost,
 			giveBody:       []byte(`[{"id":"some counter", "mtype":"counter", "delta":1},{"id":"some counter", "type":"counter", "delta":1}]`),
+			wantStatusCode: http.StatusInternalServerError,
+		},
+		{
+			name: "rejected metrics",
+			prepareRepo: func(repository *mocks.MockRepository) {
+				repository.EXPECT().UpdateMetrics(gomock.Any(), gomock.Any()).Return(&model.BatchError{
+					Rejected: []model.RejectedMetric{{Index: 1, ID: "some gauge", MType: "gauge", Reason: "no metrics value"}},
+				})
+			},
+			giveMethod:     http.MethodPost,
+			giveBody:       []byte(`[{"id":"some counter", "type":"counter", "delta":1},{"id":"some gauge", "type":"gauge"}]`),
 			wantStatusCode: http.StatusBadRequest,
+			wantBody:       `{"rejected":[{"index":1,"id":"some gauge","type":"gauge","reason":"no metrics value"}]}`,
 		},
 		{
 			name:           "failed update cannot decode",
@@ -170,6 +186,12 @@ func TestHandler_Updates(t *testing.T) {
 			defer res.Body.Close()
 
 			assert.Equal(t, tc.wantStatusCode, res.StatusCode)
+
+			if tc.wantBody != "" {
+				body, err := io.ReadAll(res.Body)
+				require.NoError(t, err)
+				assert.JSONEq(t, tc.wantBody, string(body))
+			}
 		})
 	}
 }
@@ -307,6 +329,15 @@ func TestHandler_UpdateJSON(t *testing.T) {
 			giveMethod:     http.MethodPost,
 			wantStatusCode: http.StatusOK,
 		},
+		{
+			name: "storage error",
+			prepareRepo: func(repository *mocks.MockRepository) {
+				repository.EXPECT().UpdateMetric(gomock.Any(), gomock.Any()).Return(model.Metrics{}, errors.New("some error"))
+			},
+			giveBody:       []byte(`{"id":"some counter", "type":"counter", "delta":1}`),
+			giveMethod:     http.MethodPost,
+			wantStatusCode: http.StatusInternalServerError,
+		},
 		{
 			name:           "method not allowed counter",
 			giveMethod:     http.MethodGet,
@@ -340,6 +371,18 @@ func TestHandler_UpdateJSON(t *testing.T) {
 			giveBody:       []byte(`{"id":"some metrics", "type":"gauge"}`),
 			wantStatusCode: http.StatusBadRequest,
 		},
+		{
+			name:           "empty id",
+			giveMethod:     http.MethodPost,
+			giveBody:       []byte(`{"id":"", "type":"gauge", "value":1}`),
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid label",
+			giveMethod:     http.MethodPost,
+			giveBody:       []byte(`{"id":"some metrics", "type":"gauge", "value":1, "labels":{"__host":"a"}}`),
+			wantStatusCode: http.StatusBadRequest,
+		},
 	}
 	for _, tc := range cases {
 		tc := tc
@@ -401,7 +444,7 @@ func TestHandler_Value(t *testing.T) {
 		{
 			name: "success counter",
 			prepareRepo: func(repository *mocks.MockRepository) {
-				repository.EXPECT().GetCounterValue(gomock.Any(), gomock.Any()).Return(int64(15), nil)
+				repository.EXPECT().GetCounterValue(gomock.Any(), gomock.Any(), gomock.Any()).Return(int64(15), nil)
 			},
 			giveMethod:     http.MethodGet,
 			givePath:       "/value/counter/PollCount",
@@ -417,13 +460,34 @@ func TestHandler_Value(t *testing.T) {
 		{
 			name: "success",
 			prepareRepo: func(repository *mocks.MockRepository) {
-				repository.EXPECT().GetGaugeValue(gomock.Any(), gomock.Any()).Return(float64(11.1), nil)
+				repository.EXPECT().GetGaugeValue(gomock.Any(), gomock.Any(), gomock.Any()).Return(float64(11.1), nil)
 			},
 			giveMethod:     http.MethodGet,
 			givePath:       "/value/gauge/mymetric",
 			wantStatusCode: http.StatusOK,
 			wantValue:      11.1,
 		},
+		{
+			name: "select by labels",
+			prepareRepo: func(repository *mocks.MockRepository) {
+				repository.EXPECT().GetGaugeValue(gomock.Any(), "mymetric", map[string]string{"host": "web-1"}).
+					Return(float64(2.5), nil)
+			},
+			giveMethod:     http.MethodGet,
+			givePath:       "/value/gauge/mymetric?host=web-1",
+			wantStatusCode: http.StatusOK,
+			wantValue:      2.5,
+		},
+		{
+			name: "ambiguous labels",
+			prepareRepo: func(repository *mocks.MockRepository) {
+				repository.EXPECT().GetGaugeValue(gomock.Any(), "mymetric", gomock.Any()).
+					Return(float64(0), model.ErrAmbiguousSeries)
+			},
+			giveMethod:     http.MethodGet,
+			givePath:       "/value/gauge/mymetric",
+			wantStatusCode: http.StatusBadRequest,
+		},
 		{
 			name:           "not allowed",
 			giveMethod:     http.MethodPost,
@@ -471,7 +535,7 @@ func TestHandler_Value(t *testing.T) {
 			defer res.Body.Close()
 			body, err := io.ReadAll(res.Body)
 			require.NoError(t, err)
-			if len(body) > 0 {
+			if len(body) > 0 && res.StatusCode == http.StatusOK {
 				value, err := strconv.ParseFloat(string(body), 64)
 				require.NoError(t, err)
 				assert.Equal(t, tc.wantValue, value)
@@ -510,7 +574,7 @@ func TestHandler_ValueJSON(t *testing.T) {
 		{
 			name: "success counter",
 			prepareRepo: func(repository *mocks.MockRepository) {
-				repository.EXPECT().GetCounterValue(gomock.Any(), gomock.Any()).Return(int64(15), nil)
+				repository.EXPECT().GetCounterValue(gomock.Any(), gomock.Any(), gomock.Any()).Return(int64(15), nil)
 			},
 			giveMethod:     http.MethodPost,
 			giveBody:       []byte(`{"id":"PollCount", "type":"counter"}`),
@@ -530,7 +594,7 @@ func TestHandler_ValueJSON(t *testing.T) {
 		{
 			name: "Counter not found",
 			prepareRepo: func(repository *mocks.MockRepository) {
-				repository.EXPECT().GetCounterValue(gomock.Any(), gomock.Any()).Return(int64(0), errors.New("some error"))
+				repository.EXPECT().GetCounterValue(gomock.Any(), gomock.Any(), gomock.Any()).Return(int64(0), errors.New("some error"))
 			},
 			giveMethod:     http.MethodPost,
 			giveBody:       []byte(`{"id":"some name", "type":"counter"}`),
@@ -539,7 +603,7 @@ func TestHandler_ValueJSON(t *testing.T) {
 		{
 			name: "success gauge",
 			prepareRepo: func(repository *mocks.MockRepository) {
-				repository.EXPECT().GetGaugeValue(gomock.Any(), gomock.Any()).Return(float64(11.1), nil)
+				repository.EXPECT().GetGaugeValue(gomock.Any(), gomock.Any(), gomock.Any()).Return(float64(11.1), nil)
 			},
 			giveBody:       []byte(`{"id":"mymetric", "type":"gauge"}`),
 			giveMethod:     http.MethodPost,
@@ -626,7 +690,7 @@ func TestNewHandler(t *testing.T) {
 
 	m := mocks.NewMockRepository(ctrl)
 
-	h := NewHandler(log, m)
+	h := NewHandler(log, m, nil, nil)
 	require.NotNil(t, h)
 }
 
@@ -789,3 +853,301 @@ func BenchmarkHandler_UpdateJSON(b *testing.B) {
 
 	}
 }
+
+func TestHandler_Metrics(t *testing.T) {
+	t.Parallel()
+
+	log, err := zap.NewDevelopment()
+	require.NoError(t, err)
+
+	delta := int64(15)
+	value := 11.5
+	nan := math.NaN()
+
+	cases := []struct {
+		name           string
+		prepareRepo    func(repository *mocks.MockRepository)
+		wantStatusCode int
+		wantBody       string
+	}{
+		{
+			name: "success",
+			prepareRepo: func(repository *mocks.MockRepository) {
+				repository.EXPECT().ListMetrics(gomock.Any()).Return([]model.Metrics{
+					{ID: "PollCount", MType: model.MetricCounter, Delta: &delta},
+					{ID: "HeapAlloc", MType: model.MetricGauge, Value: &value},
+					{ID: "1cpu.util-total", MType: model.MetricGauge, Value: &value},
+					{ID: "1cpu util-total", MType: model.MetricGauge, Value: &value},
+					{ID: "Random", MType: model.MetricGauge, Value: &nan},
+					{ID: "NoValue", MType: model.MetricGauge},
+				}, nil)
+			},
+			wantStatusCode: http.StatusOK,
+			wantBody: "# TYPE HeapAlloc gauge\nHeapAlloc 11.5\n" +
+				"# TYPE PollCount counter\nPollCount 15\n" +
+				"# TYPE Random gauge\nRandom NaN\n" +
+				"# TYPE _1cpu_util_total gauge\n_1cpu_util_total 11.5\n",
+		},
+		{
+			name: "labels",
+			prepareRepo: func(repository *mocks.MockRepository) {
+				repository.EXPECT().ListMetrics(gomock.Any()).Return([]model.Metrics{
+					{ID: "HeapAlloc", MType: model.MetricGauge, Value: &value, Labels: map[string]string{"host": "a"}},
+					{ID: "HeapAlloc", MType: model.MetricGauge, Value: &value,
+						Labels: map[string]string{"host": "b", "dc": "eu"}},
+					{ID: "HeapAlloc", MType: model.MetricCounter, Delta: &delta, Labels: map[string]string{"host": "c"}},
+				}, nil)
+			},
+			wantStatusCode: http.StatusOK,
+			wantBody: "# TYPE HeapAlloc gauge\nHeapAlloc{dc=\"eu\",host=\"b\"} 11.5\n" +
+				"HeapAlloc{host=\"a\"} 11.5\n",
+		},
+		{
+			name: "label value escaping",
+			prepareRepo: func(repository *mocks.MockRepository) {
+				repository.EXPECT().ListMetrics(gomock.Any()).Return([]model.Metrics{
+					{ID: "Probe", MType: model.MetricGauge, Value: &value,
+						Labels: map[string]string{"path": "C:\\tmp\n\"ü\"\t"}},
+				}, nil)
+			},
+			wantStatusCode: http.StatusOK,
+			wantBody:       "# TYPE Probe gauge\nProbe{path=\"C:\\\\tmp\\n\\\"ü\\\"\t\"} 11.5\n",
+		},
+		{
+			name: "family split by sanitizing",
+			prepareRepo: func(repository *mocks.MockRepository) {
+				repository.EXPECT().ListMetrics(gomock.Any()).Return([]model.Metrics{
+					{ID: "disk.used", MType: model.MetricGauge, Value: &value, Labels: map[string]string{"mount": "/"}},
+					{ID: "disk.zeta", MType: model.MetricGauge, Value: &value},
+					{ID: "disk_used", MType: model.MetricGauge, Value: &value, Labels: map[string]string{"mount": "/home"}},
+				}, nil)
+			},
+			wantStatusCode: http.StatusOK,
+			wantBody: "# TYPE disk_used gauge\ndisk_used{mount=\"/\"} 11.5\n" +
+				"disk_used{mount=\"/home\"} 11.5\n" +
+				"# TYPE disk_zeta gauge\ndisk_zeta 11.5\n",
+		},
+		{
+			name: "repository error",
+			prepareRepo: func(repository *mocks.MockRepository) {
+				repository.EXPECT().ListMetrics(gomock.Any()).Return(nil, errors.New("some error"))
+			},
+			wantStatusCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			m := mocks.NewMockRepository(ctrl)
+			if tc.prepareRepo != nil {
+				tc.prepareRepo(m)
+			}
+
+			h := &Handler{
+				log:  log,
+				repo: m,
+			}
+
+			r := chi.NewRouter()
+			r.Get("/metrics", h.Metrics)
+
+			server := httptest.NewServer(r)
+			defer server.Close()
+
+			request, err := http.NewRequest(http.MethodGet, server.URL+"/metrics", http.NoBody)
+			require.NoError(t, err)
+
+			res, err := server.Client().Do(request)
+			require.NoError(t, err)
+			defer res.Body.Close()
+
+			assert.Equal(t, tc.wantStatusCode, res.StatusCode)
+
+			if tc.wantBody != "" {
+				body, err := io.ReadAll(res.Body)
+				require.NoError(t, err)
+				assert.Equal(t, tc.wantBody, string(body))
+				assert.Equal(t, prometheusContentType, res.Header.Get("Content-Type"))
+			}
+		})
+	}
+}
+
+func TestHandler_History(t *testing.T) {
+	t.Parallel()
+
+	log, err := zap.NewDevelopment()
+	require.NoError(t, err)
+
+	from := time.Date(2023, 10, 20, 12, 0, 0, 0, time.UTC)
+	to := from.Add(2 * time.Minute)
+
+	cases := []struct {
+		name           string
+		prepareRepo    func(repository *mocks.MockRepository)
+		givePath       string
+		wantStatusCode int
+		wantPoints     []model.HistoryPoint
+	}{
+		{
+			name: "success",
+			prepareRepo: func(repository *mocks.MockRepository) {
+				repository.EXPECT().History(gomock.Any(), model.MetricGauge, "HeapAlloc", gomock.Any(), from, to).
+					Return([]model.Sample{
+						{Timestamp: from.Add(10 * time.Second), Value: 2},
+						{Timestamp: from.Add(20 * time.Second), Value: 4},
+						{Timestamp: from.Add(70 * time.Second), Value: 8},
+					}, nil)
+			},
+			givePath:       "/history/gauge/HeapAlloc?from=2023-10-20T12:00:00Z&to=1697803320&step=1m",
+			wantStatusCode: http.StatusOK,
+			wantPoints: []model.HistoryPoint{
+				{Timestamp: from, Min: 2, Max: 4, Avg: 3, Count: 2},
+				{Timestamp: from.Add(time.Minute), Min: 8, Max: 8, Avg: 8, Count: 1},
+			},
+		},
+		{
+			name:           "unknown type",
+			givePath:       "/history/histogram/HeapAlloc",
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "bad step",
+			givePath:       "/history/gauge/HeapAlloc?step=-1",
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "bad range",
+			givePath:       "/history/gauge/HeapAlloc?from=1697803320&to=1697803200",
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "too many points",
+			givePath:       "/history/gauge/HeapAlloc?from=0&step=1s",
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name: "repository error",
+			prepareRepo: func(repository *mocks.MockRepository) {
+				repository.EXPECT().History(gomock.Any(), model.MetricCounter, "PollCount", gomock.Any(), gomock.Any(), gomock.Any()).
+					Return(nil, errors.New("some error"))
+			},
+			givePath:       "/history/counter/PollCount",
+			wantStatusCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			m := mocks.NewMockRepository(ctrl)
+			if tc.prepareRepo != nil {
+				tc.prepareRepo(m)
+			}
+
+			h := &Handler{
+				log:  log,
+				repo: m,
+			}
+
+			r := chi.NewRouter()
+			r.Get("/history/{metricType}/{metricName}", h.History)
+
+			server := httptest.NewServer(r)
+			defer server.Close()
+
+			request, err := http.NewRequest(http.MethodGet, server.URL+tc.givePath, http.NoBody)
+			require.NoError(t, err)
+
+			res, err := server.Client().Do(request)
+			require.NoError(t, err)
+			defer res.Body.Close()
+
+			assert.Equal(t, tc.wantStatusCode, res.StatusCode)
+
+			if tc.wantPoints != nil {
+				hist := model.History{}
+				require.NoError(t, json.NewDecoder(res.Body).Decode(&hist))
+				assert.Equal(t, tc.wantPoints, hist.Points)
+				assert.Equal(t, "1m0s", hist.Step)
+			}
+		})
+	}
+}
+
+func TestHandler_Agents(t *testing.T) {
+	t.Parallel()
+
+	log, err := zap.NewDevelopment()
+	require.NoError(t, err)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	m := mocks.NewMockRepository(ctrl)
+	m.EXPECT().UpdateMetrics(gomock.Any(), gomock.Any()).Return(nil).Times(2)
+	m.EXPECT().UpdateMetric(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, metric model.Metrics) (model.Metrics, error) {
+			assert.Equal(t, agents.MetricUp, metric.ID)
+			assert.Equal(t, map[string]string{agents.LabelAgent: "a1", model.LabelHost: "web-1"}, metric.Labels)
+
+			return metric, nil
+		})
+
+	h := NewHandler(log, m, nil, agents.NewRegistry(log, &srv.Settings{}, m))
+
+	r := chi.NewRouter()
+	r.Post("/updates/", h.Updates)
+	r.Get("/agents", h.Agents)
+
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	send := func(withAgent bool) {
+		request, err := http.NewRequest(http.MethodPost, server.URL+"/updates/",
+			strings.NewReader(`[{"id":"PollCount","type":"counter","delta":1},{"id":"HeapAlloc","type":"gauge","value":1}]`))
+		require.NoError(t, err)
+
+		request.Header.Set("Content-Type", jsonContentType)
+
+		if withAgent {
+			request.Header.Set(model.HeaderAgentID, "a1")
+			request.Header.Set(model.HeaderAgentHost, "web-1")
+			request.Header.Set(model.HeaderAgentVersion, "v1.0.0")
+		}
+
+		res, err := server.Client().Do(request)
+		require.NoError(t, err)
+		require.NoError(t, res.Body.Close())
+		require.Equal(t, http.StatusOK, res.StatusCode)
+	}
+
+	send(true)
+	send(false)
+
+	res, err := server.Client().Get(server.URL + "/agents")
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	list := make([]model.Agent, 0)
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&list))
+	require.Len(t, list, 1)
+	assert.Equal(t, "a1", list[0].ID)
+	assert.Equal(t, "v1.0.0", list[0].Version)
+	assert.Equal(t, "127.0.0.1", list[0].Address)
+	assert.Equal(t, int64(2), list[0].Metrics)
+	assert.False(t, list[0].Stale)
+}
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/vorotislav/alert-service/internal/history"
+	"github.com/vorotislav/alert-service/internal/model"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	defaultHistoryRange = time.Hour
+	defaultHistoryStep  = time.Minute
+	maxHistoryPoints    = 11000
+)
+
+var (
+	errBadTime  = errors.New("bad time")
+	errBadStep  = errors.New("bad step")
+	errBadRange = errors.New("bad range")
+)
+
+// History функция-обработчик для /history/gauge/SomeMetric?from=&to=&step=.
+// from и to задаются в формате RFC3339 или в секундах Unix-времени, step - длительностью ("30s") или в секундах.
+// Возвращает выровненные по шагу точки с минимальным, максимальным и средним значением за шаг.
+// Остальные параметры запроса - метки, по которым выбирается серия метрики.
+func (h *Handler) History(w http.ResponseWriter, r *http.Request) {
+	metricType := chi.URLParam(r, "metricType")
+	metricName := chi.URLParam(r, "metricName")
+
+	if metricType != MetricGauge && metricType != MetricCounter {
+		h.logInfo("Failed get history: unknown metrics type", http.StatusBadRequest, 0)
+
+		http.Error(w, "unknown metrics type", http.StatusBadRequest)
+
+		return
+	}
+
+	from, to, step, err := parseHistoryQuery(r, time.Now())
+	if err != nil {
+		h.logInfo(fmt.Sprintf("Failed get history: %s", err.Error()), http.StatusBadRequest, 0)
+
+		http.Error(w, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), queryRepoTimeout)
+	defer cancel()
+
+	labels := queryLabels(r, "from", "to", "step")
+
+	samples, err := h.repo.History(ctx, metricType, metricName, labels, from, to)
+	if errors.Is(err, model.ErrAmbiguousSeries) {
+		h.lookupError(w, metricName, err)
+
+		return
+	}
+
+	if err != nil {
+		h.logInfo(fmt.Sprintf("Failed get history: %s", err.Error()), http.StatusInternalServerError, 0)
+
+		http.Error(w, fmt.Sprintf("cannot get history: %s", err.Error()), http.StatusInternalServerError)
+
+		return
+	}
+
+	resp, err := json.Marshal(model.History{
+		ID:     metricName,
+		MType:  metricType,
+		Labels: labels,
+		From:   from,
+		To:     to,
+		Step:   step.String(),
+		Points: history.Aggregate(samples, from, to, step),
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+
+		return
+	}
+
+	setContentType(w, jsonContentType)
+	w.WriteHeader(http.StatusOK)
+
+	size, err := w.Write(resp)
+	if err != nil {
+		h.logInfo(fmt.Sprintf("Error of write resp: %s", err.Error()), http.StatusInternalServerError, 0)
+	}
+
+	h.logInfo("Get metrics history", http.StatusOK, size)
+}
+
+func parseHistoryQuery(r *http.Request, now time.Time) (time.Time, time.Time, time.Duration, error) {
+	q := r.URL.Query()
+
+	to := now.UTC()
+
+	if raw := q.Get("to"); raw != "" {
+		t, err := parseTime(raw)
+		if err != nil {
+			return time.Time{}, time.Time{}, 0, fmt.Errorf("to: %w", err)
+		}
+
+		to = t
+	}
+
+	from := to.Add(-defaultHistoryRange)
+
+	if raw := q.Get("from"); raw != "" {
+		t, err := parseTime(raw)
+		if err != nil {
+			return time.Time{}, time.Time{}, 0, fmt.Errorf("from: %w", err)
+		}
+
+		from = t
+	}
+
+	step := defaultHistoryStep
+
+	if raw := q.Get("step"); raw != "" {
+		s, err := parseStep(raw)
+		if err != nil {
+			return time.Time{}, time.Time{}, 0, fmt.Errorf("step: %w", err)
+		}
+
+		step = s
+	}
+
+	if !from.Before(to) {
+		return time.Time{}, time.Time{}, 0, fmt.Errorf("%w: from must be before to", errBadRange)
+	}
+
+	if to.Sub(from)/step > maxHistoryPoints {
+		return time.Time{}, time.Time{}, 0, fmt.Errorf("%w: too many points, increase step", errBadRange)
+	}
+
+	return from, to, step, nil
+}
+
+func parseTime(raw string) (time.Time, error) {
+	if sec, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		return time.Unix(sec, 0).UTC(), nil
+	}
+
+	t, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %s", errBadTime, raw)
+	}
+
+	return t.UTC(), nil
+}
+
+func parseStep(raw string) (time.Duration, error) {
+	var step time.Duration
+
+	if sec, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		step = time.Duration(sec) * time.Second
+	} else {
+		step, err = time.ParseDuration(raw)
+		if err != nil {
+			return 0, fmt.Errorf("%w: %s", errBadStep, raw)
+		}
+	}
+
+	if step <= 0 {
+		return 0, fmt.Errorf("%w: %s", errBadStep, raw)
+	}
+
+	return step, nil
+}
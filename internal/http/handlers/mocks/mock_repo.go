@@ -7,6 +7,7 @@ package mocks
 import (
 	context "context"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 	model "github.com/vorotislav/alert-service/internal/model"
@@ -51,33 +52,63 @@ func (mr *MockRepositoryMockRecorder) AllMetrics(arg0 interface{}) *gomock.Call
 }
 
 // GetCounterValue mocks base method.
-func (m *MockRepository) GetCounterValue(arg0 context.Context, arg1 string) (int64, error) {
+func (m *MockRepository) GetCounterValue(arg0 context.Context, arg1 string, arg2 map[string]string) (int64, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetCounterValue", arg0, arg1)
+	ret := m.ctrl.Call(m, "GetCounterValue", arg0, arg1, arg2)
 	ret0, _ := ret[0].(int64)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetCounterValue indicates an expected call of GetCounterValue.
-func (mr *MockRepositoryMockRecorder) GetCounterValue(arg0, arg1 interface{}) *gomock.Call {
+func (mr *MockRepositoryMockRecorder) GetCounterValue(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCounterValue", reflect.TypeOf((*MockRepository)(nil).GetCounterValue), arg0, arg1)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCounterValue", reflect.TypeOf((*MockRepository)(nil).GetCounterValue), arg0, arg1, arg2)
 }
 
 // GetGaugeValue mocks base method.
-func (m *MockRepository) GetGaugeValue(arg0 context.Context, arg1 string) (float64, error) {
+func (m *MockRepository) GetGaugeValue(arg0 context.Context, arg1 string, arg2 map[string]string) (float64, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetGaugeValue", arg0, arg1)
+	ret := m.ctrl.Call(m, "GetGaugeValue", arg0, arg1, arg2)
 	ret0, _ := ret[0].(float64)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetGaugeValue indicates an expected call of GetGaugeValue.
-func (mr *MockRepositoryMockRecorder) GetGaugeValue(arg0, arg1 interface{}) *gomock.Call {
+func (mr *MockRepositoryMockRecorder) GetGaugeValue(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetGaugeValue", reflect.TypeOf((*MockRepository)(nil).GetGaugeValue), arg0, arg1)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetGaugeValue", reflect.TypeOf((*MockRepository)(nil).GetGaugeValue), arg0, arg1, arg2)
+}
+
+// History mocks base method.
+func (m *MockRepository) History(arg0 context.Context, arg1, arg2 string, arg3 map[string]string, arg4, arg5 time.Time) ([]model.Sample, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "History", arg0, arg1, arg2, arg3, arg4, arg5)
+	ret0, _ := ret[0].([]model.Sample)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// History indicates an expected call of History.
+func (mr *MockRepositoryMockRecorder) History(arg0, arg1, arg2, arg3, arg4, arg5 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "History", reflect.TypeOf((*MockRepository)(nil).History), arg0, arg1, arg2, arg3, arg4, arg5)
+}
+
+// ListMetrics mocks base method.
+func (m *MockRepository) ListMetrics(arg0 context.Context) ([]model.Metrics, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListMetrics", arg0)
+	ret0, _ := ret[0].([]model.Metrics)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListMetrics indicates an expected call of ListMetrics.
+func (mr *MockRepositoryMockRecorder) ListMetrics(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListMetrics", reflect.TypeOf((*MockRepository)(nil).ListMetrics), arg0)
 }
 
 // Ping mocks base method.
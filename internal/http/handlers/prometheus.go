@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/vorotislav/alert-service/internal/model"
+
+	"go.uber.org/zap"
+)
+
+const (
+	prometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+// labelValueEscaper экранирует значение метки так, как требует формат Prometheus: только '\', '"' и перевод строки.
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// Metrics функция-обработчик для /metrics. Возвращает все метрики в текстовом формате Prometheus.
+func (h *Handler) Metrics(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), queryRepoTimeout)
+	defer cancel()
+
+	metrics, err := h.repo.ListMetrics(ctx)
+	if err != nil {
+		h.logInfo(fmt.Sprintf("Failed to get all metrics: %s", err.Error()),
+			http.StatusInternalServerError, 0)
+
+		http.Error(w, fmt.Sprintf("failed to get all metrics: %s", err.Error()), http.StatusInternalServerError)
+
+		return
+	}
+
+	resp := h.renderPrometheus(metrics)
+
+	w.Header().Set("Content-Type", prometheusContentType)
+	w.WriteHeader(http.StatusOK)
+
+	size, err := w.Write(resp)
+	if err != nil {
+		h.logInfo(fmt.Sprintf("Failed write metrics: %s", err.Error()),
+			http.StatusInternalServerError, 0)
+	}
+
+	h.logInfo("Get prometheus metrics", http.StatusOK, size)
+}
+
+// exposed серия метрики с приведёнными к формату Prometheus именем и метками.
+type exposed struct {
+	name   string
+	series string
+	m      model.Metrics
+}
+
+// renderPrometheus формирует тело ответа в формате Prometheus text exposition. Серии группируются
+// по приведённому имени метрики, чтобы серии одной метрики шли подряд под общей строкой TYPE, даже если
+// исходные имена различались. Серии, которые после приведения имён совпадают с уже выведенными,
+// и серии с типом, отличным от типа первой серии метрики, пропускаются.
+func (h *Handler) renderPrometheus(metrics []model.Metrics) []byte {
+	var buf bytes.Buffer
+
+	all := make([]exposed, 0, len(metrics))
+
+	for _, m := range metrics {
+		name := SanitizeMetricName(m.ID)
+		if name == "" {
+			continue
+		}
+
+		all = append(all, exposed{name: name, series: name + renderLabels(m.Labels), m: m})
+	}
+
+	sort.SliceStable(all, func(i, j int) bool {
+		if all[i].name != all[j].name {
+			return all[i].name < all[j].name
+		}
+
+		return all[i].series < all[j].series
+	})
+
+	types := make(map[string]string, len(all))
+	seen := make(map[string]struct{}, len(all))
+
+	for _, e := range all {
+		name, series, m := e.name, e.series, e.m
+
+		if _, ok := seen[series]; ok {
+			h.log.Debug("duplicate metric name in exposition",
+				zap.String("id", m.ID),
+				zap.String("name", series))
+
+			continue
+		}
+
+		var value string
+
+		switch {
+		case m.MType == model.MetricCounter && m.Delta != nil:
+			value = strconv.FormatInt(*m.Delta, 10)
+		case m.MType == model.MetricGauge && m.Value != nil:
+			value = formatFloat(*m.Value)
+		default:
+			continue
+		}
+
+		mtype, ok := types[name]
+		if ok && mtype != m.MType {
+			h.log.Debug("metric type mismatch in exposition",
+				zap.String("id", m.ID),
+				zap.String("type", m.MType))
+
+			continue
+		}
+
+		seen[series] = struct{}{}
+
+		if !ok {
+			types[name] = m.MType
+
+			fmt.Fprintf(&buf, "# TYPE %s %s\n", name, m.MType)
+		}
+
+		fmt.Fprintf(&buf, "%s %s\n", series, value)
+	}
+
+	return buf.Bytes()
+}
+
+// renderLabels возвращает метки в виде {a="1",b="2"}, отсортированные по имени, или пустую строку.
+func renderLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		pairs = append(pairs, SanitizeMetricName(name)+`="`+labelValueEscaper.Replace(labels[name])+`"`)
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// SanitizeMetricName приводит имя метрики к виду [a-zA-Z_:][a-zA-Z0-9_:]*, заменяя недопустимые символы на '_'.
+func SanitizeMetricName(name string) string {
+	if name == "" {
+		return ""
+	}
+
+	var sb strings.Builder
+
+	for i, c := range name {
+		isLetter := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '_' || c == ':'
+		isDigit := c >= '0' && c <= '9'
+
+		switch {
+		case isDigit && i == 0:
+			sb.WriteByte('_')
+			sb.WriteRune(c)
+		case isLetter || isDigit:
+			sb.WriteRune(c)
+		default:
+			sb.WriteByte('_')
+		}
+	}
+
+	return sb.String()
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
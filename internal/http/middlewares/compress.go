@@ -28,10 +28,9 @@ func (c *compressWriter) Write(p []byte) (int, error) {
 	return c.zw.Write(p) //nolint:wrapcheck
 }
 
+// WriteHeader помечает ответ как сжатый при любом статусе: тело ошибки тоже проходит через gzip.Writer.
 func (c *compressWriter) WriteHeader(statusCode int) {
-	if statusCode < http.StatusMultipleChoices {
-		c.w.Header().Set("Content-Encoding", "gzip")
-	}
+	c.w.Header().Set("Content-Encoding", "gzip")
 
 	c.w.WriteHeader(statusCode)
 }
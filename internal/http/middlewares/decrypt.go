@@ -2,8 +2,6 @@ package middlewares
 
 import (
 	"bytes"
-	"crypto/rand"
-	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
 	"fmt"
@@ -11,6 +9,8 @@ import (
 	"net/http"
 	"os"
 
+	"github.com/vorotislav/alert-service/internal/encrypt"
+
 	"go.uber.org/zap"
 )
 
@@ -56,7 +56,7 @@ func DecryptMiddleware(log *zap.Logger, privateKeyPath string) func(h http.Handl
 				log.Error("http body close", zap.Error(err))
 			}
 
-			decrypted, err := rsa.DecryptPKCS1v15(rand.Reader, privateKey, body)
+			decrypted, err := encrypt.Decrypt(privateKey, body)
 			if err != nil {
 				log.Debug("decrypted body", zap.Error(err))
 
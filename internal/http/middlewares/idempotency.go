@@ -0,0 +1,21 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"github.com/vorotislav/alert-service/internal/idempotency"
+)
+
+// RequestID кладёт ключ запроса из заголовка X-Request-ID в контекст, чтобы хранилище могло
+// распознать повторно отправленное обновление.
+func RequestID(h http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		if key := r.Header.Get(idempotency.Header); key != "" {
+			r = r.WithContext(idempotency.WithKey(r.Context(), key))
+		}
+
+		h.ServeHTTP(w, r)
+	}
+
+	return http.HandlerFunc(fn)
+}
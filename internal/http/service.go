@@ -35,22 +35,28 @@ func NewService(
 	log *zap.Logger,
 	set *server.Settings,
 	repo repository.Repository,
+	alerter handlers.Alerter,
+	registry handlers.AgentRegistry,
 ) (*Service, error) {
 	r := chi.NewRouter()
 
 	r.Use(middlewares.New(log))
 
-	if set.HashKey != "" {
-		r.Use(middlewares.Hash(log, set.HashKey))
-	}
-
+	// Агент подписывает исходный json, затем сжимает и шифрует его,
+	// поэтому тело сначала расшифровывается, потом распаковывается и только затем проверяется подпись.
 	if set.CryptoKey != "" {
 		r.Use(middlewares.DecryptMiddleware(log, set.CryptoKey))
 	}
 
 	r.Use(middlewares.CompressMiddleware)
 
-	handler := handlers.NewHandler(log, repo)
+	if set.HashKey != "" {
+		r.Use(middlewares.Hash(log, set.HashKey))
+	}
+
+	r.Use(middlewares.RequestID)
+
+	handler := handlers.NewHandler(log, repo, alerter, registry)
 
 	r.Route("/updates", func(r chi.Router) {
 		r.Post("/", handler.Updates)
@@ -73,10 +79,17 @@ func NewService(
 		r.Post("/", handler.ValueJSON)
 	})
 
+	r.Route("/history", func(r chi.Router) {
+		r.Get("/{metricType}/{metricName}", handler.History)
+	})
+
 	r.Route("/ping", func(r chi.Router) {
 		r.Get("/", handler.Ping)
 	})
 
+	r.Get("/alerts", handler.Alerts)
+	r.Get("/agents", handler.Agents)
+	r.Get("/metrics", handler.Metrics)
 	r.Get("/", handler.AllValue)
 	r.HandleFunc("/debug/pprof/heap", pprof.Index)
 
@@ -0,0 +1,197 @@
+// Пакет idempotency позволяет не применять повторно обновления метрик, которые агент отправил ещё раз
+// после таймаута или ошибки. Агент передаёт ключ запроса в заголовке, сервер кладёт его в контекст,
+// а хранилище запоминает результаты уже применённых запросов.
+//
+// Хранилище в памяти держит ключи в Cache, и они не переживают перезапуск сервера: повтор запроса,
+// пришедший после перезапуска, будет применён ещё раз. PostgreSQL хранит ключи в таблице idempotency_keys,
+// и для него это ограничение не действует.
+package idempotency
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/vorotislav/alert-service/internal/model"
+)
+
+// Header заголовок, в котором агент передаёт ключ запроса.
+const Header = "X-Request-ID"
+
+// Виды обновлений. Ключ запроса действует только внутри своего вида: результат обновления одной метрики
+// и пакета хранятся по-разному, и ключ, пришедший и на /update, и на /updates, не должен подменять
+// результат другого вида.
+const (
+	KindMetric = "metric"
+	KindBatch  = "batch"
+)
+
+// ErrNoResult у применённого запроса нет сохранённого результата нужного вида.
+var ErrNoResult = errors.New("applied request has no result")
+
+// Параметры хранения ключей по умолчанию.
+const (
+	DefaultTTL      = 10 * time.Minute
+	DefaultCapacity = 100000
+
+	keyLength = 16
+)
+
+type ctxKey struct{}
+
+// WithKey возвращает контекст с ключом запроса.
+func WithKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, key)
+}
+
+// KeyFromContext возвращает ключ запроса из контекста или пустую строку, если его нет.
+func KeyFromContext(ctx context.Context) string {
+	key, _ := ctx.Value(ctxKey{}).(string)
+
+	return key
+}
+
+// Scoped возвращает ключ запроса key, ограниченный видом обновления kind.
+func Scoped(kind, key string) string {
+	return kind + ":" + key
+}
+
+// Derive возвращает ключ запроса, производный от ключа пакета key и частей parts. Те же части дают тот же ключ,
+// поэтому запрос с тем же содержимым при повторной отправке пакета получает прежний ключ.
+func Derive(key string, parts ...string) string {
+	h := sha256.New()
+	h.Write([]byte(key))
+
+	for _, p := range parts {
+		h.Write([]byte{0})
+		h.Write([]byte(p))
+	}
+
+	return hex.EncodeToString(h.Sum(nil)[:keyLength])
+}
+
+// NewKey генерирует случайный ключ запроса.
+func NewKey() string {
+	b := make([]byte, keyLength)
+	_, _ = rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
+
+type entry struct {
+	done    chan struct{}
+	result  []model.Metrics
+	err     error
+	created time.Time
+}
+
+// Cache запоминает результаты недавно применённых запросов в памяти.
+// Ключи хранятся не дольше ttl, а их количество ограничено capacity.
+type Cache struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	capacity int
+	now      func() time.Time
+	entries  map[string]*entry
+	order    []string
+}
+
+// NewCache конструктор для Cache.
+func NewCache(ttl time.Duration, capacity int) *Cache {
+	return &Cache{
+		ttl:      ttl,
+		capacity: capacity,
+		now:      time.Now,
+		entries:  make(map[string]*entry),
+		order:    make([]string, 0),
+	}
+}
+
+// Do выполняет apply не более одного раза для каждого ключа. Если запрос с таким ключом уже применён,
+// возвращает сохранённый результат и applied=false. Одновременные запросы с одним ключом ждут первый.
+// Неуспешный результат не запоминается, и следующий запрос с тем же ключом выполнит apply снова.
+func (c *Cache) Do(key string, apply func() ([]model.Metrics, error)) ([]model.Metrics, bool, error) {
+	for {
+		c.mu.Lock()
+
+		e, ok := c.entries[key]
+		if !ok {
+			e = &entry{done: make(chan struct{}), created: c.now()}
+			c.entries[key] = e
+			c.mu.Unlock()
+
+			break
+		}
+
+		c.mu.Unlock()
+
+		<-e.done
+
+		if e.err == nil {
+			return cloneAll(e.result), false, nil
+		}
+	}
+
+	result, err := apply()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e := c.entries[key]
+	e.result = cloneAll(result)
+	e.err = err
+
+	if err != nil {
+		delete(c.entries, key)
+	} else {
+		c.order = append(c.order, key)
+		c.evict()
+	}
+
+	close(e.done)
+
+	return result, true, err
+}
+
+// evict удаляет устаревшие ключи и ключи сверх capacity. Вызывается под блокировкой.
+func (c *Cache) evict() {
+	now := c.now()
+	n := 0
+
+	for n < len(c.order) {
+		e, ok := c.entries[c.order[n]]
+		if ok && len(c.order)-n <= c.capacity && now.Sub(e.created) < c.ttl {
+			break
+		}
+
+		delete(c.entries, c.order[n])
+		n++
+	}
+
+	c.order = c.order[n:]
+}
+
+// Len возвращает количество запомненных ключей.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.order)
+}
+
+func cloneAll(metrics []model.Metrics) []model.Metrics {
+	if metrics == nil {
+		return nil
+	}
+
+	res := make([]model.Metrics, len(metrics))
+	for i, m := range metrics {
+		res[i] = m.Clone()
+	}
+
+	return res
+}
@@ -0,0 +1,127 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/vorotislav/alert-service/internal/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyFromContext(t *testing.T) {
+	t.Parallel()
+
+	assert.Empty(t, KeyFromContext(context.Background()))
+	assert.Equal(t, "abc", KeyFromContext(WithKey(context.Background(), "abc")))
+	assert.NotEqual(t, NewKey(), NewKey())
+	assert.Equal(t, Derive("k", "a", "b"), Derive("k", "a", "b"))
+	assert.NotEqual(t, Derive("k", "a", "b"), Derive("k", "ab"))
+	assert.NotEqual(t, Derive("k", "a"), Derive("k2", "a"))
+}
+
+func TestCache_Do(t *testing.T) {
+	t.Parallel()
+
+	c := NewCache(time.Minute, 10)
+
+	var calls atomic.Int32
+
+	delta := int64(5)
+	apply := func() ([]model.Metrics, error) {
+		calls.Add(1)
+
+		return []model.Metrics{{ID: "PollCount", MType: model.MetricCounter, Delta: &delta}}, nil
+	}
+
+	res, applied, err := c.Do("key", apply)
+	require.NoError(t, err)
+	assert.True(t, applied)
+	assert.Equal(t, int64(5), *res[0].Delta)
+
+	delta = 100
+
+	res, applied, err = c.Do("key", apply)
+	require.NoError(t, err)
+	assert.False(t, applied)
+	assert.Equal(t, int64(5), *res[0].Delta)
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestCache_DoError(t *testing.T) {
+	t.Parallel()
+
+	c := NewCache(time.Minute, 10)
+
+	_, _, err := c.Do("key", func() ([]model.Metrics, error) {
+		return nil, errors.New("some error")
+	})
+	require.Error(t, err)
+
+	_, applied, err := c.Do("key", func() ([]model.Metrics, error) {
+		return nil, nil
+	})
+	require.NoError(t, err)
+	assert.True(t, applied)
+}
+
+func TestCache_DoConcurrent(t *testing.T) {
+	t.Parallel()
+
+	c := NewCache(time.Minute, 10)
+
+	var (
+		calls atomic.Int32
+		wg    sync.WaitGroup
+	)
+
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			_, _, err := c.Do("key", func() ([]model.Metrics, error) {
+				calls.Add(1)
+				time.Sleep(time.Millisecond)
+
+				return nil, nil
+			})
+			assert.NoError(t, err)
+		}()
+	}
+
+	wg.Wait()
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestCache_Evict(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	c := NewCache(time.Minute, 2)
+	c.now = func() time.Time { return now }
+
+	noop := func() ([]model.Metrics, error) { return nil, nil }
+
+	for _, key := range []string{"a", "b", "c"} {
+		_, _, err := c.Do(key, noop)
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, 2, c.Len())
+
+	_, applied, _ := c.Do("a", noop)
+	assert.True(t, applied)
+
+	now = now.Add(2 * time.Minute)
+
+	_, applied, _ = c.Do("d", noop)
+	assert.True(t, applied)
+	assert.Equal(t, 1, c.Len())
+}
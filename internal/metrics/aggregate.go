@@ -0,0 +1,194 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/vorotislav/alert-service/internal/collector"
+	"github.com/vorotislav/alert-service/internal/model"
+	"github.com/vorotislav/alert-service/internal/settings/agent"
+)
+
+// Агрегаты gauge за интервал отправки.
+const (
+	AggregateLast = "last"
+	AggregateMin  = "min"
+	AggregateMax  = "max"
+	AggregateMean = "mean"
+)
+
+const percent = 100
+
+// ErrInvalidAggregate возвращается для правила агрегации с неизвестным агрегатом или неверным выражением.
+var ErrInvalidAggregate = errors.New("invalid aggregation rule")
+
+type aggregateFunc struct {
+	suffix string
+	calc   func(sorted []float64, mean float64) float64
+}
+
+type aggregationRule struct {
+	re   *regexp.Regexp
+	last bool
+	aggs []aggregateFunc
+}
+
+// aggregation копит значения gauge между отправками, чтобы отправить не только последнее значение,
+// но и минимум, максимум, среднее и перцентили за интервал. Метрики, не попавшие ни под одно правило,
+// отправляются как раньше - последним значением.
+type aggregation struct {
+	rules []aggregationRule
+	// matched правило для метрики, найденное при первом её появлении (nil - правила нет).
+	matched map[string]*aggregationRule
+	// windows значения за интервал по ключу серии.
+	windows map[string][]float64
+}
+
+func newAggregation(rules []agent.AggregationRule) (*aggregation, error) {
+	a := &aggregation{
+		rules:   make([]aggregationRule, 0, len(rules)),
+		matched: make(map[string]*aggregationRule),
+		windows: make(map[string][]float64),
+	}
+
+	for i, r := range rules {
+		rule, err := parseAggregationRule(r)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i, err)
+		}
+
+		a.rules = append(a.rules, rule)
+	}
+
+	return a, nil
+}
+
+func parseAggregationRule(r agent.AggregationRule) (aggregationRule, error) {
+	re, err := regexp.Compile(r.Match)
+	if err != nil {
+		return aggregationRule{}, fmt.Errorf("%w: %w", ErrInvalidAggregate, err)
+	}
+
+	rule := aggregationRule{re: re}
+
+	for _, name := range r.Aggregates {
+		switch {
+		case name == AggregateLast:
+			rule.last = true
+		case name == AggregateMin:
+			rule.aggs = append(rule.aggs, aggregateFunc{suffix: "_" + name, calc: func(s []float64, _ float64) float64 {
+				return s[0]
+			}})
+		case name == AggregateMax:
+			rule.aggs = append(rule.aggs, aggregateFunc{suffix: "_" + name, calc: func(s []float64, _ float64) float64 {
+				return s[len(s)-1]
+			}})
+		case name == AggregateMean:
+			rule.aggs = append(rule.aggs, aggregateFunc{suffix: "_" + name, calc: func(_ []float64, mean float64) float64 {
+				return mean
+			}})
+		case strings.HasPrefix(name, "p"):
+			p, err := strconv.ParseFloat(name[1:], 64)
+			if err != nil || p <= 0 || p > percent {
+				return aggregationRule{}, fmt.Errorf("%w: unknown aggregate %q", ErrInvalidAggregate, name)
+			}
+
+			rule.aggs = append(rule.aggs, aggregateFunc{
+				suffix: collector.PercentileSuffix(p),
+				calc: func(s []float64, _ float64) float64 {
+					return collector.Percentile(s, p)
+				},
+			})
+		default:
+			return aggregationRule{}, fmt.Errorf("%w: unknown aggregate %q", ErrInvalidAggregate, name)
+		}
+	}
+
+	if !rule.last && len(rule.aggs) == 0 {
+		return aggregationRule{}, fmt.Errorf("%w: %s: no aggregates", ErrInvalidAggregate, r.Match)
+	}
+
+	return rule, nil
+}
+
+func (a *aggregation) rule(id string) *aggregationRule {
+	if r, ok := a.matched[id]; ok {
+		return r
+	}
+
+	var found *aggregationRule
+
+	for i := range a.rules {
+		if a.rules[i].re.MatchString(id) {
+			found = &a.rules[i]
+
+			break
+		}
+	}
+
+	a.matched[id] = found
+
+	return found
+}
+
+// observe запоминает значение gauge, если для метрики нужны агрегаты.
+func (a *aggregation) observe(m model.Metrics) {
+	if m.Value == nil {
+		return
+	}
+
+	if r := a.rule(m.ID); r != nil && len(r.aggs) > 0 {
+		key := m.SeriesKey()
+		a.windows[key] = append(a.windows[key], *m.Value)
+	}
+}
+
+// apply заменяет метрики gauge агрегатами по правилам и начинает новый интервал.
+func (a *aggregation) apply(metrics []model.Metrics) []model.Metrics {
+	if len(a.rules) == 0 {
+		return metrics
+	}
+
+	res := make([]model.Metrics, 0, len(metrics))
+
+	for _, m := range metrics {
+		r := a.rule(m.ID)
+		if m.MType != model.MetricGauge || r == nil {
+			res = append(res, m)
+
+			continue
+		}
+
+		if r.last {
+			res = append(res, m)
+		}
+
+		values := a.windows[m.SeriesKey()]
+		if len(values) == 0 {
+			continue
+		}
+
+		sort.Float64s(values)
+
+		sum := 0.0
+		for _, v := range values {
+			sum += v
+		}
+
+		mean := sum / float64(len(values))
+
+		for _, agg := range r.aggs {
+			g := collector.Gauge(m.ID+agg.suffix, agg.calc(values, mean))
+			g.Labels = m.Labels
+			res = append(res, g)
+		}
+	}
+
+	a.windows = make(map[string][]float64, len(a.windows))
+
+	return res
+}
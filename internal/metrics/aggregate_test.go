@@ -0,0 +1,83 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/vorotislav/alert-service/internal/collector"
+	"github.com/vorotislav/alert-service/internal/model"
+	"github.com/vorotislav/alert-service/internal/settings/agent"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAggregation_Apply(t *testing.T) {
+	t.Parallel()
+
+	a, err := newAggregation([]agent.AggregationRule{
+		{Match: "^CPUutilization", Aggregates: []string{"last", "min", "max", "mean", "p90"}},
+		{Match: "^Free", Aggregates: []string{"min"}},
+	})
+	require.NoError(t, err)
+
+	for _, v := range []float64{10, 90, 20, 30, 50} {
+		a.observe(collector.Gauge("CPUutilizationTotal", v))
+		a.observe(collector.Gauge("FreeMemory", v*100))
+		a.observe(collector.Gauge("HeapAlloc", v))
+	}
+
+	got := a.apply([]model.Metrics{
+		collector.Gauge("CPUutilizationTotal", 50),
+		collector.Gauge("FreeMemory", 5000),
+		collector.Gauge("HeapAlloc", 50),
+		collector.Counter("PollCount", 5),
+	})
+
+	values := make(map[string]float64, len(got))
+
+	for _, m := range got {
+		if m.Value != nil {
+			values[m.ID] = *m.Value
+		}
+	}
+
+	assert.Equal(t, map[string]float64{
+		"CPUutilizationTotal":      50,
+		"CPUutilizationTotal_min":  10,
+		"CPUutilizationTotal_max":  90,
+		"CPUutilizationTotal_mean": 40,
+		"CPUutilizationTotal_p90":  90,
+		"FreeMemory_min":           1000,
+		"HeapAlloc":                50,
+	}, values)
+	assert.Len(t, got, 8)
+
+	// Окно начинается заново: без новых значений агрегаты не отправляются.
+	got = a.apply([]model.Metrics{collector.Gauge("CPUutilizationTotal", 50)})
+	assert.Len(t, got, 1)
+}
+
+func TestNewAggregation(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		rule agent.AggregationRule
+	}{
+		{name: "bad regexp", rule: agent.AggregationRule{Match: "(", Aggregates: []string{"max"}}},
+		{name: "unknown aggregate", rule: agent.AggregationRule{Match: ".", Aggregates: []string{"median"}}},
+		{name: "bad percentile", rule: agent.AggregationRule{Match: ".", Aggregates: []string{"p200"}}},
+		{name: "no aggregates", rule: agent.AggregationRule{Match: "."}},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := newAggregation([]agent.AggregationRule{tc.rule})
+			require.ErrorIs(t, err, ErrInvalidAggregate)
+		})
+	}
+}
@@ -3,18 +3,16 @@ package metrics
 
 import (
 	"context"
-	"fmt"
+	"errors"
 	"math/rand"
-	"runtime"
 	"time"
 
+	"github.com/vorotislav/alert-service/internal/collector"
+	"github.com/vorotislav/alert-service/internal/idempotency"
 	"github.com/vorotislav/alert-service/internal/model"
 	"github.com/vorotislav/alert-service/internal/settings/agent"
 
-	"github.com/shirou/gopsutil/v3/cpu"
-	"github.com/shirou/gopsutil/v3/mem"
 	"go.uber.org/zap"
-	"golang.org/x/sync/errgroup"
 )
 
 // Доступные типы метрик.
@@ -25,45 +23,28 @@ const (
 	MetricTypeGauge = "gauge"
 )
 
-// Собираемые метрики.
+// Метрики самого агента. Остальные метрики собирают коллекторы.
 const (
-	MetricAlloc           = "Alloc"
-	MetricBuckHashSys     = "BuckHashSys"
-	MetricFrees           = "Frees"
-	MetricGCSys           = "GCSys"
-	MetricHeapAlloc       = "HeapAlloc"
-	MetricHeapIdle        = "HeapIdle"
-	MetricHeapInuse       = "HeapInuse"
-	MetricHeapObjects     = "HeapObjects"
-	MetricHeapReleased    = "HeapReleased"
-	MetricHeapSys         = "HeapSys"
-	MetricLastGC          = "LastGC"
-	MetricLookups         = "Lookups"
-	MetricMCacheInuse     = "MCacheInuse"
-	MetricMCacheSys       = "MCacheSys"
-	MetricMSpanInuse      = "MSpanInuse"
-	MetricMSpanSys        = "MSpanSys"
-	MetricMallocs         = "Mallocs"
-	MetricNextGC          = "NextGC"
-	MetricNumForcedGC     = "NumForcedGC"
-	MetricNumGC           = "NumGC"
-	MetricOtherSys        = "OtherSys"
-	MetricPauseTotalNs    = "PauseTotalNs"
-	MetricStackInuse      = "StackInuse"
-	MetricStackSys        = "StackSys"
-	MetricSys             = "Sys"
-	MetricTotalAlloc      = "TotalAlloc"
-	MetricPollCount       = "PollCount"
-	MetricGCCPUFraction   = "GCCPUFraction"
-	MetricRandomValue     = "RandomValue"
-	MetricTotalMemory     = "TotalMemory"
-	MetricFreeMemory      = "FreeMemory"
-	MetricCPUutilization1 = "CPUutilization1"
+	MetricPollCount   = "PollCount"
+	MetricRandomValue = "RandomValue"
 )
 
-// Client представляет интерфейс для отправки метрик на сервер.
+const (
+	defaultCollectTimeout = time.Second
+)
+
+// Client представляет интерфейс для отправки метрик на сервер. key - ключ запроса пакета:
+// пакет, повторно отправленный с тем же ключом, сервер не применяет дважды.
 type Client interface {
-	SendMetrics(metrics map[string]*model.Metrics) error
+	SendMetrics(key string, metrics map[string]*model.Metrics) error
+}
+
+// Spool представляет интерфейс очереди на диске для метрик, которые не удалось отправить.
+// Пакет хранится вместе с ключом запроса и при повторной отправке передаётся в send с тем же ключом.
+type Spool interface {
+	Push(key string, metrics []model.Metrics) error
+	Replay(send func(key string, metrics []model.Metrics) error) error
+	Len() int
 }
 
 // Worker основная часть пакета. Содержит в себе логгер, настройки, клиент для отправки метрик, а так же хранит последние метрики.
@@ -71,30 +52,99 @@ type Worker struct {
 	log    *zap.Logger
 	set    *agent.Settings
 	client Client
+	spool  Spool
 	cancel context.CancelFunc
 
+	collectors []*runner
+	results    chan collected
+	// gen номер текущего опроса коллекторов.
+	gen uint64
+	// collectTimeout сколько опрос ждёт коллекторы.
+	collectTimeout time.Duration
+
 	pollCount int
-	metrics   map[string]*model.Metrics
+	// metrics текущие значения по ключу серии (model.Metrics.SeriesKey).
+	metrics map[string]*model.Metrics
+	// labels метки агента, которые добавляются ко всем метрикам.
+	labels map[string]string
+	agg    *aggregation
 }
 
-// NewWorker конструктор для Worker.
-func NewWorker(log *zap.Logger, set *agent.Settings, client Client) *Worker {
+// NewWorker конструктор для Worker. Spool может быть nil, тогда неотправленные метрики теряются.
+func NewWorker(
+	log *zap.Logger,
+	set *agent.Settings,
+	client Client,
+	spool Spool,
+	collectors []collector.Collector,
+) *Worker {
 	w := &Worker{
-		log:    log.With(zap.String("package", "metrics worker")),
-		set:    set,
-		client: client,
+		log:        log.With(zap.String("package", "metrics worker")),
+		set:        set,
+		client:     client,
+		spool:      spool,
+		collectors: make([]*runner, 0, len(collectors)),
+		results:    make(chan collected, len(collectors)),
+		metrics:    make(map[string]*model.Metrics),
+		labels:     agentLabels(set),
 	}
 
-	w.initMetrics()
+	w.collectTimeout = time.Duration(set.PollInterval) * time.Second
+	if w.collectTimeout <= 0 {
+		w.collectTimeout = defaultCollectTimeout
+	}
+
+	for _, c := range collectors {
+		w.collectors = append(w.collectors, &runner{c: c})
+	}
+
+	agg, err := newAggregation(set.Aggregation)
+	if err != nil {
+		w.log.Error("aggregation rules are ignored", zap.Error(err))
+
+		agg, _ = newAggregation(nil)
+	}
+
+	w.agg = agg
+
+	for _, m := range []*model.Metrics{
+		getTemplateMetric(MetricPollCount, MetricTypeCounter),
+		getTemplateMetric(MetricRandomValue, MetricTypeGauge),
+	} {
+		m.Labels = w.labels
+		w.metrics[m.SeriesKey()] = m
+	}
 
 	return w
 }
 
+// agentLabels возвращает метки агента: статические метки из настроек и метку host,
+// если она не задана среди статических.
+func agentLabels(set *agent.Settings) map[string]string {
+	if set.Host == "" {
+		return model.MergeLabels(nil, set.Labels)
+	}
+
+	return model.MergeLabels(set.Labels, map[string]string{model.LabelHost: set.Host})
+}
+
 // Start метод начинает осуществлять сбор данных в отдельной горутине.
+// Коллекторы с фоновой работой запускаются здесь же и останавливаются вместе с Worker'ом.
 func (w *Worker) Start(ctx context.Context) {
 	ctx, cancel := context.WithCancel(ctx)
 	w.cancel = cancel
 
+	for _, r := range w.collectors {
+		s, ok := r.c.(collector.Starter)
+		if !ok {
+			continue
+		}
+
+		if err := s.Start(ctx); err != nil {
+			w.log.Error("cannot start collector", zap.String("collector", r.c.Name()), zap.Error(err))
+		}
+	}
+
 	go w.startWorker(ctx)
 }
 
@@ -107,27 +157,15 @@ func (w *Worker) startWorker(ctx context.Context) {
 	pollTicker := time.NewTicker(time.Duration(w.set.PollInterval) * time.Second)
 	reportTicker := time.NewTicker(time.Duration(w.set.ReportInterval) * time.Second)
 
-	eg := &errgroup.Group{}
-
 	for {
 		select {
 		case <-pollTicker.C:
-			w.pollCount++
-			w.readMetrics()
-
-			eg.Go(w.readAddMetrics)
-
-			if err := eg.Wait(); err != nil {
-				w.log.Error("read additional metrics", zap.Error(err))
-			}
+			w.poll(ctx)
 
 			w.log.Debug("polling metrics", zap.Int("iteration", w.pollCount))
 		case <-reportTicker.C:
 			w.log.Debug("report metrics")
-
-			if err := w.client.SendMetrics(w.metrics); err != nil {
-				w.log.Error("error of report metrics", zap.Error(err))
-			}
+			w.report()
 		case <-ctx.Done():
 			w.log.Debug("stop metrics working")
 			pollTicker.Stop()
@@ -138,6 +176,135 @@ func (w *Worker) startWorker(ctx context.Context) {
 	}
 }
 
+// report отправляет метрики на сервер. Сначала отправляются пакеты из очереди на диске, от старых к новым;
+// пока они не отправлены, новые метрики тоже ставятся в очередь, чтобы сервер получил их по порядку.
+//
+// Счётчики отправляются приращениями: после отправки из них вычитается то, что принял сервер или что
+// сохранено в очереди на диске. Если очереди нет, неотправленные приращения остаются и уходят со следующей отправкой.
+// Метрики gauge, для которых настроена агрегация, заменяются агрегатами за прошедший интервал.
+func (w *Worker) report() {
+	w.flush()
+
+	sent := w.agg.apply(w.snapshot())
+
+	if w.spool != nil && w.spool.Len() > 0 {
+		if err := w.spool.Replay(w.sendBatch); err != nil {
+			w.log.Error("error of replay spooled metrics", zap.Error(err))
+			w.store(idempotency.NewKey(), sent)
+			w.ack(sent)
+
+			return
+		}
+	}
+
+	key := idempotency.NewKey()
+
+	err := w.sendBatch(key, sent)
+	if err == nil {
+		w.ack(sent)
+
+		return
+	}
+
+	w.log.Error("error of report metrics", zap.Error(err))
+
+	unsent := sent
+
+	var ue *model.UnsentError
+	if errors.As(err, &ue) {
+		unsent = ue.Metrics
+
+		// Отклонённые сервером метрики повторная отправка не исправит, поэтому они не сохраняются в очередь.
+		if len(ue.Rejected) > 0 {
+			w.log.Error("metrics rejected by server are dropped", zap.Int("metrics", len(ue.Rejected)))
+		}
+	}
+
+	if w.spool != nil {
+		w.store(key, unsent)
+		w.ack(sent)
+
+		return
+	}
+
+	w.ack(delivered(sent, unsent))
+}
+
+// ack вычитает отправленные приращения счётчиков из накопленных. Значения gauge не меняются:
+// последнее значение отправляется и в следующий раз.
+func (w *Worker) ack(sent []model.Metrics) {
+	for _, m := range sent {
+		if m.MType != model.MetricCounter || m.Delta == nil {
+			continue
+		}
+
+		cur, ok := w.metrics[m.SeriesKey()]
+		if !ok || cur.MType != model.MetricCounter || cur.Delta == nil {
+			continue
+		}
+
+		*cur.Delta -= *m.Delta
+	}
+}
+
+// delivered возвращает метрики из sent, которых нет среди unsent.
+func delivered(sent, unsent []model.Metrics) []model.Metrics {
+	failed := make(map[string]struct{}, len(unsent))
+	for _, m := range unsent {
+		failed[m.SeriesKey()] = struct{}{}
+	}
+
+	res := make([]model.Metrics, 0, len(sent))
+
+	for _, m := range sent {
+		if _, ok := failed[m.SeriesKey()]; !ok {
+			res = append(res, m)
+		}
+	}
+
+	return res
+}
+
+// flush забирает агрегаты за интервал отправки у коллекторов, которые их собирают.
+func (w *Worker) flush() {
+	for _, r := range w.collectors {
+		if f, ok := r.c.(collector.Flusher); ok {
+			w.merge(collected{name: r.c.Name(), metrics: f.Flush()})
+		}
+	}
+}
+
+func (w *Worker) sendBatch(key string, metrics []model.Metrics) error {
+	batch := make(map[string]*model.Metrics, len(metrics))
+
+	for i := range metrics {
+		batch[metrics[i].SeriesKey()] = &metrics[i]
+	}
+
+	return w.client.SendMetrics(key, batch) //nolint:wrapcheck
+}
+
+func (w *Worker) store(key string, metrics []model.Metrics) {
+	if w.spool == nil || len(metrics) == 0 {
+		return
+	}
+
+	if err := w.spool.Push(key, metrics); err != nil {
+		w.log.Error("cannot spool metrics", zap.Error(err))
+	}
+}
+
+// snapshot возвращает копии текущих значений метрик.
+func (w *Worker) snapshot() []model.Metrics {
+	metrics := make([]model.Metrics, 0, len(w.metrics))
+
+	for _, m := range w.metrics {
+		metrics = append(metrics, m.Clone())
+	}
+
+	return metrics
+}
+
 func getTemplateMetric(name, metricType string) *model.Metrics {
 	if metricType == MetricTypeGauge {
 		return &model.Metrics{
@@ -154,140 +321,94 @@ func getTemplateMetric(name, metricType string) *model.Metrics {
 	}
 }
 
-func (w *Worker) initMetrics() {
-	w.metrics = make(map[string]*model.Metrics)
-	w.metrics[MetricAlloc] = getTemplateMetric(MetricAlloc, MetricTypeGauge)
-	w.metrics[MetricBuckHashSys] = getTemplateMetric(MetricBuckHashSys, MetricTypeGauge)
-	w.metrics[MetricFrees] = getTemplateMetric(MetricFrees, MetricTypeGauge)
-	w.metrics[MetricGCSys] = getTemplateMetric(MetricGCSys, MetricTypeGauge)
-	w.metrics[MetricHeapAlloc] = getTemplateMetric(MetricHeapAlloc, MetricTypeGauge)
-	w.metrics[MetricHeapIdle] = getTemplateMetric(MetricHeapIdle, MetricTypeGauge)
-	w.metrics[MetricHeapInuse] = getTemplateMetric(MetricHeapInuse, MetricTypeGauge)
-	w.metrics[MetricHeapObjects] = getTemplateMetric(MetricHeapObjects, MetricTypeGauge)
-	w.metrics[MetricHeapReleased] = getTemplateMetric(MetricHeapReleased, MetricTypeGauge)
-	w.metrics[MetricHeapSys] = getTemplateMetric(MetricHeapSys, MetricTypeGauge)
-	w.metrics[MetricLastGC] = getTemplateMetric(MetricLastGC, MetricTypeGauge)
-	w.metrics[MetricLookups] = getTemplateMetric(MetricLookups, MetricTypeGauge)
-	w.metrics[MetricMCacheInuse] = getTemplateMetric(MetricMCacheInuse, MetricTypeGauge)
-	w.metrics[MetricMCacheSys] = getTemplateMetric(MetricMCacheSys, MetricTypeGauge)
-	w.metrics[MetricMSpanInuse] = getTemplateMetric(MetricMSpanInuse, MetricTypeGauge)
-	w.metrics[MetricMSpanSys] = getTemplateMetric(MetricMSpanSys, MetricTypeGauge)
-	w.metrics[MetricMallocs] = getTemplateMetric(MetricMallocs, MetricTypeGauge)
-	w.metrics[MetricNextGC] = getTemplateMetric(MetricNextGC, MetricTypeGauge)
-	w.metrics[MetricNumForcedGC] = getTemplateMetric(MetricNumForcedGC, MetricTypeGauge)
-	w.metrics[MetricNumGC] = getTemplateMetric(MetricNumGC, MetricTypeGauge)
-	w.metrics[MetricOtherSys] = getTemplateMetric(MetricOtherSys, MetricTypeGauge)
-	w.metrics[MetricPauseTotalNs] = getTemplateMetric(MetricPauseTotalNs, MetricTypeGauge)
-	w.metrics[MetricStackInuse] = getTemplateMetric(MetricStackInuse, MetricTypeGauge)
-	w.metrics[MetricStackSys] = getTemplateMetric(MetricStackSys, MetricTypeGauge)
-	w.metrics[MetricSys] = getTemplateMetric(MetricSys, MetricTypeGauge)
-	w.metrics[MetricTotalAlloc] = getTemplateMetric(MetricTotalAlloc, MetricTypeGauge)
-	w.metrics[MetricPollCount] = getTemplateMetric(MetricPollCount, MetricTypeCounter)
-	w.metrics[MetricGCCPUFraction] = getTemplateMetric(MetricGCCPUFraction, MetricTypeGauge)
-	w.metrics[MetricRandomValue] = getTemplateMetric(MetricRandomValue, MetricTypeGauge)
-	w.metrics[MetricTotalMemory] = getTemplateMetric(MetricTotalMemory, MetricTypeGauge)
-	w.metrics[MetricFreeMemory] = getTemplateMetric(MetricFreeMemory, MetricTypeGauge)
-	w.metrics[MetricCPUutilization1] = getTemplateMetric(MetricCPUutilization1, MetricTypeGauge)
-}
+// poll запрашивает метрики у всех коллекторов параллельно и ждёт их не дольше интервала опроса.
+// Коллектор, который не успел ответить или вернул ошибку, не мешает остальным:
+// его метрики просто не обновляются в этот раз.
+func (w *Worker) poll(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, w.collectTimeout)
+	defer cancel()
 
-func (w *Worker) readAddMetrics() error {
-	vm, err := mem.VirtualMemory()
-	if err != nil {
-		w.log.Error("get virtual memory", zap.Error(err))
+	w.gen++
+	w.pollCount++
+	*w.metrics[model.SeriesKey(MetricPollCount, w.labels)].Delta++
 
-		return fmt.Errorf("virtual memory: %w", err)
-	}
+	random := w.metrics[model.SeriesKey(MetricRandomValue, w.labels)]
+	random.Value = float64Ptr(rand.Float64()) //nolint:gosec
+	w.agg.observe(*random)
 
-	percent, err := cpu.Percent(0, true)
-	if err != nil {
-		w.log.Error("get cpu percent", zap.Error(err))
+	// Результаты, пришедшие после таймаута прошлого опроса.
+	w.drain()
+
+	pending := make(map[*runner]struct{}, len(w.collectors))
 
-		return fmt.Errorf("cpu percent: %w", err)
+	for _, r := range w.collectors {
+		if r.start(ctx, w.gen, w.results) {
+			pending[r] = struct{}{}
+		} else {
+			w.log.Info("collector is still running, skip", zap.String("collector", r.c.Name()))
+		}
 	}
 
-	tm := w.metrics[MetricTotalMemory]
-	*tm.Value = float64(vm.Total)
-	w.metrics[MetricTotalMemory] = tm
+	// Ждём только коллекторы, запущенные в этом опросе. Запоздавший результат прошлого
+	// опроса может прийти в любой момент: он учитывается, но не засчитывается за текущий.
+	for len(pending) > 0 {
+		select {
+		case res := <-w.results:
+			if res.gen == w.gen {
+				delete(pending, res.runner)
+			} else {
+				w.log.Debug("late collector result", zap.String("collector", res.name))
+			}
 
-	fm := w.metrics[MetricFreeMemory]
-	*fm.Value = float64(vm.Free)
-	w.metrics[MetricFreeMemory] = fm
+			w.merge(res)
+		case <-ctx.Done():
+			w.log.Info("collectors timed out", zap.Int("pending", len(pending)))
 
-	cu := w.metrics[MetricCPUutilization1]
-	*cu.Value = percent[0]
-	w.metrics[MetricCPUutilization1] = cu
+			return
+		}
+	}
+}
 
-	return nil
+// drain забирает результаты коллекторов, завершившихся после таймаута, не дожидаясь остальных.
+func (w *Worker) drain() {
+	for {
+		select {
+		case res := <-w.results:
+			w.merge(res)
+		default:
+			return
+		}
+	}
 }
 
-func (w *Worker) readMetrics() { //nolint:funlen,gocyclo,cyclop
-	ms := runtime.MemStats{}
-	runtime.ReadMemStats(&ms)
-
-	for k, v := range w.metrics {
-		k, v := k, v
-		switch k {
-		case MetricAlloc:
-			*v.Value = float64(ms.Alloc)
-		case MetricBuckHashSys:
-			*v.Value = float64(ms.BuckHashSys)
-		case MetricFrees:
-			*v.Value = float64(ms.Frees)
-		case MetricGCSys:
-			*v.Value = float64(ms.GCSys)
-		case MetricHeapAlloc:
-			*v.Value = float64(ms.HeapAlloc)
-		case MetricHeapIdle:
-			*v.Value = float64(ms.HeapIdle)
-		case MetricHeapInuse:
-			*v.Value = float64(ms.HeapInuse)
-		case MetricHeapObjects:
-			*v.Value = float64(ms.HeapObjects)
-		case MetricHeapReleased:
-			*v.Value = float64(ms.HeapReleased)
-		case MetricHeapSys:
-			*v.Value = float64(ms.HeapSys)
-		case MetricLastGC:
-			*v.Value = float64(ms.LastGC)
-		case MetricLookups:
-			*v.Value = float64(ms.Lookups)
-		case MetricMCacheInuse:
-			*v.Value = float64(ms.MCacheInuse)
-		case MetricMCacheSys:
-			*v.Value = float64(ms.MCacheSys)
-		case MetricMSpanInuse:
-			*v.Value = float64(ms.MSpanInuse)
-		case MetricMSpanSys:
-			*v.Value = float64(ms.MSpanSys)
-		case MetricMallocs:
-			*v.Value = float64(ms.Mallocs)
-		case MetricNextGC:
-			*v.Value = float64(ms.NextGC)
-		case MetricNumForcedGC:
-			*v.Value = float64(ms.NumForcedGC)
-		case MetricNumGC:
-			*v.Value = float64(ms.NumGC)
-		case MetricOtherSys:
-			*v.Value = float64(ms.OtherSys)
-		case MetricPauseTotalNs:
-			*v.Value = float64(ms.PauseTotalNs)
-		case MetricStackInuse:
-			*v.Value = float64(ms.StackInuse)
-		case MetricStackSys:
-			*v.Value = float64(ms.StackSys)
-		case MetricSys:
-			*v.Value = float64(ms.Sys)
-		case MetricTotalAlloc:
-			*v.Value = float64(ms.TotalAlloc)
-		case MetricPollCount:
-			*v.Delta = int64(w.pollCount)
-		case MetricGCCPUFraction:
-			*v.Value = ms.GCCPUFraction
-		case MetricRandomValue:
-			*v.Value = rand.Float64() //nolint:gosec
+func (w *Worker) merge(res collected) {
+	if res.err != nil {
+		w.log.Error("collect metrics", zap.String("collector", res.name), zap.Error(res.err))
+	}
+
+	for _, m := range res.metrics {
+		// Копия: приращения счётчиков потом уменьшаются при подтверждении отправки,
+		// а значения не должны зависеть от памяти коллектора. Собственные метки метрики
+		// важнее меток агента.
+		m := m.Clone()
+		m.Labels = model.MergeLabels(m.Labels, w.labels)
+		key := m.SeriesKey()
+
+		cur, ok := w.metrics[key]
+		if ok && cur.MType == model.MetricCounter && m.MType == model.MetricCounter && cur.Delta != nil && m.Delta != nil {
+			*cur.Delta += *m.Delta
+
+			continue
+		}
+
+		if m.MType == model.MetricGauge {
+			w.agg.observe(m)
 		}
 
-		w.metrics[k] = v
+		w.metrics[key] = &m
 	}
-	w.pollCount++
+}
+
+func float64Ptr(v float64) *float64 {
+	return &v
 }
@@ -0,0 +1,280 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/vorotislav/alert-service/internal/collector"
+	"github.com/vorotislav/alert-service/internal/model"
+	"github.com/vorotislav/alert-service/internal/settings/agent"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+var errCollect = errors.New("collect failed")
+
+type fakeCollector struct {
+	name    string
+	metrics []model.Metrics
+	err     error
+	// release если задан, Collect ждёт его закрытия, не обращая внимания на контекст.
+	release chan struct{}
+	// before вызывается в начале каждого Collect с номером вызова.
+	before func(call int)
+	calls  int
+}
+
+func (c *fakeCollector) Name() string {
+	return c.name
+}
+
+func (c *fakeCollector) Collect(_ context.Context) ([]model.Metrics, error) {
+	c.calls++
+	if c.before != nil {
+		c.before(c.calls)
+	}
+
+	if c.release != nil {
+		<-c.release
+	}
+
+	return c.metrics, c.err
+}
+
+func TestWorker_Poll(t *testing.T) {
+	t.Parallel()
+
+	hanging := &fakeCollector{
+		name:    "hanging",
+		metrics: []model.Metrics{collector.Gauge("Late", 1)},
+		release: make(chan struct{}),
+	}
+	ok := &fakeCollector{name: "ok", metrics: []model.Metrics{
+		collector.Gauge("HeapAlloc", 10),
+		collector.Counter("Requests", 2),
+	}}
+
+	w := NewWorker(zap.NewNop(), &agent.Settings{}, nil, nil, []collector.Collector{
+		ok,
+		&fakeCollector{name: "failing", err: errCollect},
+		hanging,
+	})
+	w.collectTimeout = 50 * time.Millisecond
+
+	// Во втором опросе результат зависшего коллектора из первого опроса попадает в канал
+	// раньше результата ok и не должен засчитываться вместо него.
+	ok.before = func(call int) {
+		if call != 2 {
+			return
+		}
+
+		close(hanging.release)
+
+		for w.collectors[2].busy.Load() {
+			runtime.Gosched()
+		}
+	}
+
+	w.poll(context.Background())
+	assert.NotContains(t, w.metrics, "Late")
+
+	w.poll(context.Background())
+
+	require.Contains(t, w.metrics, "HeapAlloc")
+	assert.Equal(t, float64(10), *w.metrics["HeapAlloc"].Value)
+
+	require.Contains(t, w.metrics, "Requests")
+	assert.Equal(t, int64(4), *w.metrics["Requests"].Delta)
+
+	require.Contains(t, w.metrics, "Late")
+	assert.Equal(t, float64(1), *w.metrics["Late"].Value)
+
+	require.Contains(t, w.metrics, MetricPollCount)
+	assert.Equal(t, int64(2), *w.metrics[MetricPollCount].Delta)
+	assert.Contains(t, w.metrics, MetricRandomValue)
+}
+
+// fakeClient запоминает приращения счётчиков, принятые "сервером", и ключи пакетов
+// и отклоняет отправку, пока fail не пуст.
+type fakeClient struct {
+	received map[string]int64
+	keys     []string
+	fail     []error
+}
+
+func (c *fakeClient) SendMetrics(key string, metrics map[string]*model.Metrics) error {
+	c.keys = append(c.keys, key)
+
+	var err error
+	if len(c.fail) > 0 {
+		err, c.fail = c.fail[0], c.fail[1:]
+	}
+
+	var ue *model.UnsentError
+	if err != nil && !errors.As(err, &ue) {
+		return err
+	}
+
+	unsent := make(map[string]struct{})
+	if ue != nil {
+		for _, m := range ue.Metrics {
+			unsent[m.ID] = struct{}{}
+		}
+	}
+
+	for id, m := range metrics {
+		if _, ok := unsent[id]; !ok && m.Delta != nil {
+			c.received[id] += *m.Delta
+		}
+	}
+
+	return err
+}
+
+type fakeSpool struct {
+	keys    []string
+	batches [][]model.Metrics
+}
+
+func (s *fakeSpool) Push(key string, metrics []model.Metrics) error {
+	s.keys = append(s.keys, key)
+	s.batches = append(s.batches, metrics)
+
+	return nil
+}
+
+func (s *fakeSpool) Replay(send func(key string, metrics []model.Metrics) error) error {
+	for len(s.batches) > 0 {
+		if err := send(s.keys[0], s.batches[0]); err != nil {
+			return err
+		}
+
+		s.keys, s.batches = s.keys[1:], s.batches[1:]
+	}
+
+	return nil
+}
+
+func (s *fakeSpool) Len() int {
+	return len(s.batches)
+}
+
+func TestWorker_ReportDeltas(t *testing.T) {
+	t.Parallel()
+
+	requests := collector.Counter("Requests", 3)
+	partial := &model.UnsentError{Metrics: []model.Metrics{requests}, Err: errCollect}
+
+	tests := []struct {
+		name  string
+		spool *fakeSpool
+		fail  []error
+	}{
+		{name: "success"},
+		{name: "failed send", fail: []error{errCollect, errCollect}},
+		{name: "partial send", fail: []error{partial}},
+		{name: "failed send with spool", spool: &fakeSpool{}, fail: []error{errCollect, errCollect}},
+		{name: "partial send with spool", spool: &fakeSpool{}, fail: []error{partial}},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			client := &fakeClient{received: make(map[string]int64), fail: tc.fail}
+
+			var sp Spool
+			if tc.spool != nil {
+				sp = tc.spool
+			}
+
+			w := NewWorker(zap.NewNop(), &agent.Settings{PollInterval: 1}, client, sp, []collector.Collector{
+				&fakeCollector{name: "app", metrics: []model.Metrics{requests}},
+			})
+
+			// Пять опросов и отправок: при любых сбоях сервер в итоге получает ровно столько, сколько собрано.
+			for i := 0; i < 5; i++ {
+				w.poll(context.Background())
+				w.report()
+			}
+
+			assert.Equal(t, int64(5), client.received[MetricPollCount])
+			assert.Equal(t, int64(15), client.received["Requests"])
+			assert.Equal(t, int64(0), *w.metrics[MetricPollCount].Delta)
+			assert.Equal(t, int64(0), *w.metrics["Requests"].Delta)
+		})
+	}
+}
+
+func TestWorker_ReplaySameKey(t *testing.T) {
+	t.Parallel()
+
+	client := &fakeClient{received: make(map[string]int64), fail: []error{errCollect}}
+	sp := &fakeSpool{}
+
+	w := NewWorker(zap.NewNop(), &agent.Settings{PollInterval: 1}, client, sp, nil)
+
+	w.poll(context.Background())
+	w.report()
+	w.report()
+
+	// Пакет, не дошедший в первой отправке, повторяется из очереди с тем же ключом,
+	// а новый пакет получает свой ключ.
+	require.Len(t, client.keys, 3)
+	assert.NotEmpty(t, client.keys[0])
+	assert.Equal(t, client.keys[0], client.keys[1])
+	assert.NotEqual(t, client.keys[0], client.keys[2])
+	assert.Zero(t, sp.Len())
+}
+
+func TestWorker_RejectedNotSpooled(t *testing.T) {
+	t.Parallel()
+
+	requests := collector.Counter("Requests", 3)
+	client := &fakeClient{received: make(map[string]int64), fail: []error{
+		&model.UnsentError{Rejected: []model.Metrics{requests}, Err: errCollect},
+	}}
+	sp := &fakeSpool{}
+
+	w := NewWorker(zap.NewNop(), &agent.Settings{PollInterval: 1}, client, sp, []collector.Collector{
+		&fakeCollector{name: "app", metrics: []model.Metrics{requests}},
+	})
+
+	w.poll(context.Background())
+	w.report()
+
+	assert.Zero(t, sp.Len())
+	assert.Equal(t, int64(0), *w.metrics["Requests"].Delta)
+}
+
+func TestWorker_Labels(t *testing.T) {
+	t.Parallel()
+
+	w := NewWorker(zap.NewNop(), &agent.Settings{
+		PollInterval: 1,
+		Host:         "web-1",
+		Labels:       map[string]string{"dc": "eu"},
+	}, nil, nil, []collector.Collector{
+		&fakeCollector{name: "ok", metrics: []model.Metrics{
+			collector.Gauge("HeapAlloc", 10),
+			{ID: "Requests", MType: model.MetricCounter, Delta: new(int64), Labels: map[string]string{"host": "app"}},
+		}},
+	})
+
+	w.poll(context.Background())
+
+	labels := map[string]string{"dc": "eu", "host": "web-1"}
+
+	require.Contains(t, w.metrics, model.SeriesKey("HeapAlloc", labels))
+	assert.Equal(t, labels, w.metrics[model.SeriesKey("HeapAlloc", labels)].Labels)
+	assert.Contains(t, w.metrics, model.SeriesKey(MetricPollCount, labels))
+	// Собственные метки метрики важнее меток агента.
+	assert.Contains(t, w.metrics, model.SeriesKey("Requests", map[string]string{"dc": "eu", "host": "app"}))
+}
@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/vorotislav/alert-service/internal/collector"
+	"github.com/vorotislav/alert-service/internal/model"
+)
+
+// collected результат одного опроса коллектора. Поколение gen позволяет отличить
+// результат текущего опроса от запоздавшего результата предыдущего.
+type collected struct {
+	runner  *runner
+	gen     uint64
+	name    string
+	metrics []model.Metrics
+	err     error
+}
+
+// runner запускает коллектор в отдельной горутине и не даёт запустить его повторно,
+// пока предыдущий опрос не завершился.
+type runner struct {
+	c    collector.Collector
+	busy atomic.Bool
+}
+
+func (r *runner) start(ctx context.Context, gen uint64, results chan<- collected) bool {
+	if !r.busy.CompareAndSwap(false, true) {
+		return false
+	}
+
+	go func() {
+		defer r.busy.Store(false)
+
+		res := collected{runner: r, gen: gen, name: r.c.Name()}
+
+		defer func() {
+			if p := recover(); p != nil {
+				res.err = fmt.Errorf("collector panic: %v", p) //nolint:goerr113
+			}
+
+			results <- res
+		}()
+
+		res.metrics, res.err = r.c.Collect(ctx)
+	}()
+
+	return true
+}
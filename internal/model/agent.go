@@ -0,0 +1,26 @@
+package model
+
+import "time"
+
+// Заголовки, в которых агент сообщает о себе серверу. Их выставляет клиент агента,
+// а читает реестр агентов на сервере.
+const (
+	HeaderAgentID             = "X-Agent-ID"
+	HeaderAgentHost           = "X-Agent-Host"
+	HeaderAgentVersion        = "X-Agent-Version"
+	HeaderAgentReportInterval = "X-Agent-Report-Interval"
+)
+
+// Agent модель агента, который присылает метрики на сервер.
+// Metrics - сколько метрик принято от агента с запуска сервера.
+// Stale - агент пропустил несколько интервалов отправки подряд.
+type Agent struct {
+	ID             string    `json:"id"`
+	Host           string    `json:"host"`
+	Version        string    `json:"version"`
+	Address        string    `json:"address"`
+	ReportInterval string    `json:"report_interval"`
+	LastSeen       time.Time `json:"last_seen"`
+	Metrics        int64     `json:"metrics"`
+	Stale          bool      `json:"stale"`
+}
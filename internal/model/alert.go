@@ -0,0 +1,33 @@
+package model
+
+import "time"
+
+// Состояния алерта.
+const (
+	// AlertInactive условие правила не выполняется.
+	AlertInactive = "inactive"
+	// AlertPending условие выполняется, но ещё не дольше, чем указано в for.
+	AlertPending = "pending"
+	// AlertFiring условие выполняется дольше, чем указано в for.
+	AlertFiring = "firing"
+	// AlertResolved алерт сработал, а затем условие перестало выполняться.
+	AlertResolved = "resolved"
+)
+
+// Alert модель текущего состояния одного правила алертинга.
+type Alert struct {
+	Rule       string            `json:"rule"`
+	Metric     string            `json:"metric"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	MType      string            `json:"type"` //nolint:tagliatelle
+	Op         string            `json:"op"`
+	Threshold  float64           `json:"threshold"`
+	For        string            `json:"for,omitempty"`
+	State      string            `json:"state"`
+	Value      *float64          `json:"value,omitempty"`
+	ActiveAt   *time.Time        `json:"active_at,omitempty"`
+	FiredAt    *time.Time        `json:"fired_at,omitempty"`
+	ResolvedAt *time.Time        `json:"resolved_at,omitempty"`
+	EvaluateAt *time.Time        `json:"evaluate_at,omitempty"`
+	Error      string            `json:"error,omitempty"`
+}
@@ -0,0 +1,29 @@
+package model
+
+import "time"
+
+// Sample значение метрики в момент её обновления. Для счётчика хранится накопленное значение.
+type Sample struct {
+	Timestamp time.Time `json:"timestamp"`
+	Value     float64   `json:"value"`
+}
+
+// HistoryPoint агрегированные значения метрики за один шаг. Timestamp - начало шага.
+type HistoryPoint struct {
+	Timestamp time.Time `json:"timestamp"`
+	Min       float64   `json:"min"`
+	Max       float64   `json:"max"`
+	Avg       float64   `json:"avg"`
+	Count     int       `json:"count"`
+}
+
+// History ответ на запрос истории метрики.
+type History struct {
+	ID     string            `json:"id"`
+	MType  string            `json:"type"` //nolint:tagliatelle
+	Labels map[string]string `json:"labels,omitempty"`
+	From   time.Time         `json:"from"`
+	To     time.Time         `json:"to"`
+	Step   string            `json:"step"`
+	Points []HistoryPoint    `json:"points"`
+}
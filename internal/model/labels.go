@@ -0,0 +1,130 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// LabelHost метка с именем хоста, на котором работает агент.
+const LabelHost = "host"
+
+// Ошибки меток и выбора серии.
+var (
+	ErrInvalidLabel    = errors.New("invalid label name")
+	ErrSeriesNotFound  = errors.New("series not found")
+	ErrAmbiguousSeries = errors.New("ambiguous series: labels match several series")
+)
+
+var labelNameRe = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// SeriesKey возвращает ключ серии: имя метрики и отсортированные по имени метки в виде
+// name{a="1",b="2"}. Для метрики без меток ключ совпадает с именем.
+func (m Metrics) SeriesKey() string {
+	return SeriesKey(m.ID, m.Labels)
+}
+
+// SeriesKey возвращает ключ серии по имени метрики и меткам.
+func SeriesKey(id string, labels map[string]string) string {
+	if len(labels) == 0 {
+		return id
+	}
+
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	var sb strings.Builder
+
+	sb.WriteString(id)
+	sb.WriteByte('{')
+
+	for i, name := range names {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+
+		sb.WriteString(name)
+		sb.WriteByte('=')
+		sb.WriteString(strconv.Quote(labels[name]))
+	}
+
+	sb.WriteByte('}')
+
+	return sb.String()
+}
+
+// MatchLabels проверяет, что у метрики есть все метки selector с теми же значениями.
+func (m Metrics) MatchLabels(selector map[string]string) bool {
+	for name, value := range selector {
+		if v, ok := m.Labels[name]; !ok || v != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+// SelectSeries выбирает из серий одной метрики ту, что подходит под selector. Если подходят несколько,
+// выбирается серия, метки которой совпадают с selector целиком, иначе возвращается ErrAmbiguousSeries.
+// Так запрос без меток по-прежнему находит метрику, которую присылает один агент, а серия без меток
+// (например, из /update/{type}/{name}/{value}) находится запросом без меток, даже если рядом есть серии с метками.
+func SelectSeries(series []Metrics, selector map[string]string) (Metrics, error) {
+	var found []Metrics
+
+	for _, s := range series {
+		if !s.MatchLabels(selector) {
+			continue
+		}
+
+		if len(s.Labels) == len(selector) {
+			return s, nil
+		}
+
+		found = append(found, s)
+	}
+
+	switch len(found) {
+	case 0:
+		return Metrics{}, ErrSeriesNotFound
+	case 1:
+		return found[0], nil
+	default:
+		return Metrics{}, fmt.Errorf("%w: %d series", ErrAmbiguousSeries, len(found))
+	}
+}
+
+// MergeLabels возвращает метки labels, дополненные метками defaults, которых в labels нет.
+func MergeLabels(labels, defaults map[string]string) map[string]string {
+	if len(defaults) == 0 {
+		return labels
+	}
+
+	res := make(map[string]string, len(labels)+len(defaults))
+
+	for name, value := range defaults {
+		res[name] = value
+	}
+
+	for name, value := range labels {
+		res[name] = value
+	}
+
+	return res
+}
+
+func validateLabels(labels map[string]string) error {
+	for name := range labels {
+		if !labelNameRe.MatchString(name) || strings.HasPrefix(name, "__") {
+			return fmt.Errorf("%w: %q", ErrInvalidLabel, name)
+		}
+	}
+
+	return nil
+}
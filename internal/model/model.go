@@ -1,14 +1,40 @@
 package model
 
-// Metrics модель для одной метрики.
+// Metrics модель для одной метрики. Серия метрики определяется именем и набором меток,
+// поэтому одноимённые метрики разных агентов хранятся отдельно.
 type Metrics struct {
-	ID    string   `json:"id"`
-	MType string   `json:"type"` //nolint:tagliatelle
-	Delta *int64   `json:"delta,omitempty"`
-	Value *float64 `json:"value,omitempty"`
+	ID     string            `json:"id"`
+	MType  string            `json:"type"` //nolint:tagliatelle
+	Delta  *int64            `json:"delta,omitempty"`
+	Value  *float64          `json:"value,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
 }
 
 const (
 	MetricCounter = "counter"
 	MetricGauge   = "gauge"
 )
+
+// Clone возвращает копию метрики, не разделяющую с исходной значения Delta, Value и метки.
+func (m Metrics) Clone() Metrics {
+	c := m
+
+	if m.Delta != nil {
+		d := *m.Delta
+		c.Delta = &d
+	}
+
+	if m.Value != nil {
+		v := *m.Value
+		c.Value = &v
+	}
+
+	if m.Labels != nil {
+		c.Labels = make(map[string]string, len(m.Labels))
+		for name, value := range m.Labels {
+			c.Labels[name] = value
+		}
+	}
+
+	return c
+}
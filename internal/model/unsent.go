@@ -0,0 +1,22 @@
+package model
+
+import (
+	"fmt"
+)
+
+// UnsentError ошибка отправки метрик на сервер. Metrics - копии метрик, которые не удалось доставить
+// из-за сетевой ошибки или ошибки сервера, чтобы их можно было отправить позже. Rejected - метрики,
+// которые сервер отклонил (ответ 4xx): повторная отправка их не исправит.
+type UnsentError struct {
+	Metrics  []Metrics
+	Rejected []Metrics
+	Err      error
+}
+
+func (e *UnsentError) Error() string {
+	return fmt.Sprintf("%d metrics unsent, %d rejected: %s", len(e.Metrics), len(e.Rejected), e.Err)
+}
+
+func (e *UnsentError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,82 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Ошибки проверки метрики.
+var (
+	ErrEmptyID     = errors.New("metrics ID is empty")
+	ErrUnknownType = errors.New("unknown metrics type")
+	ErrNoValue     = errors.New("no metrics value")
+)
+
+// Validate проверяет, что у метрики есть имя, известный тип, значение, соответствующее типу,
+// и допустимые имена меток.
+func (m Metrics) Validate() error {
+	if m.ID == "" {
+		return ErrEmptyID
+	}
+
+	switch m.MType {
+	case MetricCounter:
+		if m.Delta == nil {
+			return ErrNoValue
+		}
+	case MetricGauge:
+		if m.Value == nil {
+			return ErrNoValue
+		}
+	default:
+		return fmt.Errorf("%w: %q", ErrUnknownType, m.MType)
+	}
+
+	return validateLabels(m.Labels)
+}
+
+// RejectedMetric метрика из пакета, которая не прошла проверку. Index - позиция метрики в пакете.
+type RejectedMetric struct {
+	Index  int    `json:"index"`
+	ID     string `json:"id"`
+	MType  string `json:"type"` //nolint:tagliatelle
+	Reason string `json:"reason"`
+}
+
+// BatchError ошибка пакетного обновления со списком отклонённых метрик.
+type BatchError struct {
+	Rejected []RejectedMetric `json:"rejected"`
+}
+
+func (e *BatchError) Error() string {
+	reasons := make([]string, 0, len(e.Rejected))
+	for _, r := range e.Rejected {
+		reasons = append(reasons, fmt.Sprintf("#%d %s: %s", r.Index, r.ID, r.Reason))
+	}
+
+	return fmt.Sprintf("%d metrics rejected: %s", len(e.Rejected), strings.Join(reasons, "; "))
+}
+
+// ValidateBatch проверяет все метрики пакета и возвращает *BatchError со всеми отклонёнными метриками
+// или nil, если пакет корректен.
+func ValidateBatch(metrics []Metrics) error {
+	var rejected []RejectedMetric
+
+	for i, m := range metrics {
+		if err := m.Validate(); err != nil {
+			rejected = append(rejected, RejectedMetric{
+				Index:  i,
+				ID:     m.ID,
+				MType:  m.MType,
+				Reason: err.Error(),
+			})
+		}
+	}
+
+	if len(rejected) > 0 {
+		return &BatchError{Rejected: rejected}
+	}
+
+	return nil
+}
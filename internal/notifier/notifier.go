@@ -0,0 +1,383 @@
+// Пакет notifier доставляет уведомления об изменении состояния алертов на webhook'и.
+// Недоставленные уведомления хранятся в очереди, которая сохраняется на диск,
+// и повторяются с экспоненциальной задержкой.
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/vorotislav/alert-service/internal/model"
+	"github.com/vorotislav/alert-service/internal/settings/server"
+	"github.com/vorotislav/alert-service/internal/utils"
+
+	"go.uber.org/zap"
+)
+
+// Ошибки, возможные при доставке уведомлений.
+var (
+	ErrUnexpectedStatus = errors.New("unexpected webhook status")
+)
+
+// Заголовки запроса с уведомлением.
+const (
+	HeaderHash     = "HashSHA256"
+	HeaderDelivery = "X-Alert-Delivery"
+)
+
+const (
+	defaultMaxAttempts   = 10
+	defaultMinBackoff    = time.Second
+	defaultMaxBackoff    = 5 * time.Minute
+	defaultClientTimeout = 5 * time.Second
+	defaultIdleWait      = time.Minute
+
+	defaultQueueFilePermission = 0o600
+	deliveryIDLength           = 16
+)
+
+// Payload тело уведомления: состояние алерта после изменения, предыдущее состояние и время изменения.
+type Payload struct {
+	model.Alert
+	PreviousState string    `json:"previous_state"`
+	ChangedAt     time.Time `json:"changed_at"`
+}
+
+type delivery struct {
+	ID          string          `json:"id"`
+	URL         string          `json:"url"`
+	Payload     json.RawMessage `json:"payload"`
+	Attempts    int             `json:"attempts"`
+	NextAttempt time.Time       `json:"next_attempt"`
+}
+
+// Notifier сущность для доставки уведомлений. Хранит http-клиент, настройки и очередь доставки.
+type Notifier struct {
+	log         *zap.Logger
+	client      *http.Client
+	urls        []string
+	key         []byte
+	path        string
+	maxAttempts int
+	minBackoff  time.Duration
+	maxBackoff  time.Duration
+	now         func() time.Time
+
+	mu    sync.Mutex
+	queue []delivery
+	wake  chan struct{}
+}
+
+// NewNotifier конструктор для Notifier. Если задан файл очереди, восстанавливает из него недоставленные уведомления.
+func NewNotifier(log *zap.Logger, set *server.NotifySettings) (*Notifier, error) {
+	minBackoff, err := parseDuration(set.MinBackoff, defaultMinBackoff)
+	if err != nil {
+		return nil, fmt.Errorf("min backoff: %w", err)
+	}
+
+	maxBackoff, err := parseDuration(set.MaxBackoff, defaultMaxBackoff)
+	if err != nil {
+		return nil, fmt.Errorf("max backoff: %w", err)
+	}
+
+	maxAttempts := set.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultMaxAttempts
+	}
+
+	n := &Notifier{
+		log:         log.With(zap.String("package", "notifier")),
+		client:      &http.Client{Timeout: defaultClientTimeout},
+		urls:        set.Webhooks,
+		path:        set.QueuePath,
+		maxAttempts: maxAttempts,
+		minBackoff:  minBackoff,
+		maxBackoff:  maxBackoff,
+		now:         time.Now,
+		queue:       make([]delivery, 0),
+		wake:        make(chan struct{}, 1),
+	}
+
+	if set.HashKey != "" {
+		n.key = []byte(set.HashKey)
+	}
+
+	if err := n.load(); err != nil {
+		return nil, fmt.Errorf("load queue: %w", err)
+	}
+
+	return n, nil
+}
+
+func parseDuration(raw string, def time.Duration) (time.Duration, error) {
+	if raw == "" {
+		return def, nil
+	}
+
+	d, err := time.ParseDuration(raw)
+	if err != nil {
+		return 0, fmt.Errorf("parse duration: %w", err)
+	}
+
+	return d, nil
+}
+
+// Notify ставит в очередь уведомление об изменении состояния алерта для каждого webhook'а.
+func (n *Notifier) Notify(prevState string, alert model.Alert) {
+	now := n.now()
+
+	raw, err := json.Marshal(Payload{
+		Alert:         alert,
+		PreviousState: prevState,
+		ChangedAt:     now,
+	})
+	if err != nil {
+		n.log.Error("cannot marshal payload", zap.Error(err))
+
+		return
+	}
+
+	n.mu.Lock()
+
+	for _, u := range n.urls {
+		n.queue = append(n.queue, delivery{
+			ID:          newDeliveryID(),
+			URL:         u,
+			Payload:     raw,
+			NextAttempt: now,
+		})
+	}
+
+	n.persist()
+	n.mu.Unlock()
+
+	select {
+	case n.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Len возвращает количество уведомлений, ожидающих доставки.
+func (n *Notifier) Len() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return len(n.queue)
+}
+
+// Start запускает доставку уведомлений из очереди в отдельной горутине.
+func (n *Notifier) Start(ctx context.Context) {
+	go n.loop(ctx)
+}
+
+func (n *Notifier) loop(ctx context.Context) {
+	t := time.NewTimer(0)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			n.log.Debug("stop notifier")
+
+			return
+		case <-n.wake:
+		case <-t.C:
+		}
+
+		wait := n.deliverDue(ctx)
+
+		if !t.Stop() {
+			select {
+			case <-t.C:
+			default:
+			}
+		}
+
+		t.Reset(wait)
+	}
+}
+
+// deliverDue пытается доставить все уведомления, время которых подошло, и возвращает время до следующей попытки.
+func (n *Notifier) deliverDue(ctx context.Context) time.Duration {
+	n.mu.Lock()
+	due := make([]delivery, 0)
+
+	for _, d := range n.queue {
+		if !d.NextAttempt.After(n.now()) {
+			due = append(due, d)
+		}
+	}
+	n.mu.Unlock()
+
+	results := make(map[string]error, len(due))
+
+	for _, d := range due {
+		results[d.ID] = n.send(ctx, d)
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	queue := make([]delivery, 0, len(n.queue))
+	wait := defaultIdleWait
+
+	for _, d := range n.queue {
+		err, sent := results[d.ID]
+		if sent {
+			if err == nil {
+				continue
+			}
+
+			d.Attempts++
+			if d.Attempts >= n.maxAttempts {
+				n.log.Error("drop notification",
+					zap.String("url", d.URL),
+					zap.Int("attempts", d.Attempts),
+					zap.Error(err))
+
+				continue
+			}
+
+			d.NextAttempt = n.now().Add(n.backoff(d.Attempts))
+
+			n.log.Info("cannot deliver notification",
+				zap.String("url", d.URL),
+				zap.Int("attempt", d.Attempts),
+				zap.Time("next attempt", d.NextAttempt),
+				zap.Error(err))
+		}
+
+		if until := d.NextAttempt.Sub(n.now()); until < wait {
+			wait = until
+		}
+
+		queue = append(queue, d)
+	}
+
+	n.queue = queue
+
+	if len(due) > 0 {
+		n.persist()
+	}
+
+	if wait < 0 {
+		wait = 0
+	}
+
+	return wait
+}
+
+func (n *Notifier) backoff(attempt int) time.Duration {
+	d := n.minBackoff
+
+	for i := 1; i < attempt; i++ {
+		d *= 2
+		if d >= n.maxBackoff {
+			return n.maxBackoff
+		}
+	}
+
+	return d
+}
+
+func (n *Notifier) send(ctx context.Context, d delivery) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return fmt.Errorf("prepare request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderDelivery, d.ID)
+
+	if n.key != nil {
+		hash, err := utils.GetHash(d.Payload, n.key)
+		if err != nil {
+			return fmt.Errorf("get hash: %w", err)
+		}
+
+		req.Header.Set(HeaderHash, base64.StdEncoding.EncodeToString(hash))
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("do request: %w", err)
+	}
+
+	_ = resp.Body.Close()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("%w: %d", ErrUnexpectedStatus, resp.StatusCode)
+	}
+
+	n.log.Debug("notification delivered", zap.String("url", d.URL), zap.String("id", d.ID))
+
+	return nil
+}
+
+func (n *Notifier) load() error {
+	if n.path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(n.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+
+		return fmt.Errorf("read queue file: %w", err)
+	}
+
+	if len(data) == 0 {
+		return nil
+	}
+
+	if err := json.Unmarshal(data, &n.queue); err != nil {
+		return fmt.Errorf("unmarshal queue: %w", err)
+	}
+
+	return nil
+}
+
+// persist сохраняет очередь в файл через временный файл и переименование. Вызывается под блокировкой.
+func (n *Notifier) persist() {
+	if n.path == "" {
+		return
+	}
+
+	data, err := json.Marshal(n.queue)
+	if err != nil {
+		n.log.Error("cannot marshal queue", zap.Error(err))
+
+		return
+	}
+
+	tmp := n.path + ".tmp"
+
+	if err := os.WriteFile(tmp, data, defaultQueueFilePermission); err != nil {
+		n.log.Error("cannot write queue", zap.Error(err))
+
+		return
+	}
+
+	if err := os.Rename(tmp, n.path); err != nil {
+		n.log.Error("cannot rename queue file", zap.Error(err))
+	}
+}
+
+func newDeliveryID() string {
+	b := make([]byte, deliveryIDLength)
+	_, _ = rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
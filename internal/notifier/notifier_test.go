@@ -0,0 +1,139 @@
+package notifier
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/vorotislav/alert-service/internal/model"
+	"github.com/vorotislav/alert-service/internal/settings/server"
+	"github.com/vorotislav/alert-service/internal/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestNotifier_Deliver(t *testing.T) {
+	t.Parallel()
+
+	const key = "secret"
+
+	var calls atomic.Int32
+
+	received := make(chan Payload, 1)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+
+		hash, err := base64.StdEncoding.DecodeString(r.Header.Get(HeaderHash))
+		assert.NoError(t, err)
+
+		ok, err := utils.CheckHash(body, hash, []byte(key))
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.NotEmpty(t, r.Header.Get(HeaderDelivery))
+
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+
+			return
+		}
+
+		p := Payload{}
+		assert.NoError(t, json.Unmarshal(body, &p))
+
+		received <- p
+	}))
+	defer srv.Close()
+
+	n, err := NewNotifier(zap.NewNop(), &server.NotifySettings{
+		Webhooks:   []string{srv.URL},
+		HashKey:    key,
+		QueuePath:  filepath.Join(t.TempDir(), "queue.json"),
+		MinBackoff: "5ms",
+		MaxBackoff: "20ms",
+	})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	n.Start(ctx)
+
+	value := 150.5
+	n.Notify(model.AlertPending, model.Alert{
+		Rule:   "heap",
+		Metric: "HeapAlloc",
+		MType:  model.MetricGauge,
+		State:  model.AlertFiring,
+		Value:  &value,
+	})
+
+	select {
+	case p := <-received:
+		assert.Equal(t, "heap", p.Rule)
+		assert.Equal(t, "HeapAlloc", p.Metric)
+		assert.Equal(t, model.AlertFiring, p.State)
+		assert.Equal(t, model.AlertPending, p.PreviousState)
+		require.NotNil(t, p.Value)
+		assert.Equal(t, value, *p.Value)
+	case <-time.After(5 * time.Second):
+		t.Fatal("notification was not delivered")
+	}
+
+	assert.Eventually(t, func() bool { return n.Len() == 0 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, int32(3), calls.Load())
+}
+
+func TestNotifier_PersistentQueue(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	set := &server.NotifySettings{
+		Webhooks:   []string{srv.URL, srv.URL + "/second"},
+		QueuePath:  filepath.Join(t.TempDir(), "queue.json"),
+		MinBackoff: "1h",
+	}
+
+	n, err := NewNotifier(zap.NewNop(), set)
+	require.NoError(t, err)
+
+	n.Notify(model.AlertInactive, model.Alert{Rule: "heap", State: model.AlertPending})
+	n.deliverDue(context.Background())
+	assert.Equal(t, 2, n.Len())
+
+	restored, err := NewNotifier(zap.NewNop(), set)
+	require.NoError(t, err)
+	require.Equal(t, 2, restored.Len())
+
+	for _, d := range restored.queue {
+		assert.Equal(t, 1, d.Attempts)
+		assert.True(t, d.NextAttempt.After(time.Now()))
+	}
+}
+
+func TestNotifier_Backoff(t *testing.T) {
+	t.Parallel()
+
+	n, err := NewNotifier(zap.NewNop(), &server.NotifySettings{MinBackoff: "1s", MaxBackoff: "10s", MaxAttempts: 2})
+	require.NoError(t, err)
+
+	assert.Equal(t, time.Second, n.backoff(1))
+	assert.Equal(t, 2*time.Second, n.backoff(2))
+	assert.Equal(t, 8*time.Second, n.backoff(4))
+	assert.Equal(t, 10*time.Second, n.backoff(5))
+	assert.Equal(t, 2, n.maxAttempts)
+}
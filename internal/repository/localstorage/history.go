@@ -0,0 +1,114 @@
+package localstorage
+
+import (
+	"sync"
+	"time"
+
+	"github.com/vorotislav/alert-service/internal/model"
+)
+
+const (
+	defaultHistorySize = 1000
+)
+
+// ring кольцевой буфер значений одной метрики. При переполнении перезаписываются самые старые значения.
+type ring struct {
+	samples []model.Sample
+	start   int
+	size    int
+}
+
+func newRing(capacity int) *ring {
+	return &ring{
+		samples: make([]model.Sample, capacity),
+	}
+}
+
+func (r *ring) push(s model.Sample) {
+	end := (r.start + r.size) % len(r.samples)
+	r.samples[end] = s
+
+	if r.size < len(r.samples) {
+		r.size++
+
+		return
+	}
+
+	r.start = (r.start + 1) % len(r.samples)
+}
+
+// between возвращает значения из полуинтервала [from, to) в порядке записи.
+func (r *ring) between(from, to time.Time) []model.Sample {
+	res := make([]model.Sample, 0)
+
+	for i := 0; i < r.size; i++ {
+		s := r.samples[(r.start+i)%len(r.samples)]
+		if s.Timestamp.Before(from) || !s.Timestamp.Before(to) {
+			continue
+		}
+
+		res = append(res, s)
+	}
+
+	return res
+}
+
+// history хранит последние значения каждой серии в отдельном кольцевом буфере.
+type history struct {
+	mu       sync.Mutex
+	capacity int
+	series   map[string]*ring
+}
+
+func newHistory(capacity int) *history {
+	if capacity <= 0 {
+		capacity = defaultHistorySize
+	}
+
+	return &history{
+		capacity: capacity,
+		series:   make(map[string]*ring),
+	}
+}
+
+func historyKey(mtype, series string) string {
+	return mtype + ":" + series
+}
+
+func (h *history) record(m model.Metrics, ts time.Time) {
+	var value float64
+
+	switch {
+	case m.MType == model.MetricCounter && m.Delta != nil:
+		value = float64(*m.Delta)
+	case m.MType == model.MetricGauge && m.Value != nil:
+		value = *m.Value
+	default:
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	key := historyKey(m.MType, m.SeriesKey())
+
+	r, ok := h.series[key]
+	if !ok {
+		r = newRing(h.capacity)
+		h.series[key] = r
+	}
+
+	r.push(model.Sample{Timestamp: ts, Value: value})
+}
+
+func (h *history) between(mtype, series string, from, to time.Time) []model.Sample {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	r, ok := h.series[historyKey(mtype, series)]
+	if !ok {
+		return make([]model.Sample, 0)
+	}
+
+	return r.between(from, to)
+}
@@ -0,0 +1,40 @@
+package localstorage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/vorotislav/alert-service/internal/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistory_Ring(t *testing.T) {
+	t.Parallel()
+
+	h := newHistory(3)
+	base := time.Date(2023, 10, 20, 12, 0, 0, 0, time.UTC)
+
+	for i := 1; i <= 5; i++ {
+		value := float64(i)
+		h.record(model.Metrics{ID: "HeapAlloc", MType: model.MetricGauge, Value: &value},
+			base.Add(time.Duration(i)*time.Second))
+	}
+
+	delta := int64(10)
+	h.record(model.Metrics{ID: "HeapAlloc", MType: model.MetricCounter, Delta: &delta}, base)
+
+	samples := h.between(model.MetricGauge, "HeapAlloc", base, base.Add(time.Minute))
+	assert.Equal(t, []model.Sample{
+		{Timestamp: base.Add(3 * time.Second), Value: 3},
+		{Timestamp: base.Add(4 * time.Second), Value: 4},
+		{Timestamp: base.Add(5 * time.Second), Value: 5},
+	}, samples)
+
+	samples = h.between(model.MetricGauge, "HeapAlloc", base, base.Add(5*time.Second))
+	assert.Len(t, samples, 2)
+
+	assert.Equal(t, []model.Sample{{Timestamp: base, Value: 10}},
+		h.between(model.MetricCounter, "HeapAlloc", base, base.Add(time.Second)))
+	assert.Empty(t, h.between(model.MetricGauge, "Unknown", base, base.Add(time.Minute)))
+}
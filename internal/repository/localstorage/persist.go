@@ -0,0 +1,256 @@
+package localstorage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/vorotislav/alert-service/internal/model"
+
+	"go.uber.org/zap"
+)
+
+const (
+	walSuffix      = ".wal"
+	walOldSuffix   = ".wal.old"
+	snapshotSuffix = ".tmp"
+
+	defaultCompactInterval = 300
+	defaultSyncInterval    = 1
+)
+
+// open восстанавливает метрики из снимка и журнала (если задано восстановление), открывает журнал
+// и сразу сжимает его, чтобы снимок на диске соответствовал состоянию хранилища.
+func (m *MemStorage) open(ctx context.Context) error {
+	m.snapshotPath = m.set.FileStoragePath
+
+	walPath := m.snapshotPath + walSuffix
+	oldPath := m.snapshotPath + walOldSuffix
+
+	if m.set.Restore != nil && *m.set.Restore {
+		m.restore(walPath, oldPath)
+	} else {
+		for _, path := range []string{walPath, oldPath} {
+			if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("cannot remove wal: %w", err)
+			}
+		}
+	}
+
+	w, err := openWAL(walPath, m.fsyncPolicy())
+	if err != nil {
+		return err
+	}
+
+	m.wal = w
+
+	if err := m.compact(); err != nil {
+		_ = w.close()
+
+		return fmt.Errorf("cannot write snapshot: %w", err)
+	}
+
+	go m.persistLoop(ctx)
+
+	return nil
+}
+
+func (m *MemStorage) fsyncPolicy() string {
+	if m.set.WALFsync != "" {
+		return m.set.WALFsync
+	}
+
+	if m.set.StoreInterval == nil || *m.set.StoreInterval == 0 {
+		return FsyncAlways
+	}
+
+	return FsyncInterval
+}
+
+// restore загружает снимок и проигрывает поверх него сначала журнал, оставшийся от незавершённого сжатия,
+// затем текущий журнал.
+func (m *MemStorage) restore(walPath, oldPath string) {
+	if err := m.readSnapshot(); err != nil {
+		m.log.Info("cannot read metrics", zap.Error(err))
+	}
+
+	replay := func(metrics []model.Metrics) {
+		for _, ms := range metrics {
+			m.shards.get(ms.ID).metrics[ms.SeriesKey()] = ms
+		}
+	}
+
+	for _, path := range []string{oldPath, walPath} {
+		records, err := replayWAL(path, replay)
+		if err != nil {
+			m.log.Info("cannot replay wal", zap.String("path", path), zap.Error(err))
+		}
+
+		if records > 0 {
+			m.log.Debug("wal replayed", zap.String("path", path), zap.Int("records", records))
+		}
+	}
+}
+
+func (m *MemStorage) readSnapshot() error {
+	file, err := os.Open(m.snapshotPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+
+		return fmt.Errorf("open snapshot: %w", err)
+	}
+
+	defer file.Close()
+
+	metrics := make(map[string]model.Metrics)
+
+	if err := json.NewDecoder(file).Decode(&metrics); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		return fmt.Errorf("decode snapshot: %w", err)
+	}
+
+	m.shards.load(metrics)
+
+	return nil
+}
+
+// log2wal дописывает обновлённые метрики в журнал, если хранилище сохраняет метрики в файл.
+func (m *MemStorage) log2wal(metrics ...model.Metrics) error {
+	if m.wal == nil {
+		return nil
+	}
+
+	if err := m.wal.append(metrics...); err != nil {
+		return fmt.Errorf("%w: %w", ErrStorageNotAvailable, err)
+	}
+
+	return nil
+}
+
+// compact сохраняет текущее состояние в снимок и удаляет вошедшие в него записи журнала.
+// Снимок и ротация журнала делаются под общей блокировкой, поэтому каждое обновление попадает
+// либо в снимок, либо в новый журнал. Запись снимка на диск идёт уже без блокировки.
+func (m *MemStorage) compact() error {
+	m.compactMu.Lock()
+	defer m.compactMu.Unlock()
+
+	oldPath := m.snapshotPath + walOldSuffix
+
+	m.gate.Lock()
+	metrics := m.shards.snapshot()
+	err := m.wal.rotate(oldPath)
+	m.gate.Unlock()
+
+	if err != nil {
+		return fmt.Errorf("rotate wal: %w", err)
+	}
+
+	if err := writeSnapshot(m.snapshotPath, metrics); err != nil {
+		return err
+	}
+
+	if err := os.Remove(oldPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove old wal: %w", err)
+	}
+
+	return nil
+}
+
+// writeSnapshot записывает метрики во временный файл и атомарно переименовывает его в файл снимка.
+func writeSnapshot(path string, metrics map[string]model.Metrics) error {
+	tmp := path + snapshotSuffix
+
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, defaultStorageFilePermission)
+	if err != nil {
+		return fmt.Errorf("open snapshot: %w", err)
+	}
+
+	if err := json.NewEncoder(file).Encode(metrics); err != nil {
+		_ = file.Close()
+
+		return fmt.Errorf("encode snapshot: %w", err)
+	}
+
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+
+		return fmt.Errorf("sync snapshot: %w", err)
+	}
+
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("close snapshot: %w", err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("rename snapshot: %w", err)
+	}
+
+	return syncDir(filepath.Dir(path))
+}
+
+func syncDir(path string) error {
+	dir, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("open dir: %w", err)
+	}
+
+	defer dir.Close()
+
+	if err := dir.Sync(); err != nil {
+		return fmt.Errorf("sync dir: %w", err)
+	}
+
+	return nil
+}
+
+// persistLoop периодически синхронизирует журнал с диском (при политике interval) и сжимает его.
+func (m *MemStorage) persistLoop(ctx context.Context) {
+	compactInterval := m.set.WALCompact
+	if compactInterval <= 0 {
+		compactInterval = defaultCompactInterval
+	}
+
+	compactTicker := time.NewTicker(time.Duration(compactInterval) * time.Second)
+	defer compactTicker.Stop()
+
+	var syncC <-chan time.Time
+
+	if m.wal.policy == FsyncInterval {
+		syncInterval := defaultSyncInterval
+		if m.set.StoreInterval != nil && *m.set.StoreInterval > 0 {
+			syncInterval = *m.set.StoreInterval
+		}
+
+		syncTicker := time.NewTicker(time.Duration(syncInterval) * time.Second)
+		defer syncTicker.Stop()
+
+		syncC = syncTicker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			m.log.Debug("stop persisting metrics")
+
+			return
+		case <-syncC:
+			if err := m.wal.sync(); err != nil {
+				m.log.Error("cannot sync wal", zap.Error(err))
+			}
+		case <-compactTicker.C:
+			if err := m.compact(); err != nil {
+				m.log.Error("cannot compact wal", zap.Error(err))
+			}
+		}
+	}
+}
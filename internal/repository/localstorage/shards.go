@@ -0,0 +1,119 @@
+package localstorage
+
+import (
+	"hash/fnv"
+	"sort"
+	"sync"
+
+	"github.com/vorotislav/alert-service/internal/model"
+)
+
+const (
+	defaultShardCount = 32
+)
+
+// shard часть хранилища со своей блокировкой. Метрики хранятся по ключу серии (model.Metrics.SeriesKey).
+type shard struct {
+	mu      sync.RWMutex
+	metrics map[string]model.Metrics
+}
+
+// shards набор частей хранилища. Метрика попадает в часть по хешу своего имени,
+// поэтому обновления разных метрик не блокируют друг друга, а все серии одной метрики лежат в одной части.
+type shards []*shard
+
+func newShards(n int) shards {
+	s := make(shards, n)
+
+	for i := range s {
+		s[i] = &shard{metrics: make(map[string]model.Metrics)}
+	}
+
+	return s
+}
+
+func (s shards) index(id string) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(id))
+
+	return int(h.Sum32() % uint32(len(s)))
+}
+
+func (s shards) get(id string) *shard {
+	return s[s.index(id)]
+}
+
+// lock блокирует на запись части, в которые попадают метрики ids, в порядке возрастания индекса,
+// чтобы одновременные пакетные обновления не попали во взаимную блокировку. Возвращает функцию разблокировки.
+func (s shards) lock(ids []string) func() {
+	idx := make(map[int]struct{}, len(ids))
+	for _, id := range ids {
+		idx[s.index(id)] = struct{}{}
+	}
+
+	order := make([]int, 0, len(idx))
+	for i := range idx {
+		order = append(order, i)
+	}
+
+	sort.Ints(order)
+
+	for _, i := range order {
+		s[i].mu.Lock()
+	}
+
+	return func() {
+		for j := len(order) - 1; j >= 0; j-- {
+			s[order[j]].mu.Unlock()
+		}
+	}
+}
+
+// snapshot возвращает согласованную копию всех метрик: на время копирования блокируются все части сразу.
+func (s shards) snapshot() map[string]model.Metrics {
+	for _, sh := range s {
+		sh.mu.RLock()
+	}
+
+	defer func() {
+		for j := len(s) - 1; j >= 0; j-- {
+			s[j].mu.RUnlock()
+		}
+	}()
+
+	size := 0
+	for _, sh := range s {
+		size += len(sh.metrics)
+	}
+
+	res := make(map[string]model.Metrics, size)
+
+	for _, sh := range s {
+		for key, m := range sh.metrics {
+			res[key] = m.Clone()
+		}
+	}
+
+	return res
+}
+
+// load заменяет содержимое хранилища переданными метриками.
+func (s shards) load(metrics map[string]model.Metrics) {
+	for _, sh := range s {
+		sh.mu.Lock()
+	}
+
+	defer func() {
+		for j := len(s) - 1; j >= 0; j-- {
+			s[j].mu.Unlock()
+		}
+	}()
+
+	for _, sh := range s {
+		sh.metrics = make(map[string]model.Metrics)
+	}
+
+	for key, m := range metrics {
+		s.get(m.ID).metrics[key] = m.Clone()
+	}
+}
@@ -5,9 +5,11 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"os"
+	"sort"
+	"sync"
 	"time"
 
+	"github.com/vorotislav/alert-service/internal/idempotency"
 	"github.com/vorotislav/alert-service/internal/model"
 	"github.com/vorotislav/alert-service/internal/settings/server"
 
@@ -17,108 +19,208 @@ import (
 var (
 	ErrNotFound            = errors.New("metrics not found")
 	ErrStorageNotAvailable = errors.New("storage not available")
-	ErrUpdatesNotAvailbale = errors.New("cannot update metrics in local storage")
 )
 
 const (
 	defaultStorageFilePermission = 0o666
 )
 
+// MemStorage хранилище метрик в памяти. Каждое обновление дописывается в журнал упреждающей записи,
+// который периодически сжимается в снимок, поэтому подтверждённые обновления переживают перезапуск.
+// Ключи уже применённых запросов хранятся только в памяти и после перезапуска забываются.
+// Метрики разложены по частям со своими блокировками, поэтому хранилище безопасно
+// для одновременного использования из обработчиков и из горутины сохранения.
 type MemStorage struct {
-	log     *zap.Logger
-	set     *server.Settings
-	Metrics map[string]model.Metrics `json:"metrics"`
-
-	encoder     *json.Encoder
-	decoder     *json.Decoder
-	file        *os.File
-	saveMetrics bool
-	async       bool
+	log    *zap.Logger
+	set    *server.Settings
+	shards shards
+
+	// gate на чтение берётся при каждом обновлении, на запись - при сжатии журнала,
+	// чтобы снимок и начало нового журнала соответствовали друг другу.
+	gate         sync.RWMutex
+	wal          *wal
+	snapshotPath string
+	compactMu    sync.Mutex
+
+	history *history
+	applied *idempotency.Cache
 }
 
+// NewMemStorage конструктор для MemStorage. Если задан путь к файлу, восстанавливает метрики
+// из снимка и журнала и запускает периодическую синхронизацию и сжатие журнала.
 func NewMemStorage(ctx context.Context, log *zap.Logger, set *server.Settings) (*MemStorage, error) {
-	var (
-		file        *os.File
-		err         error
-		saveMetrics bool
-	)
-
-	if set.FileStoragePath != "" {
-		file, err = os.OpenFile(set.FileStoragePath, os.O_RDWR|os.O_CREATE, defaultStorageFilePermission)
+	store := &MemStorage{
+		log:     log.With(zap.String("package", "store")),
+		set:     set,
+		history: newHistory(set.HistorySize),
+		applied: idempotency.NewCache(idempotency.DefaultTTL, idempotency.DefaultCapacity),
+		shards:  newShards(defaultShardCount),
+	}
+
+	if set.FileStoragePath == "" {
+		return store, nil
+	}
+
+	if err := store.open(ctx); err != nil {
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// Stop сжимает журнал в снимок и закрывает его.
+func (m *MemStorage) Stop(_ context.Context) error {
+	m.log.Debug("stopping store...")
+
+	if m.wal == nil {
+		return nil
+	}
+
+	if err := m.compact(); err != nil {
+		m.log.Error("cannot compact wal", zap.Error(err))
+	}
+
+	return m.wal.close()
+}
+
+// UpdateMetric обновляет значение метрики. Если в контексте есть ключ запроса, который уже был применён,
+// значение не меняется и возвращается результат первого применения.
+func (m *MemStorage) UpdateMetric(ctx context.Context, ms model.Metrics) (model.Metrics, error) {
+	key := idempotency.KeyFromContext(ctx)
+	if key == "" {
+		return m.updateMetric(ms)
+	}
+
+	res, _, err := m.applied.Do(idempotency.Scoped(idempotency.KindMetric, key), func() ([]model.Metrics, error) {
+		metric, err := m.updateMetric(ms)
 		if err != nil {
-			return nil, fmt.Errorf("cannot open file for metrics: %w", err)
+			return nil, err
 		}
 
-		saveMetrics = true
+		return []model.Metrics{metric}, nil
+	})
+	if err != nil {
+		return model.Metrics{}, err //nolint:wrapcheck
 	}
 
-	store := &MemStorage{
-		log:         log.With(zap.String("package", "store")),
-		set:         set,
-		file:        file,
-		encoder:     json.NewEncoder(file),
-		decoder:     json.NewDecoder(file),
-		saveMetrics: saveMetrics,
+	if len(res) == 0 {
+		return model.Metrics{}, idempotency.ErrNoResult
 	}
-	store.Metrics = make(map[string]model.Metrics)
 
-	if *set.StoreInterval > 0 {
-		go store.asyncLoop(ctx, *set.StoreInterval)
+	return res[0], nil
+}
+
+func (m *MemStorage) updateMetric(ms model.Metrics) (model.Metrics, error) {
+	m.gate.RLock()
+	defer m.gate.RUnlock()
+
+	sh := m.shards.get(ms.ID)
+
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	key := ms.SeriesKey()
+	metric := apply(sh.metrics[key], ms)
 
-		store.async = true
+	if err := m.log2wal(metric); err != nil {
+		return model.Metrics{}, err
 	}
 
-	if *set.Restore {
-		if err := store.readMetrics(); err != nil {
-			log.Info("cannot read metrics",
-				zap.Error(err))
-		}
+	sh.metrics[key] = metric
+
+	m.history.record(metric, time.Now())
+
+	return metric.Clone(), nil
+}
+
+// apply возвращает новое значение метрики: счётчик прибавляется к текущему значению,
+// остальные метрики заменяются. Результат не разделяет память с аргументами.
+func apply(cur, ms model.Metrics) model.Metrics {
+	next := ms.Clone()
+
+	if cur.MType == model.MetricCounter && ms.MType == model.MetricCounter && cur.Delta != nil && ms.Delta != nil {
+		*next.Delta += *cur.Delta
 	}
 
-	return store, nil
+	return next
 }
 
-func (m *MemStorage) Stop(_ context.Context) error {
-	m.log.Debug("stopping store...")
+// History возвращает сохранённые значения серии из полуинтервала [from, to).
+// Серия выбирается по меткам так же, как в GetGaugeValue.
+func (m *MemStorage) History(_ context.Context, mtype, name string, labels map[string]string,
+	from, to time.Time,
+) ([]model.Sample, error) {
+	metric, err := m.lookup(mtype, name, labels)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return make([]model.Sample, 0), nil
+		}
 
-	if m.file != nil {
-		return m.file.Close() //nolint:wrapcheck
+		return nil, err
 	}
 
-	return nil
+	return m.history.between(mtype, metric.SeriesKey(), from, to), nil
 }
 
-func (m *MemStorage) UpdateMetric(_ context.Context, ms model.Metrics) (model.Metrics, error) {
-	metric, ok := m.Metrics[ms.ID]
-	if !ok {
-		m.Metrics[ms.ID] = ms
+// lookup выбирает серию метрики с типом mtype по меткам (см. model.SelectSeries).
+func (m *MemStorage) lookup(mtype, name string, labels map[string]string) (model.Metrics, error) {
+	sh := m.shards.get(name)
+
+	sh.mu.RLock()
+
+	series := make([]model.Metrics, 0, 1)
 
-		return ms, nil
+	for _, metric := range sh.metrics {
+		if metric.ID == name && metric.MType == mtype {
+			series = append(series, metric)
+		}
 	}
 
-	switch ms.MType {
-	case model.MetricCounter:
-		*metric.Delta += *ms.Delta
-		m.Metrics[ms.ID] = metric
-	default:
-		*metric.Value = *ms.Value
-		m.Metrics[ms.ID] = metric
+	sh.mu.RUnlock()
+
+	metric, err := model.SelectSeries(series, labels)
+	if err != nil {
+		if errors.Is(err, model.ErrSeriesNotFound) {
+			return model.Metrics{}, ErrNotFound
+		}
+
+		return model.Metrics{}, err //nolint:wrapcheck
 	}
 
-	return metric, nil
+	return metric.Clone(), nil
 }
 
-func (m *MemStorage) GetCounterValue(_ context.Context, name string) (int64, error) {
-	metric, ok := m.Metrics[name]
-	if !ok {
+// GetCounterValue возвращает значение счётчика по имени и меткам.
+func (m *MemStorage) GetCounterValue(_ context.Context, name string, labels map[string]string) (int64, error) {
+	metric, err := m.lookup(model.MetricCounter, name, labels)
+	if err != nil {
+		return 0, err
+	}
+
+	if metric.Delta == nil {
 		return 0, ErrNotFound
 	}
 
 	return *metric.Delta, nil
 }
 
+// GetGaugeValue возвращает значение датчика по имени и меткам.
+func (m *MemStorage) GetGaugeValue(_ context.Context, name string, labels map[string]string) (float64, error) {
+	metric, err := m.lookup(model.MetricGauge, name, labels)
+	if err != nil {
+		return 0, err
+	}
+
+	if metric.Value == nil {
+		return 0, ErrNotFound
+	}
+
+	return *metric.Value, nil
+}
+
+// AllMetrics возвращает все метрики в виде json-объекта, где ключ - ключ серии (имя метрики и метки).
 func (m *MemStorage) AllMetrics(_ context.Context) ([]byte, error) {
-	resp, err := json.Marshal(m.Metrics)
+	resp, err := json.Marshal(m.shards.snapshot())
 	if err != nil {
 		return nil, fmt.Errorf("read all metrics: %w", err)
 	}
@@ -126,72 +228,99 @@ func (m *MemStorage) AllMetrics(_ context.Context) ([]byte, error) {
 	return resp, nil
 }
 
-func (m *MemStorage) GetGaugeValue(_ context.Context, name string) (float64, error) {
-	metric, ok := m.Metrics[name]
-	if !ok {
-		return 0, ErrNotFound
+// ListMetrics возвращает все метрики, упорядоченные по имени, а серии одной метрики - по ключу серии.
+func (m *MemStorage) ListMetrics(_ context.Context) ([]model.Metrics, error) {
+	snapshot := m.shards.snapshot()
+	metrics := make([]model.Metrics, 0, len(snapshot))
+
+	for _, metric := range snapshot {
+		metrics = append(metrics, metric)
 	}
 
-	return *metric.Value, nil
-}
+	sort.Slice(metrics, func(i, j int) bool {
+		if metrics[i].ID != metrics[j].ID {
+			return metrics[i].ID < metrics[j].ID
+		}
 
-func (m *MemStorage) writeMetrics() error {
-	// if err := m.file.Truncate(0); err != nil {
-	//	m.log.Info("cannot truncate file", zap.Error(err))
-	// }
-	if err := m.encoder.Encode(m.Metrics); err != nil {
-		return fmt.Errorf("cannot write counter metrics: %w", err)
-	}
+		return metrics[i].SeriesKey() < metrics[j].SeriesKey()
+	})
 
-	_, err := m.file.Seek(0, 0)
-	if err != nil {
-		m.log.Debug("seek in file", zap.Error(err))
+	return metrics, nil
+}
 
-		return fmt.Errorf("cannot seek file: %w", err)
+// Ping возвращает доступность файла с метриками.
+func (m *MemStorage) Ping(_ context.Context) error {
+	if m.wal == nil {
+		return ErrStorageNotAvailable
 	}
 
 	return nil
 }
 
-func (m *MemStorage) readMetrics() error {
-	if err := m.decoder.Decode(&m.Metrics); err != nil {
-		return fmt.Errorf("cannot read metrics: %w", err)
+// UpdateMetrics обновляет сразу массив метрик по принципу "всё или ничего": если хотя бы одна метрика
+// некорректна, ни одна не применяется и возвращается *model.BatchError со списком отклонённых.
+func (m *MemStorage) UpdateMetrics(ctx context.Context, metrics []model.Metrics) error {
+	key := idempotency.KeyFromContext(ctx)
+	if key == "" {
+		return m.updateMetrics(metrics)
 	}
 
-	return nil
+	_, _, err := m.applied.Do(idempotency.Scoped(idempotency.KindBatch, key), func() ([]model.Metrics, error) {
+		return nil, m.updateMetrics(metrics)
+	})
+
+	return err //nolint:wrapcheck
 }
 
-func (m *MemStorage) asyncLoop(ctx context.Context, timeout int) {
-	t := time.NewTicker(time.Duration(timeout) * time.Second)
+func (m *MemStorage) updateMetrics(metrics []model.Metrics) error {
+	if err := model.ValidateBatch(metrics); err != nil {
+		return err //nolint:wrapcheck
+	}
 
-	for {
-		select {
-		case <-ctx.Done():
-			m.log.Info("context is done")
+	ids := make([]string, 0, len(metrics))
+	for _, ms := range metrics {
+		ids = append(ids, ms.ID)
+	}
+
+	m.gate.RLock()
+	defer m.gate.RUnlock()
+
+	unlock := m.shards.lock(ids)
+	defer unlock()
 
-			if err := m.writeMetrics(); err != nil {
-				m.log.Info("cannot write metrics", zap.Error(err))
-			}
+	// Метрики одной серии внутри пакета применяются последовательно,
+	// поэтому промежуточные значения копятся в updated, а не в хранилище.
+	updated := make(map[string]model.Metrics, len(metrics))
+	order := make([]string, 0, len(metrics))
 
-			return
-		case <-t.C:
-			m.log.Info("write to file")
+	for _, ms := range metrics {
+		key := ms.SeriesKey()
 
-			if err := m.writeMetrics(); err != nil {
-				m.log.Info("cannot write metrics", zap.Error(err))
-			}
+		cur, ok := updated[key]
+		if !ok {
+			cur = m.shards.get(ms.ID).metrics[key]
+
+			order = append(order, key)
 		}
+
+		updated[key] = apply(cur, ms)
 	}
-}
 
-func (m *MemStorage) Ping(_ context.Context) error {
-	if m.file == nil {
-		return ErrStorageNotAvailable
+	record := make([]model.Metrics, 0, len(order))
+	for _, id := range order {
+		record = append(record, updated[id])
 	}
 
-	return nil
-}
+	if err := m.log2wal(record...); err != nil {
+		return err
+	}
+
+	now := time.Now()
 
-func (m *MemStorage) UpdateMetrics(_ context.Context, _ []model.Metrics) error {
-	return ErrUpdatesNotAvailbale
+	for _, metric := range record {
+		m.shards.get(metric.ID).metrics[metric.SeriesKey()] = metric
+		m.history.record(metric, now)
+	}
+
+	return nil
 }
@@ -0,0 +1,409 @@
+package localstorage
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/vorotislav/alert-service/internal/idempotency"
+	"github.com/vorotislav/alert-service/internal/model"
+	"github.com/vorotislav/alert-service/internal/settings/server"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func newTestStorage(t *testing.T) *MemStorage {
+	t.Helper()
+
+	interval := 0
+	restore := false
+
+	s, err := NewMemStorage(context.Background(), zap.NewNop(), &server.Settings{
+		StoreInterval: &interval,
+		Restore:       &restore,
+	})
+	require.NoError(t, err)
+
+	return s
+}
+
+func TestMemStorage_UpdateMetricIdempotent(t *testing.T) {
+	t.Parallel()
+
+	s := newTestStorage(t)
+	ctx := idempotency.WithKey(context.Background(), "request-1")
+
+	delta := int64(3)
+	metric := model.Metrics{ID: "PollCount", MType: model.MetricCounter, Delta: &delta}
+
+	first, err := s.UpdateMetric(ctx, metric.Clone())
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), *first.Delta)
+
+	replay, err := s.UpdateMetric(ctx, metric.Clone())
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), *replay.Delta)
+
+	other, err := s.UpdateMetric(idempotency.WithKey(context.Background(), "request-2"), metric.Clone())
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), *other.Delta)
+
+	replay, err = s.UpdateMetric(ctx, metric.Clone())
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), *replay.Delta)
+
+	value, err := s.GetCounterValue(context.Background(), "PollCount", nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), value)
+}
+
+func TestMemStorage_IdempotentKeyAcrossKinds(t *testing.T) {
+	t.Parallel()
+
+	s := newTestStorage(t)
+	ctx := idempotency.WithKey(context.Background(), "request-1")
+
+	delta := int64(2)
+	metric := model.Metrics{ID: "PollCount", MType: model.MetricCounter, Delta: &delta}
+
+	// Ключ, применённый к пакету (/updates), не подменяет результат обновления одной метрики (/update).
+	require.NoError(t, s.UpdateMetrics(ctx, []model.Metrics{metric.Clone()}))
+
+	res, err := s.UpdateMetric(ctx, metric.Clone())
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), *res.Delta)
+
+	require.NoError(t, s.UpdateMetrics(ctx, []model.Metrics{metric.Clone()}))
+
+	res, err = s.UpdateMetric(ctx, metric.Clone())
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), *res.Delta)
+
+	value, err := s.GetCounterValue(context.Background(), "PollCount", nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), value)
+}
+
+func TestMemStorage_Labels(t *testing.T) {
+	t.Parallel()
+
+	s := newTestStorage(t)
+	ctx := context.Background()
+
+	gauge := func(value float64, labels map[string]string) model.Metrics {
+		return model.Metrics{ID: "HeapAlloc", MType: model.MetricGauge, Value: &value, Labels: labels}
+	}
+
+	require.NoError(t, s.UpdateMetrics(ctx, []model.Metrics{
+		gauge(1, map[string]string{"host": "a", "dc": "eu"}),
+		gauge(2, map[string]string{"host": "b", "dc": "eu"}),
+	}))
+
+	tests := []struct {
+		name    string
+		labels  map[string]string
+		want    float64
+		wantErr error
+	}{
+		{name: "by host", labels: map[string]string{"host": "b"}, want: 2},
+		{name: "exact", labels: map[string]string{"host": "a", "dc": "eu"}, want: 1},
+		{name: "ambiguous", labels: map[string]string{"dc": "eu"}, wantErr: model.ErrAmbiguousSeries},
+		{name: "not found", labels: map[string]string{"host": "c"}, wantErr: ErrNotFound},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			value, err := s.GetGaugeValue(ctx, "HeapAlloc", tc.labels)
+			if tc.wantErr != nil {
+				require.ErrorIs(t, err, tc.wantErr)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, value)
+		})
+	}
+
+	// Серия без меток выбирается запросом без меток, даже если есть серии с метками.
+	_, err := s.UpdateMetric(ctx, gauge(3, nil))
+	require.NoError(t, err)
+
+	value, err := s.GetGaugeValue(ctx, "HeapAlloc", nil)
+	require.NoError(t, err)
+	assert.Equal(t, float64(3), value)
+
+	metrics, err := s.ListMetrics(ctx)
+	require.NoError(t, err)
+	assert.Len(t, metrics, 3)
+}
+
+func TestMemStorage_ConcurrentUpdates(t *testing.T) {
+	t.Parallel()
+
+	const (
+		writers    = 16
+		iterations = 500
+		names      = 8
+	)
+
+	s := newTestStorage(t)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+
+	done := make(chan struct{})
+
+	readerDone := make(chan struct{})
+	go func() {
+		defer close(readerDone)
+
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+
+			_, err := s.AllMetrics(ctx)
+			assert.NoError(t, err)
+
+			snapshot := s.shards.snapshot()
+			for _, m := range snapshot {
+				if m.MType == model.MetricCounter {
+					assert.NotNil(t, m.Delta)
+				}
+			}
+
+			_, _ = s.GetCounterValue(ctx, "counter0", nil)
+		}
+	}()
+
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+
+		go func(w int) {
+			defer wg.Done()
+
+			for i := 0; i < iterations; i++ {
+				delta := int64(1)
+				value := float64(w*iterations + i)
+
+				_, err := s.UpdateMetric(ctx, model.Metrics{
+					ID:    fmt.Sprintf("counter%d", i%names),
+					MType: model.MetricCounter,
+					Delta: &delta,
+				})
+				assert.NoError(t, err)
+
+				_, err = s.UpdateMetric(ctx, model.Metrics{
+					ID:    fmt.Sprintf("gauge%d", i%names),
+					MType: model.MetricGauge,
+					Value: &value,
+				})
+				assert.NoError(t, err)
+			}
+		}(w)
+	}
+
+	wg.Wait()
+	close(done)
+	<-readerDone
+
+	var total int64
+
+	for i := 0; i < names; i++ {
+		v, err := s.GetCounterValue(ctx, fmt.Sprintf("counter%d", i), nil)
+		require.NoError(t, err)
+
+		total += v
+	}
+
+	assert.Equal(t, int64(writers*iterations), total)
+
+	metrics, err := s.ListMetrics(ctx)
+	require.NoError(t, err)
+	assert.Len(t, metrics, 2*names)
+}
+
+func TestMemStorage_PersistSnapshot(t *testing.T) {
+	t.Parallel()
+
+	interval := 0
+	restore := true
+	set := &server.Settings{
+		StoreInterval:   &interval,
+		Restore:         &restore,
+		FileStoragePath: filepath.Join(t.TempDir(), "metrics.json"),
+	}
+
+	s, err := NewMemStorage(context.Background(), zap.NewNop(), set)
+	require.NoError(t, err)
+
+	delta := int64(7)
+	value := 1.5
+
+	_, err = s.UpdateMetric(context.Background(), model.Metrics{ID: "PollCount", MType: model.MetricCounter, Delta: &delta})
+	require.NoError(t, err)
+	_, err = s.UpdateMetric(context.Background(), model.Metrics{ID: "HeapAlloc", MType: model.MetricGauge, Value: &value})
+	require.NoError(t, err)
+
+	require.NoError(t, s.compact())
+
+	value = 2.5
+	_, err = s.UpdateMetric(context.Background(), model.Metrics{ID: "HeapAlloc", MType: model.MetricGauge, Value: &value})
+	require.NoError(t, err)
+
+	require.NoError(t, s.Stop(context.Background()))
+
+	restored, err := NewMemStorage(context.Background(), zap.NewNop(), set)
+	require.NoError(t, err)
+
+	counter, err := restored.GetCounterValue(context.Background(), "PollCount", nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), counter)
+
+	gauge, err := restored.GetGaugeValue(context.Background(), "HeapAlloc", nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2.5, gauge)
+}
+
+func BenchmarkMemStorage_UpdateMetric(b *testing.B) {
+	interval := 0
+	restore := false
+
+	s, err := NewMemStorage(context.Background(), zap.NewNop(), &server.Settings{
+		StoreInterval: &interval,
+		Restore:       &restore,
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	names := make([]string, 64)
+	for i := range names {
+		names[i] = fmt.Sprintf("metric%d", i)
+	}
+
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+
+		for pb.Next() {
+			delta := int64(1)
+
+			_, _ = s.UpdateMetric(context.Background(), model.Metrics{
+				ID:    names[i%len(names)],
+				MType: model.MetricCounter,
+				Delta: &delta,
+			})
+			i++
+		}
+	})
+}
+
+func BenchmarkMemStorage_GetGaugeValue(b *testing.B) {
+	interval := 0
+	restore := false
+
+	s, err := NewMemStorage(context.Background(), zap.NewNop(), &server.Settings{
+		StoreInterval: &interval,
+		Restore:       &restore,
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	value := 1.0
+
+	_, _ = s.UpdateMetric(context.Background(), model.Metrics{ID: "HeapAlloc", MType: model.MetricGauge, Value: &value})
+
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_, _ = s.GetGaugeValue(context.Background(), "HeapAlloc", nil)
+		}
+	})
+}
+
+func BenchmarkMemStorage_Snapshot(b *testing.B) {
+	interval := 0
+	restore := false
+
+	s, err := NewMemStorage(context.Background(), zap.NewNop(), &server.Settings{
+		StoreInterval: &interval,
+		Restore:       &restore,
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for i := 0; i < 1000; i++ {
+		value := float64(i)
+
+		_, _ = s.UpdateMetric(context.Background(), model.Metrics{
+			ID:    fmt.Sprintf("metric%d", i),
+			MType: model.MetricGauge,
+			Value: &value,
+		})
+	}
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		_ = s.shards.snapshot()
+	}
+}
+
+func TestMemStorage_UpdateMetrics(t *testing.T) {
+	t.Parallel()
+
+	s := newTestStorage(t)
+	ctx := context.Background()
+
+	delta := int64(2)
+	value := 3.5
+
+	err := s.UpdateMetrics(ctx, []model.Metrics{
+		{ID: "PollCount", MType: model.MetricCounter, Delta: &delta},
+		{ID: "PollCount", MType: model.MetricCounter, Delta: &delta},
+		{ID: "HeapAlloc", MType: model.MetricGauge, Value: &value},
+	})
+	require.NoError(t, err)
+
+	counter, err := s.GetCounterValue(ctx, "PollCount", nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), counter)
+
+	gauge, err := s.GetGaugeValue(ctx, "HeapAlloc", nil)
+	require.NoError(t, err)
+	assert.Equal(t, 3.5, gauge)
+
+	err = s.UpdateMetrics(ctx, []model.Metrics{
+		{ID: "PollCount", MType: model.MetricCounter, Delta: &delta},
+		{ID: "HeapAlloc", MType: model.MetricGauge},
+		{ID: "Other", MType: "histogram", Value: &value},
+		{MType: model.MetricGauge, Value: &value},
+	})
+
+	var batchErr *model.BatchError
+	require.ErrorAs(t, err, &batchErr)
+	require.Len(t, batchErr.Rejected, 3)
+	assert.Equal(t, 1, batchErr.Rejected[0].Index)
+	assert.Equal(t, "HeapAlloc", batchErr.Rejected[0].ID)
+	assert.Equal(t, 2, batchErr.Rejected[1].Index)
+	assert.Equal(t, 3, batchErr.Rejected[2].Index)
+
+	counter, err = s.GetCounterValue(ctx, "PollCount", nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), counter)
+}
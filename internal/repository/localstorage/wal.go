@@ -0,0 +1,261 @@
+package localstorage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/vorotislav/alert-service/internal/model"
+)
+
+// Политики синхронизации журнала с диском.
+const (
+	// FsyncAlways каждая запись журнала синхронизируется с диском до ответа клиенту.
+	FsyncAlways = "always"
+	// FsyncInterval журнал синхронизируется с диском периодически.
+	FsyncInterval = "interval"
+	// FsyncNever синхронизация остаётся на усмотрение операционной системы.
+	FsyncNever = "never"
+)
+
+var (
+	ErrUnknownFsyncPolicy = errors.New("unknown fsync policy")
+	ErrWALClosed          = errors.New("wal closed")
+)
+
+// wal журнал упреждающей записи. Каждая запись - одна строка с json-массивом метрик
+// в том виде, в котором они оказались в хранилище после обновления. Поэтому повторное
+// применение записи не меняет результат, и журнал можно безопасно проигрывать поверх снимка.
+type wal struct {
+	mu     sync.Mutex
+	path   string
+	policy string
+	file   *os.File
+	dirty  bool
+}
+
+func openWAL(path, policy string) (*wal, error) {
+	switch policy {
+	case FsyncAlways, FsyncInterval, FsyncNever:
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownFsyncPolicy, policy)
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, defaultStorageFilePermission)
+	if err != nil {
+		return nil, fmt.Errorf("open wal: %w", err)
+	}
+
+	return &wal{
+		path:   path,
+		policy: policy,
+		file:   file,
+	}, nil
+}
+
+// append дописывает запись в журнал. При политике always возвращается только после синхронизации с диском.
+func (w *wal) append(metrics ...model.Metrics) error {
+	raw, err := json.Marshal(metrics)
+	if err != nil {
+		return fmt.Errorf("marshal wal record: %w", err)
+	}
+
+	raw = append(raw, '\n')
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return ErrWALClosed
+	}
+
+	if _, err := w.file.Write(raw); err != nil {
+		return fmt.Errorf("write wal record: %w", err)
+	}
+
+	if w.policy == FsyncAlways {
+		if err := w.file.Sync(); err != nil {
+			return fmt.Errorf("sync wal: %w", err)
+		}
+
+		return nil
+	}
+
+	w.dirty = true
+
+	return nil
+}
+
+// sync синхронизирует журнал с диском, если с прошлой синхронизации были записи.
+func (w *wal) sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil || !w.dirty {
+		return nil
+	}
+
+	if err := w.file.Sync(); err != nil {
+		return fmt.Errorf("sync wal: %w", err)
+	}
+
+	w.dirty = false
+
+	return nil
+}
+
+// rotate переносит текущие записи журнала в файл old и начинает журнал заново.
+// Если old уже существует (предыдущее сжатие не завершилось), записи дописываются в его конец.
+func (w *wal) rotate(old string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return ErrWALClosed
+	}
+
+	if err := w.file.Sync(); err != nil {
+		return fmt.Errorf("sync wal: %w", err)
+	}
+
+	err := w.file.Close()
+	w.file = nil
+
+	if err != nil {
+		return w.reopen(fmt.Errorf("close wal: %w", err))
+	}
+
+	if _, err := os.Stat(old); err == nil {
+		err = appendFile(old, w.path)
+		if err != nil {
+			return w.reopen(err)
+		}
+	} else if err := os.Rename(w.path, old); err != nil {
+		return w.reopen(fmt.Errorf("rename wal: %w", err))
+	}
+
+	file, err := os.OpenFile(w.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE|os.O_TRUNC, defaultStorageFilePermission)
+	if err != nil {
+		return fmt.Errorf("open wal: %w", err)
+	}
+
+	w.file = file
+	w.dirty = false
+
+	return nil
+}
+
+// reopen открывает журнал на дописывание после неудачного rotate, чтобы записи не потерялись
+// и обновления не отклонялись с ErrWALClosed. Возвращает cause, дополненную ошибкой открытия.
+// Вызывается под блокировкой w.mu.
+func (w *wal) reopen(cause error) error {
+	file, err := os.OpenFile(w.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, defaultStorageFilePermission)
+	if err != nil {
+		return fmt.Errorf("%w: reopen wal: %w", cause, err)
+	}
+
+	w.file = file
+
+	return cause
+}
+
+func (w *wal) close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return nil
+	}
+
+	file := w.file
+	w.file = nil
+
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+
+		return fmt.Errorf("sync wal: %w", err)
+	}
+
+	return file.Close() //nolint:wrapcheck
+}
+
+func appendFile(dst, src string) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return fmt.Errorf("read wal: %w", err)
+	}
+
+	f, err := os.OpenFile(dst, os.O_WRONLY|os.O_APPEND, defaultStorageFilePermission)
+	if err != nil {
+		return fmt.Errorf("open old wal: %w", err)
+	}
+
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+
+		return fmt.Errorf("append old wal: %w", err)
+	}
+
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+
+		return fmt.Errorf("sync old wal: %w", err)
+	}
+
+	return f.Close() //nolint:wrapcheck
+}
+
+// replayWAL читает записи журнала и передаёт метрики в fn. Недописанная последняя запись
+// (например, после аварийного завершения) отбрасывается, а файл обрезается до последней целой записи.
+// Возвращает количество применённых записей.
+func replayWAL(path string, fn func(metrics []model.Metrics)) (int, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, defaultStorageFilePermission)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, nil
+		}
+
+		return 0, fmt.Errorf("open wal: %w", err)
+	}
+
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+
+	var (
+		offset  int64
+		records int
+	)
+
+	for {
+		line, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return records, fmt.Errorf("read wal: %w", err)
+		}
+
+		metrics := make([]model.Metrics, 0)
+		if err := json.Unmarshal(bytes.TrimSpace(line), &metrics); err != nil {
+			break
+		}
+
+		fn(metrics)
+
+		offset += int64(len(line))
+		records++
+	}
+
+	if err := f.Truncate(offset); err != nil {
+		return records, fmt.Errorf("truncate wal: %w", err)
+	}
+
+	return records, nil
+}
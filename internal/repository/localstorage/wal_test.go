@@ -0,0 +1,168 @@
+package localstorage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/vorotislav/alert-service/internal/model"
+	"github.com/vorotislav/alert-service/internal/settings/server"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func newFileSettings(t *testing.T, restore bool) *server.Settings {
+	t.Helper()
+
+	interval := 0
+
+	return &server.Settings{
+		StoreInterval:   &interval,
+		Restore:         &restore,
+		FileStoragePath: filepath.Join(t.TempDir(), "metrics.json"),
+	}
+}
+
+func TestMemStorage_WALRecovery(t *testing.T) {
+	t.Parallel()
+
+	set := newFileSettings(t, true)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s, err := NewMemStorage(ctx, zap.NewNop(), set)
+	require.NoError(t, err)
+
+	delta := int64(2)
+	value := 3.5
+
+	for i := 0; i < 3; i++ {
+		_, err = s.UpdateMetric(ctx, model.Metrics{ID: "PollCount", MType: model.MetricCounter, Delta: &delta})
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, s.UpdateMetrics(ctx, []model.Metrics{
+		{ID: "HeapAlloc", MType: model.MetricGauge, Value: &value},
+		{ID: "PollCount", MType: model.MetricCounter, Delta: &delta},
+	}))
+
+	// Хранилище не останавливается: имитируем аварийное завершение с недописанной записью в конце журнала.
+	f, err := os.OpenFile(set.FileStoragePath+walSuffix, os.O_WRONLY|os.O_APPEND, 0o600)
+	require.NoError(t, err)
+	_, err = f.WriteString(`[{"id":"PollCount","type":"counter","del`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	restored, err := NewMemStorage(ctx, zap.NewNop(), set)
+	require.NoError(t, err)
+
+	counter, err := restored.GetCounterValue(ctx, "PollCount", nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(8), counter)
+
+	gauge, err := restored.GetGaugeValue(ctx, "HeapAlloc", nil)
+	require.NoError(t, err)
+	assert.Equal(t, 3.5, gauge)
+
+	info, err := os.Stat(set.FileStoragePath + walSuffix)
+	require.NoError(t, err)
+	assert.Zero(t, info.Size(), "wal must be compacted into snapshot on open")
+}
+
+func TestMemStorage_WALOldReplay(t *testing.T) {
+	t.Parallel()
+
+	set := newFileSettings(t, true)
+
+	require.NoError(t, os.WriteFile(set.FileStoragePath,
+		[]byte(`{"PollCount":{"id":"PollCount","type":"counter","delta":1}}`), 0o600))
+	require.NoError(t, os.WriteFile(set.FileStoragePath+walOldSuffix,
+		[]byte(`[{"id":"PollCount","type":"counter","delta":5}]`+"\n"), 0o600))
+	require.NoError(t, os.WriteFile(set.FileStoragePath+walSuffix,
+		[]byte(`[{"id":"PollCount","type":"counter","delta":9}]`+"\n"), 0o600))
+
+	s, err := NewMemStorage(context.Background(), zap.NewNop(), set)
+	require.NoError(t, err)
+
+	counter, err := s.GetCounterValue(context.Background(), "PollCount", nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(9), counter)
+
+	_, err = os.Stat(set.FileStoragePath + walOldSuffix)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	require.NoError(t, s.Stop(context.Background()))
+}
+
+func TestMemStorage_WALNoRestore(t *testing.T) {
+	t.Parallel()
+
+	set := newFileSettings(t, true)
+
+	s, err := NewMemStorage(context.Background(), zap.NewNop(), set)
+	require.NoError(t, err)
+
+	value := 1.0
+	_, err = s.UpdateMetric(context.Background(), model.Metrics{ID: "HeapAlloc", MType: model.MetricGauge, Value: &value})
+	require.NoError(t, err)
+	require.NoError(t, s.Stop(context.Background()))
+
+	restore := false
+	set.Restore = &restore
+
+	s, err = NewMemStorage(context.Background(), zap.NewNop(), set)
+	require.NoError(t, err)
+	require.NoError(t, s.Stop(context.Background()))
+
+	restore = true
+
+	s, err = NewMemStorage(context.Background(), zap.NewNop(), set)
+	require.NoError(t, err)
+
+	_, err = s.GetGaugeValue(context.Background(), "HeapAlloc", nil)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestOpenWAL_UnknownPolicy(t *testing.T) {
+	t.Parallel()
+
+	_, err := openWAL(filepath.Join(t.TempDir(), "metrics.wal"), "sometimes")
+	assert.ErrorIs(t, err, ErrUnknownFsyncPolicy)
+}
+
+func TestWAL_RotateFailureReopens(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "metrics.wal")
+
+	w, err := openWAL(path, FsyncAlways)
+	require.NoError(t, err)
+
+	defer w.close()
+
+	value := 1.0
+	require.NoError(t, w.append(model.Metrics{ID: "HeapAlloc", MType: model.MetricGauge, Value: &value}))
+
+	// Каталога для old нет, поэтому переименование журнала не удаётся.
+	err = w.rotate(filepath.Join(dir, "missing", "metrics.wal.old"))
+	require.Error(t, err)
+
+	value = 2.0
+	require.NoError(t, w.append(model.Metrics{ID: "HeapAlloc", MType: model.MetricGauge, Value: &value}))
+
+	var got []float64
+
+	records, err := replayWAL(path, func(metrics []model.Metrics) {
+		for _, m := range metrics {
+			got = append(got, *m.Value)
+		}
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, records)
+	assert.Equal(t, []float64{1, 2}, got)
+}
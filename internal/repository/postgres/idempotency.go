@@ -0,0 +1,115 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/vorotislav/alert-service/internal/idempotency"
+	"github.com/vorotislav/alert-service/internal/model"
+
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// idempotent выполняет apply в транзакции не более одного раза для ключа запроса.
+// Если ключ уже применён, возвращает сохранённый результат. Одновременный запрос с тем же ключом
+// ждёт завершения первой транзакции на вставке ключа.
+func (s *Storage) idempotent(
+	ctx context.Context,
+	key string,
+	apply func(tx pgx.Tx) ([]model.Metrics, error),
+) ([]model.Metrics, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction: %w", err)
+	}
+
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	tag, err := tx.Exec(ctx,
+		`INSERT INTO idempotency_keys (key) VALUES ($1) ON CONFLICT (key) DO NOTHING`, key)
+	if err != nil {
+		return nil, fmt.Errorf("insert request key: %w", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		s.log.Debug("request already applied", zap.String("key", key))
+
+		return s.appliedResult(ctx, tx, key)
+	}
+
+	result, err := apply(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := json.Marshal(result)
+	if err != nil {
+		return nil, fmt.Errorf("marshal result: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE idempotency_keys SET result = $2 WHERE key = $1`, key, raw)
+	if err != nil {
+		return nil, fmt.Errorf("save request result: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM idempotency_keys WHERE created_at < now() - make_interval(secs => $1)`,
+		idempotency.DefaultTTL.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("delete expired request keys: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+
+	return result, nil
+}
+
+func (s *Storage) appliedResult(ctx context.Context, tx pgx.Tx, key string) ([]model.Metrics, error) {
+	var raw []byte
+
+	err := tx.QueryRow(ctx, `SELECT result FROM idempotency_keys WHERE key = $1`, key).Scan(&raw)
+	if err != nil {
+		return nil, fmt.Errorf("select request result: %w", err)
+	}
+
+	result := make([]model.Metrics, 0)
+
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &result); err != nil {
+			return nil, fmt.Errorf("unmarshal request result: %w", err)
+		}
+	}
+
+	return result, nil
+}
+
+// updateMetricTx обновляет значение метрики в рамках транзакции.
+func updateMetricTx(ctx context.Context, tx pgx.Tx, metric model.Metrics) (model.Metrics, error) {
+	switch metric.MType {
+	case model.MetricGauge:
+		var value float64
+
+		if err := tx.QueryRow(ctx, queryUpdateGauge,
+			metric.ID, metric.MType, metric.Value, labelsJSON(metric.Labels)).Scan(&value); err != nil {
+			return model.Metrics{}, fmt.Errorf("update gauge %s: %w", metric.ID, err)
+		}
+
+		metric.Value = &value
+	case model.MetricCounter:
+		var delta int64
+
+		if err := tx.QueryRow(ctx, queryUpdateCounter,
+			metric.ID, metric.MType, metric.Delta, labelsJSON(metric.Labels)).Scan(&delta); err != nil {
+			return model.Metrics{}, fmt.Errorf("update counter %s: %w", metric.ID, err)
+		}
+
+		metric.Delta = &delta
+	}
+
+	return metric, nil
+}
@@ -0,0 +1,8 @@
+CREATE TABLE public.metrics_history (
+                                "name" text NOT NULL,
+                                "type" text NOT NULL,
+                                ts timestamptz NOT NULL DEFAULT now(),
+                                value double precision NOT NULL
+);
+
+CREATE INDEX metrics_history_name_type_ts_idx ON public.metrics_history ("name", "type", ts);
@@ -0,0 +1,7 @@
+CREATE TABLE public.idempotency_keys (
+                                "key" text NOT NULL PRIMARY KEY,
+                                result jsonb NULL,
+                                created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idempotency_keys_created_at_idx ON public.idempotency_keys (created_at);
@@ -0,0 +1,9 @@
+DROP INDEX public.metrics_history_name_type_labels_ts_idx;
+DELETE FROM public.metrics_history WHERE labels <> '{}'::jsonb;
+ALTER TABLE public.metrics_history DROP COLUMN labels;
+CREATE INDEX metrics_history_name_type_ts_idx ON public.metrics_history ("name", "type", ts);
+
+DELETE FROM public.metrics WHERE labels <> '{}'::jsonb;
+ALTER TABLE public.metrics DROP CONSTRAINT metrics_pkey;
+ALTER TABLE public.metrics DROP COLUMN labels;
+ALTER TABLE public.metrics ADD PRIMARY KEY ("name");
@@ -0,0 +1,8 @@
+ALTER TABLE public.metrics ADD COLUMN labels jsonb NOT NULL DEFAULT '{}'::jsonb;
+ALTER TABLE public.metrics DROP CONSTRAINT metrics_pkey;
+ALTER TABLE public.metrics ADD PRIMARY KEY ("name", labels);
+
+ALTER TABLE public.metrics_history ADD COLUMN labels jsonb NOT NULL DEFAULT '{}'::jsonb;
+
+DROP INDEX public.metrics_history_name_type_ts_idx;
+CREATE INDEX metrics_history_name_type_labels_ts_idx ON public.metrics_history ("name", "type", labels, ts);
@@ -0,0 +1 @@
+DROP INDEX public.metrics_history_ts_idx;
@@ -0,0 +1,2 @@
+-- Для удаления значений истории старше срока хранения (Storage.deleteHistory).
+CREATE INDEX metrics_history_ts_idx ON public.metrics_history (ts);
@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/vorotislav/alert-service/internal/idempotency"
 	"github.com/vorotislav/alert-service/internal/model"
 	"github.com/vorotislav/alert-service/internal/settings/server"
 
@@ -17,6 +18,7 @@ import (
 	_ "github.com/golang-migrate/migrate/v4/database/postgres" // init migrate package
 	"github.com/golang-migrate/migrate/v4/source/iofs"
 	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	_ "github.com/lib/pq" // init pq package
@@ -37,6 +39,22 @@ var (
 const (
 	maxRetryAttempt = 4
 	retryDelay      = 2
+
+	// historyCleanupInterval как часто удаляются значения истории старше срока хранения.
+	historyCleanupInterval = time.Minute
+)
+
+const (
+	queryUpdateGauge = `with m as (insert into metrics (name, type, value, labels) values ($1, $2, $3, $4::jsonb)
+					on conflict (name, labels) do update set value = $3 returning value)
+				insert into metrics_history (name, type, value, labels) select $1, $2, value, $4::jsonb from m returning value;`
+	queryUpdateCounter = `with m as (insert into metrics (name, type, delta, labels) values ($1, $2, $3, $4::jsonb)
+					on conflict (name, labels) do update
+					set delta = $3 + (select delta from metrics where name = $1 and labels = $4::jsonb) returning delta)
+				insert into metrics_history (name, type, value, labels) select $1, $2, delta, $4::jsonb from m
+				returning value::bigint;`
+	// querySeries выбирает серии метрики, метки которых содержат переданные.
+	querySeries = `SELECT delta, value, labels FROM metrics WHERE name = $1 AND type = $2 AND labels @> $3::jsonb`
 )
 
 // Storage сущность для работы с хранилищем. Хранит в себе пул соединений для PostgreSQL и логгер.
@@ -67,9 +85,49 @@ func NewStorage(ctx context.Context, log *zap.Logger, set *server.Settings) (*St
 		return nil, fmt.Errorf("%w: %w", ErrCreateStorage, err)
 	}
 
+	if set.HistoryRetention > 0 {
+		go s.historyCleanupLoop(ctx, time.Duration(set.HistoryRetention)*time.Second)
+	}
+
 	return s, nil
 }
 
+// historyCleanupLoop периодически удаляет из metrics_history значения старше retention,
+// чтобы история не росла без ограничений.
+func (s *Storage) historyCleanupLoop(ctx context.Context, retention time.Duration) {
+	ticker := time.NewTicker(historyCleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.deleteHistory(ctx, retention); err != nil && ctx.Err() == nil {
+			s.log.Error("cannot delete old metrics history", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			s.log.Debug("stop metrics history cleanup")
+
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// deleteHistory удаляет значения истории старше retention. Использует индекс metrics_history_ts_idx.
+func (s *Storage) deleteHistory(ctx context.Context, retention time.Duration) error {
+	tag, err := s.pool.Exec(ctx, `DELETE FROM metrics_history WHERE ts < now() - make_interval(secs => $1)`,
+		retention.Seconds())
+	if err != nil {
+		return fmt.Errorf("delete metrics history: %w", err)
+	}
+
+	if tag.RowsAffected() > 0 {
+		s.log.Debug("old metrics history deleted", zap.Int64("rows", tag.RowsAffected()))
+	}
+
+	return nil
+}
+
 func (s *Storage) migrate() error {
 	d, err := iofs.New(migrations, "migrations")
 	if err != nil {
@@ -149,26 +207,45 @@ func (s *Storage) retryQueryRow(ctx context.Context, query string, result any, a
 }
 
 // UpdateMetric обновляет значение метрики в БД в зависимости от типа метрики.
+// Если в контексте есть ключ запроса, который уже был применён, возвращает результат первого применения.
 func (s *Storage) UpdateMetric(ctx context.Context, metric model.Metrics) (model.Metrics, error) {
+	if key := idempotency.KeyFromContext(ctx); key != "" {
+		key = idempotency.Scoped(idempotency.KindMetric, key)
+
+		res, err := s.idempotent(ctx, key, func(tx pgx.Tx) ([]model.Metrics, error) {
+			m, err := updateMetricTx(ctx, tx, metric)
+			if err != nil {
+				return nil, err
+			}
+
+			return []model.Metrics{m}, nil
+		})
+		if err != nil {
+			return model.Metrics{}, fmt.Errorf("update metric: %w", err)
+		}
+
+		if len(res) == 0 {
+			return model.Metrics{}, fmt.Errorf("update metric: %w", idempotency.ErrNoResult)
+		}
+
+		return res[0], nil
+	}
+
 	var err error
 
 	switch metric.MType {
 	case model.MetricGauge:
 		{
 			var value float64
-			err = s.retryQueryRow(ctx,
-				`insert into metrics (name, type, value) values ($1, $2, $3) on conflict (name) do update 
-					set value = $3 returning value;`,
-				&value, metric.ID, metric.MType, metric.Value)
+			err = s.retryQueryRow(ctx, queryUpdateGauge, &value,
+				metric.ID, metric.MType, metric.Value, labelsJSON(metric.Labels))
 			metric.Value = &value
 		}
 	case model.MetricCounter:
 		{
 			var delta int64
-			err = s.retryQueryRow(ctx,
-				`insert into metrics (name, type, delta) values ($1, $2, $3) on conflict (name) do update 
-					set delta = $3 + (select delta from metrics where name = $1) returning delta;`,
-				&delta, metric.ID, metric.MType, *metric.Delta)
+			err = s.retryQueryRow(ctx, queryUpdateCounter, &delta,
+				metric.ID, metric.MType, *metric.Delta, labelsJSON(metric.Labels))
 			metric.Delta = &delta
 		}
 	}
@@ -180,21 +257,103 @@ func (s *Storage) UpdateMetric(ctx context.Context, metric model.Metrics) (model
 	return metric, nil
 }
 
-// GetCounterValue возвращает метрику по имени с типом counter.
-func (s *Storage) GetCounterValue(ctx context.Context, name string) (int64, error) {
-	var delta int64
-
-	err := s.retryQueryRow(ctx, "SELECT delta FROM metrics WHERE name = $1", &delta, name)
+// GetCounterValue возвращает значение счётчика по имени и меткам (см. model.SelectSeries).
+func (s *Storage) GetCounterValue(ctx context.Context, name string, labels map[string]string) (int64, error) {
+	m, err := s.selectSeries(ctx, model.MetricCounter, name, labels)
 	if err != nil {
 		return 0, err
 	}
 
-	return delta, nil
+	if m.Delta == nil {
+		return 0, model.ErrSeriesNotFound
+	}
+
+	return *m.Delta, nil
+}
+
+// selectSeries выбирает серию метрики с типом mtype по меткам.
+func (s *Storage) selectSeries(ctx context.Context, mtype, name string, labels map[string]string) (model.Metrics, error) {
+	rows, err := s.pool.Query(ctx, querySeries, name, mtype, labelsJSON(labels))
+	if err != nil {
+		return model.Metrics{}, fmt.Errorf("query series: %w", err)
+	}
+
+	defer rows.Close()
+
+	series := make([]model.Metrics, 0, 1)
+
+	for rows.Next() {
+		m := model.Metrics{ID: name, MType: mtype}
+
+		if err := scanMetric(rows, &m); err != nil {
+			return model.Metrics{}, err
+		}
+
+		series = append(series, m)
+	}
+
+	if err := rows.Err(); err != nil {
+		return model.Metrics{}, fmt.Errorf("rows: %w", err)
+	}
+
+	return model.SelectSeries(series, labels) //nolint:wrapcheck
+}
+
+// scanMetric читает delta, value и labels текущей строки в метрику.
+func scanMetric(rows pgx.Rows, m *model.Metrics) error {
+	var (
+		delta sql.NullInt64
+		value sql.NullFloat64
+	)
+
+	if err := rows.Scan(&delta, &value, &m.Labels); err != nil {
+		return fmt.Errorf("scan row: %w", err)
+	}
+
+	if delta.Valid {
+		m.Delta = &delta.Int64
+	}
+
+	if value.Valid {
+		m.Value = &value.Float64
+	}
+
+	if len(m.Labels) == 0 {
+		m.Labels = nil
+	}
+
+	return nil
+}
+
+// labelsJSON возвращает метки в виде json-объекта для колонки labels.
+func labelsJSON(labels map[string]string) string {
+	if len(labels) == 0 {
+		return "{}"
+	}
+
+	raw, _ := json.Marshal(labels) //nolint:errchkjson // map[string]string всегда сериализуется.
+
+	return string(raw)
 }
 
 // AllMetrics возвращает все метрики с актуальными значениями.
 func (s *Storage) AllMetrics(ctx context.Context) ([]byte, error) {
-	rows, err := s.pool.Query(ctx, "SELECT name, type, delta, value FROM metrics")
+	metrics, err := s.ListMetrics(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	bytes, err := json.Marshal(metrics)
+	if err != nil {
+		return nil, fmt.Errorf("json marshal: %w", err)
+	}
+
+	return bytes, nil
+}
+
+// ListMetrics возвращает все метрики с актуальными значениями, упорядоченные по имени и меткам.
+func (s *Storage) ListMetrics(ctx context.Context) ([]model.Metrics, error) {
+	rows, err := s.pool.Query(ctx, "SELECT name, type, delta, value, labels FROM metrics ORDER BY name, labels")
 	if err != nil {
 		return nil, fmt.Errorf("query all metrics: %w", err)
 	}
@@ -211,7 +370,7 @@ func (s *Storage) AllMetrics(ctx context.Context) ([]byte, error) {
 			value sql.NullFloat64
 		)
 
-		err = rows.Scan(&m.ID, &m.MType, &delta, &value)
+		err = rows.Scan(&m.ID, &m.MType, &delta, &value, &m.Labels)
 		if err != nil {
 			return nil, fmt.Errorf("scan row: %w", err)
 		}
@@ -224,6 +383,10 @@ func (s *Storage) AllMetrics(ctx context.Context) ([]byte, error) {
 			m.Value = &value.Float64
 		}
 
+		if len(m.Labels) == 0 {
+			m.Labels = nil
+		}
+
 		metrics = append(metrics, m)
 	}
 
@@ -232,28 +395,92 @@ func (s *Storage) AllMetrics(ctx context.Context) ([]byte, error) {
 		return nil, fmt.Errorf("rows: %w", err)
 	}
 
-	bytes, err := json.Marshal(metrics)
+	return metrics, nil
+}
+
+// GetGaugeValue возвращает значение датчика по имени и меткам (см. model.SelectSeries).
+func (s *Storage) GetGaugeValue(ctx context.Context, name string, labels map[string]string) (float64, error) {
+	m, err := s.selectSeries(ctx, model.MetricGauge, name, labels)
 	if err != nil {
-		return nil, fmt.Errorf("json marshal: %w", err)
+		return 0, err
 	}
 
-	return bytes, nil
+	if m.Value == nil {
+		return 0, model.ErrSeriesNotFound
+	}
+
+	return *m.Value, nil
 }
 
-// GetGaugeValue возвращает метрику по имени с типом gauge.
-func (s *Storage) GetGaugeValue(ctx context.Context, name string) (float64, error) {
-	var value float64
+// History возвращает сохранённые значения серии из полуинтервала [from, to), упорядоченные по времени.
+// Серия выбирается по меткам так же, как в GetGaugeValue.
+func (s *Storage) History(ctx context.Context, mtype, name string, labels map[string]string,
+	from, to time.Time,
+) ([]model.Sample, error) {
+	series, err := s.selectSeries(ctx, mtype, name, labels)
+	if err != nil {
+		if errors.Is(err, model.ErrSeriesNotFound) {
+			return make([]model.Sample, 0), nil
+		}
+
+		return nil, err
+	}
 
-	err := s.retryQueryRow(ctx, "SELECT value FROM metrics WHERE name = $1", &value, name)
+	rows, err := s.pool.Query(ctx,
+		`SELECT ts, value FROM metrics_history
+			WHERE name = $1 AND type = $2 AND labels = $3::jsonb AND ts >= $4 AND ts < $5 ORDER BY ts`,
+		name, mtype, labelsJSON(series.Labels), from, to)
 	if err != nil {
-		return 0, err
+		return nil, fmt.Errorf("query metric history: %w", err)
+	}
+
+	defer rows.Close()
+
+	samples := make([]model.Sample, 0)
+
+	for rows.Next() {
+		sample := model.Sample{}
+
+		if err := rows.Scan(&sample.Timestamp, &sample.Value); err != nil {
+			return nil, fmt.Errorf("scan row: %w", err)
+		}
+
+		samples = append(samples, sample)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows: %w", err)
 	}
 
-	return value, nil
+	return samples, nil
 }
 
 // UpdateMetrics обновляет сразу массив метрик.
+// Если в контексте есть ключ запроса, все метрики обновляются в одной транзакции и не более одного раза.
 func (s *Storage) UpdateMetrics(ctx context.Context, metrics []model.Metrics) error {
+	if err := model.ValidateBatch(metrics); err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	if key := idempotency.KeyFromContext(ctx); key != "" {
+		key = idempotency.Scoped(idempotency.KindBatch, key)
+
+		_, err := s.idempotent(ctx, key, func(tx pgx.Tx) ([]model.Metrics, error) {
+			for _, m := range metrics {
+				if _, err := updateMetricTx(ctx, tx, m); err != nil {
+					return nil, err
+				}
+			}
+
+			return nil, nil
+		})
+		if err != nil {
+			return fmt.Errorf("cannot update metrics: %w", err)
+		}
+
+		return nil
+	}
+
 	counters := make([]model.Metrics, 0)
 	gauges := make([]model.Metrics, 0)
 
@@ -290,8 +517,9 @@ func (s *Storage) updateCounters(ctx context.Context, metrics []model.Metrics) e
 }
 
 func (s *Storage) updateGauges(ctx context.Context, metrics []model.Metrics) error {
-	qI := `INSERT INTO metrics (name, type, value) VALUES ($1, $2, $3) on conflict (name) do update 
+	qI := `INSERT INTO metrics (name, type, value, labels) VALUES ($1, $2, $3, $4::jsonb) on conflict (name, labels) do update 
     set value = $3`
+	qH := `INSERT INTO metrics_history (name, type, value, labels) VALUES ($1, $2, $3, $4::jsonb)`
 
 	tx, err := s.pool.Begin(ctx)
 
@@ -304,10 +532,15 @@ func (s *Storage) updateGauges(ctx context.Context, metrics []model.Metrics) err
 	}()
 
 	for _, m := range metrics {
-		_, err := tx.Exec(ctx, qI, m.ID, m.MType, m.Value)
+		_, err := tx.Exec(ctx, qI, m.ID, m.MType, m.Value, labelsJSON(m.Labels))
 		if err != nil {
 			return fmt.Errorf("cannot update gauge metric: %w", err)
 		}
+
+		_, err = tx.Exec(ctx, qH, m.ID, m.MType, m.Value, labelsJSON(m.Labels))
+		if err != nil {
+			return fmt.Errorf("cannot save gauge metric history: %w", err)
+		}
 	}
 
 	err = tx.Commit(ctx)
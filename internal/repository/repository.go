@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/vorotislav/alert-service/internal/model"
 	"github.com/vorotislav/alert-service/internal/repository/localstorage"
@@ -15,9 +16,11 @@ import (
 type Repository interface {
 	Stop(ctx context.Context) error
 	UpdateMetric(ctx context.Context, metric model.Metrics) (model.Metrics, error)
-	GetCounterValue(ctx context.Context, name string) (int64, error)
-	GetGaugeValue(ctx context.Context, name string) (float64, error)
+	GetCounterValue(ctx context.Context, name string, labels map[string]string) (int64, error)
+	GetGaugeValue(ctx context.Context, name string, labels map[string]string) (float64, error)
 	AllMetrics(ctx context.Context) ([]byte, error)
+	ListMetrics(ctx context.Context) ([]model.Metrics, error)
+	History(ctx context.Context, mtype, name string, labels map[string]string, from, to time.Time) ([]model.Sample, error)
 	Ping(ctx context.Context) error
 	UpdateMetrics(ctx context.Context, metrics []model.Metrics) error
 }
@@ -1,5 +1,9 @@
 package agent
 
+import (
+	"encoding/json"
+)
+
 // Settings представляет настройки для агента.
 type Settings struct {
 	ServerAddress  string `env:"ADDRESS"`
@@ -9,6 +13,24 @@ type Settings struct {
 	RateLimit      int    `env:"RATE_LIMIT"`
 	CryptoKey      string `env:"CRYPTO_KEY"`
 	Config         string `env:"CONFIG"`
+	BatchSize      int    `env:"BATCH_SIZE"`
+	SpoolDir       string `env:"SPOOL_DIR"`
+	SpoolMaxBytes  int64  `env:"SPOOL_MAX_BYTES"`
+	SpoolMaxAge    int    `env:"SPOOL_MAX_AGE"`
+	Host           string `env:"AGENT_HOST"`
+	ID             string `env:"AGENT_ID"`
+	Version        string
+	Labels         map[string]string
+	Collectors     map[string]json.RawMessage
+	Aggregation    []AggregationRule
+}
+
+// AggregationRule правило агрегации метрик gauge за интервал отправки. Match - регулярное выражение
+// для имени метрики, Aggregates - что отправлять: last (последнее значение под исходным именем),
+// min, max, mean и p<N> (перцентиль, например p95) - под именами с суффиксом "_min", "_p95" и т.д.
+type AggregationRule struct {
+	Match      string   `json:"match"`
+	Aggregates []string `json:"aggregates"`
 }
 
 type Config struct {
@@ -16,4 +38,18 @@ type Config struct {
 	ReportInterval string `json:"report_interval"`
 	PollInterval   string `json:"poll_interval"`
 	CryptoKey      string `json:"crypto_key"`
+	BatchSize      string `json:"batch_size"`
+	SpoolDir       string `json:"spool_dir"`
+	SpoolMaxBytes  string `json:"spool_max_bytes"`
+	SpoolMaxAge    string `json:"spool_max_age"`
+	// Host значение метки host у всех метрик агента, по умолчанию имя хоста.
+	Host string `json:"host"`
+	// ID идентификатор агента на сервере, по умолчанию совпадает с Host.
+	ID string `json:"id"`
+	// Labels статические метки, которые добавляются ко всем метрикам агента, например {"dc": "eu-1"}.
+	Labels map[string]string `json:"labels"`
+	// Collectors настройки коллекторов по их именам, например {"cpu": {"enabled": false}}.
+	Collectors map[string]json.RawMessage `json:"collectors"`
+	// Aggregation правила агрегации gauge; для метрики применяется первое подходящее правило.
+	Aggregation []AggregationRule `json:"aggregation"`
 }
@@ -2,21 +2,63 @@ package server
 
 // Settings представляет настройки для сервера.
 type Settings struct {
-	Address         string `env:"ADDRESS"`
-	StoreInterval   *int   `env:"STORE_INTERVAL"`
-	FileStoragePath string `env:"FILE_STORAGE_PATH"`
-	Restore         *bool  `env:"RESTORE"`
-	DatabaseDSN     string `env:"DATABASE_DSN"`
-	HashKey         string `env:"KEY"`
-	CryptoKey       string `env:"CRYPTO_KEY"`
-	Config          string `env:"CONFIG"`
+	Address             string `env:"ADDRESS"`
+	StoreInterval       *int   `env:"STORE_INTERVAL"`
+	FileStoragePath     string `env:"FILE_STORAGE_PATH"`
+	Restore             *bool  `env:"RESTORE"`
+	DatabaseDSN         string `env:"DATABASE_DSN"`
+	HashKey             string `env:"KEY"`
+	CryptoKey           string `env:"CRYPTO_KEY"`
+	Config              string `env:"CONFIG"`
+	AlertsInterval      int    `env:"ALERTS_INTERVAL"`
+	HistorySize         int    `env:"HISTORY_SIZE"`
+	HistoryRetention    int    `env:"HISTORY_RETENTION"`
+	WALFsync            string `env:"WAL_FSYNC"`
+	WALCompact          int    `env:"WAL_COMPACT_INTERVAL"`
+	AgentStaleIntervals int    `env:"AGENT_STALE_INTERVALS"`
+	AlertRules          []AlertRule
+	Notify              NotifySettings
 }
 
 type Config struct {
-	Address       string  `json:"address"`
-	Restore       *bool   `json:"restore,omitempty"`
-	StoreInterval *string `json:"store_interval,omitempty"`
-	StoreFile     string  `json:"store_file"`
-	DatabaseDsn   string  `json:"database_dsn"`
-	CryptoKey     string  `json:"crypto_key"`
+	Address        string         `json:"address"`
+	Restore        *bool          `json:"restore,omitempty"`
+	StoreInterval  *string        `json:"store_interval,omitempty"`
+	StoreFile      string         `json:"store_file"`
+	DatabaseDsn    string         `json:"database_dsn"`
+	CryptoKey      string         `json:"crypto_key"`
+	AlertsInterval string         `json:"alerts_interval"`
+	HistorySize    int            `json:"history_size"`
+	HistoryTTL     string         `json:"history_retention"`
+	WALFsync       string         `json:"wal_fsync"`
+	WALCompact     string         `json:"wal_compact_interval"`
+	AgentStale     string         `json:"agent_stale_intervals"`
+	AlertRules     []AlertRule    `json:"alert_rules"`
+	Notify         NotifySettings `json:"notify"`
+}
+
+// AlertRule описывает правило алертинга из файла конфигурации.
+// Op - оператор сравнения значения метрики с порогом: >, >=, <, <=, ==, !=.
+// For - сколько условие должно выполняться, прежде чем алерт сработает, например "1m".
+// Labels - метки, по которым выбирается серия метрики, например {"host": "web-1"}.
+type AlertRule struct {
+	Name      string            `json:"name"`
+	Labels    map[string]string `json:"labels"`
+	Metric    string            `json:"metric"`
+	Type      string            `json:"type"`
+	Op        string            `json:"op"`
+	Threshold float64           `json:"threshold"`
+	For       string            `json:"for"`
+}
+
+// NotifySettings настройки доставки уведомлений об изменении состояния алертов на webhook'и.
+// QueuePath - файл, в котором сохраняется очередь недоставленных уведомлений.
+// MinBackoff и MaxBackoff - границы экспоненциальной задержки между попытками, например "1s" и "5m".
+type NotifySettings struct {
+	Webhooks    []string `json:"webhooks"`
+	HashKey     string   `json:"hash_key"`
+	QueuePath   string   `json:"queue_path"`
+	MaxAttempts int      `json:"max_attempts"`
+	MinBackoff  string   `json:"min_backoff"`
+	MaxBackoff  string   `json:"max_backoff"`
 }
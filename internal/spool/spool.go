@@ -0,0 +1,367 @@
+// Пакет spool представляет очередь на диске для пакетов метрик, которые агент не смог отправить.
+// Каждый пакет хранится в отдельном файле; пакеты отдаются на повторную отправку от старых к новым.
+// Размер очереди и возраст пакетов ограничены: при превышении самый старый пакет вытесняется,
+// а его счётчики прибавляются к следующему пакету, чтобы не потерять приращения.
+// Вместе с пакетом хранится его ключ запроса, чтобы повторная отправка шла с тем же ключом
+// и сервер не применил пакет дважды, если первая отправка всё же дошла.
+package spool
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vorotislav/alert-service/internal/idempotency"
+	"github.com/vorotislav/alert-service/internal/model"
+
+	"go.uber.org/zap"
+)
+
+const (
+	batchExt = ".json"
+	tmpExt   = ".tmp"
+
+	defaultDirPermission  = 0o755
+	defaultFilePermission = 0o600
+)
+
+// batch содержимое файла пакета.
+type batch struct {
+	Key     string          `json:"key"`
+	Metrics []model.Metrics `json:"metrics"`
+}
+
+type entry struct {
+	name    string
+	created time.Time
+	size    int64
+}
+
+// Spool очередь пакетов метрик на диске.
+type Spool struct {
+	log      *zap.Logger
+	dir      string
+	maxBytes int64
+	maxAge   time.Duration
+	now      func() time.Time
+
+	mu      sync.Mutex
+	seq     int
+	entries []entry
+	size    int64
+}
+
+// NewSpool конструктор для Spool. Создаёт каталог, если его нет, и загружает пакеты,
+// оставшиеся от предыдущего запуска. Нулевые maxBytes и maxAge означают отсутствие ограничения.
+func NewSpool(log *zap.Logger, dir string, maxBytes int64, maxAge time.Duration) (*Spool, error) {
+	if err := os.MkdirAll(dir, defaultDirPermission); err != nil {
+		return nil, fmt.Errorf("create spool dir: %w", err)
+	}
+
+	s := &Spool{
+		log:      log.With(zap.String("package", "spool")),
+		dir:      dir,
+		maxBytes: maxBytes,
+		maxAge:   maxAge,
+		now:      time.Now,
+	}
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *Spool) load() error {
+	files, err := os.ReadDir(s.dir)
+	if err != nil {
+		return fmt.Errorf("read spool dir: %w", err)
+	}
+
+	for _, f := range files {
+		name := f.Name()
+
+		if strings.HasSuffix(name, tmpExt) {
+			_ = os.Remove(filepath.Join(s.dir, name))
+
+			continue
+		}
+
+		var nanos int64
+
+		if _, err := fmt.Sscanf(name, "%d-", &nanos); err != nil || !strings.HasSuffix(name, batchExt) {
+			continue
+		}
+
+		info, err := f.Info()
+		if err != nil {
+			return fmt.Errorf("stat spool file: %w", err)
+		}
+
+		s.entries = append(s.entries, entry{
+			name:    name,
+			created: time.Unix(0, nanos),
+			size:    info.Size(),
+		})
+		s.size += info.Size()
+	}
+
+	sort.Slice(s.entries, func(i, j int) bool {
+		return s.entries[i].name < s.entries[j].name
+	})
+
+	if len(s.entries) > 0 {
+		s.log.Info("spool restored", zap.Int("batches", len(s.entries)), zap.Int64("bytes", s.size))
+	}
+
+	return nil
+}
+
+// Len возвращает количество пакетов в очереди.
+func (s *Spool) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.entries)
+}
+
+// Size возвращает суммарный размер пакетов в очереди в байтах.
+func (s *Spool) Size() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.size
+}
+
+// Push сохраняет пакет с ключом запроса key в конец очереди и вытесняет старые пакеты, если превышены ограничения.
+func (s *Spool) Push(key string, metrics []model.Metrics) error {
+	if len(metrics) == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.seq++
+
+	name := fmt.Sprintf("%020d-%06d%s", now.UnixNano(), s.seq, batchExt)
+
+	size, err := s.write(name, batch{Key: key, Metrics: metrics})
+	if err != nil {
+		return err
+	}
+
+	s.entries = append(s.entries, entry{name: name, created: now, size: size})
+	s.size += size
+
+	s.enforce(now)
+
+	return nil
+}
+
+// Replay отправляет пакеты через send с их ключами от старых к новым и удаляет отправленные.
+// Перед отправкой вытесняет пакеты, превысившие ограничения. На первой ошибке останавливается;
+// если ошибка - *model.UnsentError, в пакете остаются только недоставленные метрики, а ключ пакета
+// сохраняется. Пакет, все недоставленные метрики которого сервер отклонил, удаляется,
+// чтобы он не блокировал очередь.
+func (s *Spool) Replay(send func(key string, metrics []model.Metrics) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.enforce(s.now())
+
+	for len(s.entries) > 0 {
+		e := s.entries[0]
+
+		b, err := s.read(e.name)
+		if err != nil {
+			s.log.Error("drop unreadable batch", zap.String("file", e.name), zap.Error(err))
+			s.remove()
+
+			continue
+		}
+
+		if err := send(b.Key, b.Metrics); err != nil {
+			var ue *model.UnsentError
+			if errors.As(err, &ue) && len(ue.Metrics) == 0 {
+				s.log.Error("drop batch rejected by server", zap.String("file", e.name),
+					zap.Int("rejected", len(ue.Rejected)), zap.Error(err))
+				s.remove()
+
+				continue
+			}
+
+			if ue != nil && len(ue.Metrics) < len(b.Metrics) {
+				s.rewrite(0, batch{Key: b.Key, Metrics: ue.Metrics})
+			}
+
+			return fmt.Errorf("replay batch %s: %w", e.name, err)
+		}
+
+		s.remove()
+	}
+
+	return nil
+}
+
+// enforce вытесняет самые старые пакеты, пока очередь превышает ограничения. Последний пакет не вытесняется.
+func (s *Spool) enforce(now time.Time) {
+	for len(s.entries) > 1 {
+		tooBig := s.maxBytes > 0 && s.size > s.maxBytes
+		tooOld := s.maxAge > 0 && now.Sub(s.entries[0].created) > s.maxAge
+
+		if !tooBig && !tooOld {
+			return
+		}
+
+		s.evict()
+	}
+}
+
+// evict удаляет самый старый пакет, прибавив его счётчики к следующему пакету.
+// Значения gauge из вытесненного пакета теряются: в следующем пакете они новее.
+// У объединённого пакета новое содержимое, поэтому он получает новый ключ запроса.
+func (s *Spool) evict() {
+	oldest, err := s.read(s.entries[0].name)
+	if err != nil {
+		s.log.Error("drop unreadable batch", zap.String("file", s.entries[0].name), zap.Error(err))
+		s.remove()
+
+		return
+	}
+
+	next, err := s.read(s.entries[1].name)
+	if err != nil {
+		s.log.Error("drop unreadable batch", zap.String("file", s.entries[1].name), zap.Error(err))
+		s.entries[0], s.entries[1] = s.entries[1], s.entries[0]
+		s.remove()
+
+		return
+	}
+
+	merged, dropped := MergeCounters(oldest.Metrics, next.Metrics)
+
+	s.rewrite(1, batch{Key: idempotency.NewKey(), Metrics: merged})
+	s.remove()
+
+	s.log.Info("spool batch evicted", zap.Int("dropped gauges", dropped))
+}
+
+// MergeCounters прибавляет счётчики из older к тем же сериям пакета newer и возвращает результат
+// и количество отброшенных метрик gauge из older.
+func MergeCounters(older, newer []model.Metrics) ([]model.Metrics, int) {
+	merged := make([]model.Metrics, 0, len(newer))
+	index := make(map[string]int, len(newer))
+
+	for _, m := range newer {
+		index[m.SeriesKey()] = len(merged)
+		merged = append(merged, m.Clone())
+	}
+
+	dropped := 0
+
+	for _, m := range older {
+		if m.MType != model.MetricCounter || m.Delta == nil {
+			dropped++
+
+			continue
+		}
+
+		i, ok := index[m.SeriesKey()]
+		if !ok {
+			index[m.SeriesKey()] = len(merged)
+			merged = append(merged, m.Clone())
+
+			continue
+		}
+
+		if merged[i].MType != model.MetricCounter || merged[i].Delta == nil {
+			dropped++
+
+			continue
+		}
+
+		*merged[i].Delta += *m.Delta
+	}
+
+	return merged, dropped
+}
+
+// remove удаляет первый пакет очереди.
+func (s *Spool) remove() {
+	e := s.entries[0]
+
+	if err := os.Remove(filepath.Join(s.dir, e.name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		s.log.Error("cannot remove batch", zap.String("file", e.name), zap.Error(err))
+	}
+
+	s.entries = s.entries[1:]
+	s.size -= e.size
+}
+
+// rewrite заменяет содержимое i-го пакета, сохраняя его место в очереди.
+func (s *Spool) rewrite(i int, b batch) {
+	e := s.entries[i]
+
+	size, err := s.write(e.name, b)
+	if err != nil {
+		s.log.Error("cannot rewrite batch", zap.String("file", e.name), zap.Error(err))
+
+		return
+	}
+
+	s.size += size - e.size
+	s.entries[i].size = size
+}
+
+// write атомарно записывает пакет в файл через временный файл и переименование.
+func (s *Spool) write(name string, b batch) (int64, error) {
+	raw, err := json.Marshal(b)
+	if err != nil {
+		return 0, fmt.Errorf("marshal batch: %w", err)
+	}
+
+	path := filepath.Join(s.dir, name)
+	tmp := path + tmpExt
+
+	if err := os.WriteFile(tmp, raw, defaultFilePermission); err != nil {
+		return 0, fmt.Errorf("write batch: %w", err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return 0, fmt.Errorf("rename batch: %w", err)
+	}
+
+	return int64(len(raw)), nil
+}
+
+// read читает пакет. Файлы прежнего формата содержат только массив метрик, и ключа у них нет.
+func (s *Spool) read(name string) (batch, error) {
+	raw, err := os.ReadFile(filepath.Join(s.dir, name))
+	if err != nil {
+		return batch{}, fmt.Errorf("read batch: %w", err)
+	}
+
+	b := batch{Metrics: make([]model.Metrics, 0)}
+
+	if trimmed := bytes.TrimSpace(raw); len(trimmed) > 0 && trimmed[0] == '[' {
+		err = json.Unmarshal(raw, &b.Metrics)
+	} else {
+		err = json.Unmarshal(raw, &b)
+	}
+
+	if err != nil {
+		return batch{}, fmt.Errorf("unmarshal batch: %w", err)
+	}
+
+	return b, nil
+}
@@ -0,0 +1,254 @@
+package spool
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/vorotislav/alert-service/internal/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+var errServerDown = errors.New("server down")
+
+func counter(id string, delta int64) model.Metrics {
+	return model.Metrics{ID: id, MType: model.MetricCounter, Delta: &delta}
+}
+
+func gauge(id string, value float64) model.Metrics {
+	return model.Metrics{ID: id, MType: model.MetricGauge, Value: &value}
+}
+
+func TestSpool_ReplayInOrder(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	s, err := NewSpool(zap.NewNop(), dir, 0, 0)
+	require.NoError(t, err)
+
+	require.NoError(t, s.Push("k1", []model.Metrics{gauge("HeapAlloc", 1)}))
+	require.NoError(t, s.Push("k2", []model.Metrics{gauge("HeapAlloc", 2)}))
+	require.NoError(t, s.Push("k3", []model.Metrics{gauge("HeapAlloc", 3)}))
+
+	err = s.Replay(func(_ string, metrics []model.Metrics) error {
+		if *metrics[0].Value == 2 {
+			return errServerDown
+		}
+
+		return nil
+	})
+	require.ErrorIs(t, err, errServerDown)
+	assert.Equal(t, 2, s.Len())
+
+	// Очередь переживает перезапуск агента.
+	restored, err := NewSpool(zap.NewNop(), dir, 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, 2, restored.Len())
+	assert.Equal(t, s.Size(), restored.Size())
+
+	values := make([]float64, 0)
+	keys := make([]string, 0)
+
+	require.NoError(t, restored.Replay(func(key string, metrics []model.Metrics) error {
+		values = append(values, *metrics[0].Value)
+		keys = append(keys, key)
+
+		return nil
+	}))
+	assert.Equal(t, []float64{2, 3}, values)
+	assert.Equal(t, []string{"k2", "k3"}, keys)
+	assert.Zero(t, restored.Len())
+	assert.Zero(t, restored.Size())
+}
+
+func TestSpool_ReplayPartial(t *testing.T) {
+	t.Parallel()
+
+	s, err := NewSpool(zap.NewNop(), t.TempDir(), 0, 0)
+	require.NoError(t, err)
+
+	require.NoError(t, s.Push("k1", []model.Metrics{counter("PollCount", 5), gauge("HeapAlloc", 1)}))
+
+	err = s.Replay(func(_ string, _ []model.Metrics) error {
+		return &model.UnsentError{Metrics: []model.Metrics{counter("PollCount", 5)}, Err: errServerDown}
+	})
+	require.ErrorIs(t, err, errServerDown)
+
+	var (
+		got    []model.Metrics
+		gotKey string
+	)
+
+	require.NoError(t, s.Replay(func(key string, metrics []model.Metrics) error {
+		got, gotKey = metrics, key
+
+		return nil
+	}))
+	require.Len(t, got, 1)
+	assert.Equal(t, "PollCount", got[0].ID)
+	assert.Equal(t, "k1", gotKey, "partially sent batch keeps its key")
+}
+
+func TestSpool_ReplayRejected(t *testing.T) {
+	t.Parallel()
+
+	s, err := NewSpool(zap.NewNop(), t.TempDir(), 0, 0)
+	require.NoError(t, err)
+
+	require.NoError(t, s.Push("k1", []model.Metrics{gauge("Bad", 1)}))
+	require.NoError(t, s.Push("k2", []model.Metrics{gauge("HeapAlloc", 2)}))
+
+	keys := make([]string, 0)
+
+	// Пакет, отклонённый сервером целиком, удаляется и не блокирует следующие пакеты.
+	require.NoError(t, s.Replay(func(key string, metrics []model.Metrics) error {
+		keys = append(keys, key)
+
+		if metrics[0].ID == "Bad" {
+			return &model.UnsentError{Rejected: metrics, Err: errServerDown}
+		}
+
+		return nil
+	}))
+	assert.Equal(t, []string{"k1", "k2"}, keys)
+	assert.Zero(t, s.Len())
+}
+
+func TestSpool_ReplayEvictsByAge(t *testing.T) {
+	t.Parallel()
+
+	s, err := NewSpool(zap.NewNop(), t.TempDir(), 0, time.Minute)
+	require.NoError(t, err)
+
+	current := time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return current }
+
+	require.NoError(t, s.Push("k1", []model.Metrics{counter("PollCount", 1)}))
+	require.NoError(t, s.Push("k2", []model.Metrics{counter("PollCount", 2)}))
+
+	// Устаревшие пакеты вытесняются и без новых Push.
+	current = current.Add(time.Hour)
+
+	require.Error(t, s.Replay(func(_ string, _ []model.Metrics) error {
+		return errServerDown
+	}))
+	require.Equal(t, 1, s.Len())
+
+	require.NoError(t, s.Replay(func(_ string, metrics []model.Metrics) error {
+		require.Len(t, metrics, 1)
+		assert.Equal(t, int64(3), *metrics[0].Delta)
+
+		return nil
+	}))
+}
+
+func TestSpool_LegacyBatch(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "00000000000000000001-000001.json"),
+		[]byte(`[{"id":"PollCount","type":"counter","delta":5}]`), 0o600))
+
+	s, err := NewSpool(zap.NewNop(), dir, 0, 0)
+	require.NoError(t, err)
+
+	var got []model.Metrics
+
+	require.NoError(t, s.Replay(func(key string, metrics []model.Metrics) error {
+		assert.Empty(t, key)
+
+		got = metrics
+
+		return nil
+	}))
+	require.Len(t, got, 1)
+	assert.Equal(t, int64(5), *got[0].Delta)
+}
+
+func TestSpool_Evict(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name     string
+		maxBytes int64
+		maxAge   time.Duration
+		step     time.Duration
+	}{
+		{
+			name:     "size limit",
+			maxBytes: 150,
+			step:     time.Second,
+		},
+		{
+			name:   "age limit",
+			maxAge: time.Minute,
+			step:   time.Minute,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			s, err := NewSpool(zap.NewNop(), t.TempDir(), tc.maxBytes, tc.maxAge)
+			require.NoError(t, err)
+
+			current := now
+			s.now = func() time.Time { return current }
+
+			for i := 1; i <= 4; i++ {
+				require.NoError(t, s.Push(fmt.Sprintf("k%d", i),
+					[]model.Metrics{counter("PollCount", int64(i)), gauge("HeapAlloc", float64(i))}))
+
+				current = current.Add(tc.step)
+			}
+
+			assert.Less(t, s.Len(), 4)
+
+			var (
+				total int64
+				last  float64
+			)
+
+			require.NoError(t, s.Replay(func(_ string, metrics []model.Metrics) error {
+				for _, m := range metrics {
+					if m.MType == model.MetricCounter {
+						total += *m.Delta
+					} else {
+						last = *m.Value
+					}
+				}
+
+				return nil
+			}))
+
+			assert.Equal(t, int64(10), total, "counter deltas must survive eviction")
+			assert.Equal(t, float64(4), last)
+		})
+	}
+}
+
+func TestMergeCounters(t *testing.T) {
+	t.Parallel()
+
+	merged, dropped := MergeCounters(
+		[]model.Metrics{counter("PollCount", 2), counter("Errors", 1), gauge("HeapAlloc", 1)},
+		[]model.Metrics{counter("PollCount", 3), gauge("HeapAlloc", 5)},
+	)
+
+	assert.Equal(t, 1, dropped)
+	require.Len(t, merged, 3)
+	assert.Equal(t, int64(5), *merged[0].Delta)
+	assert.Equal(t, float64(5), *merged[1].Value)
+	assert.Equal(t, "Errors", merged[2].ID)
+}